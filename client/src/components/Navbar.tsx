@@ -5,7 +5,7 @@ export const Navbar = () => {
     return (
         <AppBar position="static">
             <Toolbar>
-                <IconButton onClick={() => window.location.href = "/"} size="large" edge='start' color="inherit" aria-label="logo">
+                <IconButton onClick={() => window.location.href = process.env.PUBLIC_URL + "/"} size="large" edge='start' color="inherit" aria-label="logo">
                     <LocalShipping />
                 </IconButton>
                 <Typography variant="h6" component='div'>
@@ -0,0 +1,28 @@
+import axios from "axios";
+
+/**
+ * Runtime settings served by the backend at config.json, so one build can
+ * be deployed against any API.
+ */
+export interface Config {
+    api_base_url: string
+}
+
+/**
+ * Loads the runtime settings and points axios at the API. When they can't
+ * be loaded, requests go to the origin the app was served from.
+ * @returns [Promise<void>]
+ */
+export const loadConfig = async () => {
+    try {
+        const res = await axios.get<Config>(process.env.PUBLIC_URL + '/config.json')
+        axios.defaults.baseURL = res.data.api_base_url
+    } catch (error) {
+        console.error(error)
+    }
+    axios.defaults.withCredentials = true
+
+    // Writes made with the session cookie must echo the CSRF token back.
+    axios.defaults.xsrfCookieName = 'csrf_token'
+    axios.defaults.xsrfHeaderName = 'X-CSRF-Token'
+}
@@ -50,7 +50,7 @@ function VehicleRow({ vin, mileage, largest_weight }: VehicleProps) {
             <TableCell>{mileage}</TableCell>
             <TableCell>{largest_weight}</TableCell>
             <TableCell align="right">
-                <a href={"/vehicles/" + vin}>View</a>
+                <a href={process.env.PUBLIC_URL + "/vehicles/" + vin}>View</a>
             </TableCell>
         </TableRow>
     )
@@ -75,14 +75,14 @@ const Client = () => {
             document.title = params.id + " | Starter Project"
 
             // Fetch client and vehicles data
-            axios.get('http://localhost:8080/clients/' + params.id)
+            axios.get('/v1/clients/' + params.id)
                 .then((res: AxiosResponse<ClientProps>) => {
                     setClient(res.data)
                 }).catch((error) => {
                     console.error(error.response.data.message)
                     setErrorText(error.response.data.message)
                 });
-            axios.get('http://localhost:8080/clients/' + params.id + '/vehicles')
+            axios.get('/v1/clients/' + params.id + '/vehicles')
                 .then((res: AxiosResponse<Vehicles>) => {
                     setVehicles({
                         name: res.data.name,
@@ -27,7 +27,7 @@ type ClientProps = {
  * @rerurns [JSX.Element] TableRow
  */
 const ClientRow = ({ name, contact_name, contact_email, number_of_vehicles }: ClientProps, key: number) => {
-    var client_url = '/clients/' + name
+    var client_url = process.env.PUBLIC_URL + '/clients/' + name
 
     return (
         <TableRow>
@@ -58,7 +58,7 @@ const Clients = () => {
             document.title = "Clients | Starter Project"
 
             // Get clients from the server
-            axios.get('http://localhost:8080/clients')
+            axios.get('/v1/clients')
                 .then((res: AxiosResponse<ClientProps[]>) => {
                     setClients(res.data.sort((a, b) => a.name.localeCompare(b.name)))
                     setIsLoading(false)
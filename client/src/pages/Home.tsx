@@ -20,7 +20,7 @@ const Home = () => {
     function selectVehicle() {
         var vehicle = prompt("Enter vehicle identification number (VIN):");
         if (vehicle != null) {
-            window.location.href = "/vehicles/" + vehicle
+            window.location.href = process.env.PUBLIC_URL + "/vehicles/" + vehicle
         }
     }
 
@@ -34,7 +34,7 @@ const Home = () => {
                 <h1>Home</h1>
                 <div style={{ display: 'flex', flexDirection: 'row', gap: 20, justifyContent: 'center' }}>
                     <Card sx={{ width: 200, height: 200}}>
-                        <CardActionArea href="/clients" style={{ width: '100%', height: '100%', alignContent: 'center' }}>
+                        <CardActionArea href={process.env.PUBLIC_URL + "/clients"} style={{ width: '100%', height: '100%', alignContent: 'center' }}>
                             <Business sx={{ fontSize: 100 }} />
                             <h2>Clients</h2>
                         </CardActionArea>
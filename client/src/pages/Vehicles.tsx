@@ -58,7 +58,7 @@ const Vehicles = () => {
             document.title = params.id + " | Vehicles | Starter Project"
 
             // Get vehicle info from the server
-            axios.get('http://localhost:8080/vehicles/' + params.id)
+            axios.get('/v1/vehicles/' + params.id)
                 .then((res: AxiosResponse<Vehicle>) => {
                     setVehicle(res.data)
                     setIsLoading(false)
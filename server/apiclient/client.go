@@ -0,0 +1,286 @@
+// Package apiclient is a typed Go client for the fleet API, for services that
+// would otherwise build the HTTP calls and copy the response types
+// themselves.
+//
+// The client speaks the current API version, v2. Every call takes a
+// context, failed calls that are safe to repeat are retried with backoff,
+// and errors from the API are returned as *Error, which can be matched
+// with errors.Is against ErrNotFound and the other sentinels. The types
+// are checked against the server's when it starts, so they can't drift
+// apart.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Version is the API version the client speaks.
+const Version = "v2"
+
+// Defaults for the options.
+const (
+	DefaultRetries    = 3
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// Client calls the fleet API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	apiKey     string
+	token      string
+	userAgent  string
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends requests with httpClient instead of
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey identifies the caller with an API key, which sets its rate
+// limit plan.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken authenticates with a session token.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with each request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRetries sets how many times a failed call is retried. Zero turns
+// retries off.
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		c.retries = retries
+	}
+}
+
+// WithBackoff sets the shortest and longest wait between retries. The wait
+// doubles after each attempt, with jitter, unless the server asks for a
+// particular wait with Retry-After.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// New returns a client for the API served at baseURL, such as
+// http://localhost:8080.
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("apiclient: base URL %q must be an absolute http or https URL", baseURL)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	parsed.RawPath = ""
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: http.DefaultClient,
+		userAgent:  "fleet-go-client",
+		retries:    DefaultRetries,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.retries < 0 {
+		return nil, errors.New("apiclient: retries must not be negative")
+	}
+	if c.minBackoff <= 0 || c.maxBackoff < c.minBackoff {
+		return nil, errors.New("apiclient: backoff must be positive, with max at least min")
+	}
+	return c, nil
+}
+
+// request is one API call.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   any
+}
+
+// do makes an API call, retrying it if it fails in a way that may pass on
+// another attempt and it is safe to repeat. The JSON response is decoded
+// into out, if it is not nil, and the response's headers are returned.
+func (c *Client) do(ctx context.Context, req request, out any) (http.Header, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// req.path is already escaped.
+	target, err := url.Parse(c.baseURL.String() + "/" + Version + req.path)
+	if err != nil {
+		return nil, err
+	}
+	target.RawQuery = req.query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, target.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range req.header {
+			httpReq.Header[name] = values
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		httpReq.Header.Set("User-Agent", c.userAgent)
+		if body != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+		if c.apiKey != "" {
+			httpReq.Header.Set("X-API-Key", c.apiKey)
+		}
+		if c.token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		retry := attempt < c.retries && repeatable(httpReq)
+
+		resp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			if !retry || ctx.Err() != nil {
+				return nil, err
+			}
+			if err := sleep(ctx, c.backoff(attempt, 0)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			apiErr := newError(resp, data)
+			if !retry || !retryable(httpReq, resp) {
+				return resp.Header, apiErr
+			}
+			if err := sleep(ctx, c.backoff(attempt, apiErr.RetryAfter)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if out != nil && len(data) > 0 {
+			if err := json.Unmarshal(data, out); err != nil {
+				return resp.Header, fmt.Errorf("apiclient: decoding %s %s: %w", req.method, target.Path, err)
+			}
+		}
+		return resp.Header, nil
+	}
+}
+
+// repeatable reports whether sending req twice has the same effect as
+// sending it once: its method is idempotent, or it has an idempotency key.
+func repeatable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryable reports whether an error response may succeed if the request
+// is sent again.
+func retryable(req *http.Request, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		// The first attempt with this idempotency key is still in progress.
+		return req.Header.Get("Idempotency-Key") != "" && resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// backoff returns how long to wait before retrying after attempt, which
+// counts from zero. The server's Retry-After, if it sent one, wins.
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	wait := c.minBackoff
+	for i := 0; i < attempt && wait < c.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, c.maxBackoff)
+	// Half the wait is fixed and half random, so clients that failed
+	// together don't all retry together.
+	return wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1))
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// newIdempotencyKey returns a random key for a POST, so that retrying it
+// can't apply it twice.
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
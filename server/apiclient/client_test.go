@@ -0,0 +1,64 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer answers each request with the next of statuses, then 200 with
+// body, and records the idempotency keys it was sent.
+func flakyServer(t *testing.T, body string, statuses ...int) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(statuses) > 0 {
+			status := statuses[0]
+			statuses = statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &keys
+}
+
+func TestRetriesUnavailable(t *testing.T) {
+	server, keys := flakyServer(t, `{"vin": "1A", "weight": 100}`, http.StatusServiceUnavailable, http.StatusBadGateway)
+	api, err := New(server.URL, WithBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.AddWeight(context.Background(), "1A", 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(*keys) != 3 || (*keys)[0] == "" || (*keys)[0] != (*keys)[1] || (*keys)[1] != (*keys)[2] {
+		t.Errorf("got idempotency keys %q, want the same key on all three attempts", *keys)
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	server, keys := flakyServer(t, `{}`, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	api, err := New(server.URL, WithRetries(1), WithBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.GetVehicle(context.Background(), "1A", nil); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("got %v, want ErrUnavailable", err)
+	}
+	if len(*keys) != 2 {
+		t.Errorf("got %d attempts, want 2", len(*keys))
+	}
+}
@@ -0,0 +1,205 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageSize is how many clients each page holds when iterating with
+// Clients and no limit is set.
+const DefaultPageSize = 50
+
+// GetOptions narrows down what a GET returns.
+type GetOptions struct {
+	// Strict fails the call with ErrPartial if any field could not be
+	// loaded, instead of returning the resource with warnings.
+	Strict bool
+
+	// Fields, if set, are the only fields returned, such as name or
+	// contact.email. The others are left zero.
+	Fields []string
+
+	// Expand embeds related resources: vehicles or vehicles.weights.
+	Expand []string
+}
+
+// query returns the query parameters for the options.
+func (o *GetOptions) query() url.Values {
+	query := url.Values{}
+	if o == nil {
+		return query
+	}
+	if o.Strict {
+		query.Set("strict", "true")
+	}
+	if len(o.Fields) > 0 {
+		query.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if len(o.Expand) > 0 {
+		query.Set("expand", strings.Join(o.Expand, ","))
+	}
+	return query
+}
+
+// ListOptions pages through the clients.
+type ListOptions struct {
+	GetOptions
+
+	// Limit is the most clients a page holds. Zero asks for every client
+	// in one page.
+	Limit int
+
+	// After starts the page after this client, from the previous page's
+	// Next.
+	After string
+}
+
+// ClientPage is one page of clients, in name order.
+type ClientPage struct {
+	Clients []ClientInfo
+
+	// Next is the After for the following page, or empty if this is the
+	// last.
+	Next string
+}
+
+// ListClients returns one page of clients.
+func (c *Client) ListClients(ctx context.Context, options *ListOptions) (*ClientPage, error) {
+	var query url.Values
+	if options == nil {
+		query = url.Values{}
+	} else {
+		query = options.GetOptions.query()
+		if options.Limit > 0 {
+			query.Set("limit", strconv.Itoa(options.Limit))
+		}
+		if options.After != "" {
+			query.Set("after", options.After)
+		}
+	}
+
+	page := &ClientPage{}
+	header, err := c.do(ctx, request{method: http.MethodGet, path: "/clients", query: query}, &page.Clients)
+	if err != nil {
+		return nil, err
+	}
+	page.Next = nextAfter(header)
+	return page, nil
+}
+
+// nextAfter returns the after parameter of the Link header's next page.
+func nextAfter(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, found := strings.Cut(link, ";")
+			if !found || !strings.Contains(params, `rel="next"`) {
+				continue
+			}
+			parsed, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+			if err != nil {
+				continue
+			}
+			return parsed.Query().Get("after")
+		}
+	}
+	return ""
+}
+
+// ClientIterator steps through every client, a page at a time:
+//
+//	clients := api.Clients(ctx, nil)
+//	for clients.Next() {
+//		client := clients.Client()
+//		...
+//	}
+//	if err := clients.Err(); err != nil {
+//		...
+//	}
+type ClientIterator struct {
+	api     *Client
+	ctx     context.Context
+	options ListOptions
+	page    []ClientInfo
+	current ClientInfo
+	last    bool
+	err     error
+}
+
+// Clients returns an iterator over every client, in name order, starting
+// after options.After if it is set. Pages hold options.Limit clients, or
+// DefaultPageSize.
+func (c *Client) Clients(ctx context.Context, options *ListOptions) *ClientIterator {
+	it := &ClientIterator{api: c, ctx: ctx}
+	if options != nil {
+		it.options = *options
+	}
+	if it.options.Limit == 0 {
+		it.options.Limit = DefaultPageSize
+	}
+	return it
+}
+
+// Next moves to the next client, fetching the next page if needed. It
+// returns false when there are no more clients or a page failed to load.
+func (it *ClientIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.last || it.err != nil {
+			return false
+		}
+
+		page, err := it.api.ListClients(it.ctx, &it.options)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page.Clients
+		it.options.After = page.Next
+		it.last = page.Next == ""
+	}
+
+	it.current = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Client returns the client Next moved to.
+func (it *ClientIterator) Client() ClientInfo {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ClientIterator) Err() error {
+	return it.err
+}
+
+// GetClient returns the client called name.
+func (c *Client) GetClient(ctx context.Context, name string, options *GetOptions) (*ClientInfo, error) {
+	var client ClientInfo
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/clients/" + url.PathEscape(name), query: options.query()}, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// GetClientVehicles returns the vehicles of the client called name.
+func (c *Client) GetClientVehicles(ctx context.Context, name string, options *GetOptions) (*ClientVehicles, error) {
+	var vehicles ClientVehicles
+	path := "/clients/" + url.PathEscape(name) + "/vehicles"
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: path, query: options.query()}, &vehicles); err != nil {
+		return nil, err
+	}
+	return &vehicles, nil
+}
+
+// PutClient creates the client called name, or replaces their contact
+// details.
+func (c *Client) PutClient(ctx context.Context, name string, update ClientUpdate) (*ClientRecord, error) {
+	var record ClientRecord
+	if _, err := c.do(ctx, request{method: http.MethodPut, path: "/clients/" + url.PathEscape(name), body: update}, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
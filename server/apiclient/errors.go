@@ -0,0 +1,115 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors an *Error matches with errors.Is, by its status code.
+var (
+	// ErrInvalid is a request the API refused as malformed: 400 or 422.
+	ErrInvalid = errors.New("invalid request")
+
+	// ErrUnauthorized is an unknown API key or a missing session: 401.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is a caller without the role a route needs: 403.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrNotFound is a client or vehicle that does not exist: 404.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is a request that clashes with another in progress: 409.
+	ErrConflict = errors.New("conflict")
+
+	// ErrPreconditionFailed is a write whose If-Match no longer matches: 412.
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	// ErrRateLimited is a caller that has used up its rate limit: 429.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrPartial is a strict request for a resource some of whose fields
+	// could not be loaded: 502. The fields are in the error's Warnings.
+	ErrPartial = errors.New("partial failure")
+
+	// ErrUnavailable is a server or store that could not answer: other 5xx.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// Error is an error response from the API.
+type Error struct {
+	// StatusCode is the response's HTTP status.
+	StatusCode int
+
+	// Message is the API's explanation, if it sent one.
+	Message string
+
+	// Warnings are the fields that could not be loaded, for ErrPartial.
+	Warnings []Warning
+
+	// RetryAfter is how long the API asked the caller to wait before trying
+	// again, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	status := strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+	if e.Message == "" {
+		return "fleet api: " + status
+	}
+	return fmt.Sprintf("fleet api: %s: %s", status, e.Message)
+}
+
+// Is reports whether target is the sentinel for e's status code.
+func (e *Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return target == ErrInvalid
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusPreconditionFailed:
+		return target == ErrPreconditionFailed
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	case http.StatusBadGateway:
+		return target == ErrPartial
+	}
+	return e.StatusCode >= http.StatusInternalServerError && target == ErrUnavailable
+}
+
+// newError builds the error for an error response with body data.
+func newError(resp *http.Response, data []byte) *Error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+
+	var body struct {
+		Message  string    `json:"message"`
+		Warnings []Warning `json:"warnings"`
+	}
+	if err := json.Unmarshal(data, &body); err == nil {
+		apiErr.Message = body.Message
+		apiErr.Warnings = body.Warnings
+	} else if text := strings.TrimSpace(string(data)); text != "" && len(text) < 200 {
+		apiErr.Message = text
+	}
+
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			apiErr.RetryAfter = time.Until(at)
+		}
+	}
+
+	return apiErr
+}
@@ -0,0 +1,108 @@
+package apiclient
+
+import "time"
+
+// These are the API's v2 request and response bodies. The server checks
+// when it starts that each still has the same JSON shape as its own type.
+
+// Warning names a field of a resource that could not be loaded.
+type Warning struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+// Contact is a client's contact person.
+type Contact struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ClientInfo is a client and the number of vehicles they have.
+type ClientInfo struct {
+	Name         string    `json:"name"`
+	Contact      Contact   `json:"contact"`
+	VehicleCount int       `json:"vehicle_count"`
+	Partial      bool      `json:"partial,omitempty"`
+	Warnings     []Warning `json:"warnings,omitempty"`
+
+	// Vehicles is only set when the vehicles expansion was asked for.
+	Vehicles *[]EmbeddedVehicle `json:"vehicles,omitempty"`
+}
+
+// EmbeddedVehicle is a vehicle embedded in a client by an expansion.
+type EmbeddedVehicle struct {
+	Vin     string `json:"vin"`
+	Mileage int    `json:"mileage"`
+	Weights *[]int `json:"weights,omitempty"`
+}
+
+// ClientVehicles is a client's vehicles.
+type ClientVehicles struct {
+	Client   string          `json:"client"`
+	Vehicles []ClientVehicle `json:"vehicles"`
+	Partial  bool            `json:"partial,omitempty"`
+	Warnings []Warning       `json:"warnings,omitempty"`
+}
+
+// ClientVehicle is one of a client's vehicles.
+type ClientVehicle struct {
+	Vin           string `json:"vin"`
+	Mileage       int    `json:"mileage"`
+	LargestWeight int    `json:"largest_weight"`
+}
+
+// Owner is the client that owns a vehicle.
+type Owner struct {
+	Name    string  `json:"name"`
+	Contact Contact `json:"contact"`
+}
+
+// VehicleInfo is a vehicle with its owner and weights.
+type VehicleInfo struct {
+	Vin      string    `json:"vin"`
+	Mileage  int       `json:"mileage"`
+	Owner    *Owner    `json:"owner"`
+	Weights  []int     `json:"weights"`
+	Partial  bool      `json:"partial,omitempty"`
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// ClientUpdate is the body sent to create or replace a client.
+type ClientUpdate struct {
+	ContactName  string `json:"contact_name"`
+	ContactEmail string `json:"contact_email"`
+}
+
+// ClientRecord is a client as it is stored.
+type ClientRecord struct {
+	Name         string `json:"name"`
+	ContactName  string `json:"contact_name"`
+	ContactEmail string `json:"contact_email"`
+}
+
+// VehicleUpdate is the body sent to create or replace a vehicle.
+type VehicleUpdate struct {
+	Client  string `json:"client"`
+	Mileage int    `json:"mileage"`
+}
+
+// VehicleRecord is a vehicle as it is stored.
+type VehicleRecord struct {
+	Vin     string `json:"vin"`
+	Client  string `json:"client"`
+	Mileage int    `json:"mileage"`
+}
+
+// NewWeightReading is the body sent to add a weight reading.
+type NewWeightReading struct {
+	Weight *float32 `json:"weight"`
+}
+
+// WeightReading is a weight reading for a vehicle.
+type WeightReading struct {
+	Vin    string    `json:"vin"`
+	Client string    `json:"client,omitempty"`
+	Weight float32   `json:"weight"`
+	Time   time.Time `json:"time"`
+}
@@ -0,0 +1,48 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// GetVehicle returns the vehicle with the given VIN.
+func (c *Client) GetVehicle(ctx context.Context, vin string, options *GetOptions) (*VehicleInfo, error) {
+	var vehicle VehicleInfo
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/vehicles/" + url.PathEscape(vin), query: options.query()}, &vehicle); err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+// PutVehicle creates the vehicle with the given VIN, or replaces its
+// details. The client it is assigned to must exist.
+func (c *Client) PutVehicle(ctx context.Context, vin string, update VehicleUpdate) (*VehicleRecord, error) {
+	var record VehicleRecord
+	if _, err := c.do(ctx, request{method: http.MethodPut, path: "/vehicles/" + url.PathEscape(vin), body: update}, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// AddWeight records a weight reading for the vehicle with the given VIN.
+// The call is sent with a fresh idempotency key, so retrying it can't add
+// the reading twice.
+func (c *Client) AddWeight(ctx context.Context, vin string, weight float32) (*WeightReading, error) {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var reading WeightReading
+	_, err = c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/vehicles/" + url.PathEscape(vin) + "/weights",
+		header: http.Header{"Idempotency-Key": {key}},
+		body:   NewWeightReading{Weight: &weight},
+	}, &reading)
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/byron-ojua/starter-project/apiclient"
+	"github.com/byron-ojua/starter-project/config"
+)
+
+// newAPIClient serves the full router over store, with OpenAPI validation on,
+// and returns a client for it with options.
+func newAPIClient(t *testing.T, store *fakeStore, options ...apiclient.Option) *apiclient.Client {
+	t.Helper()
+	server := newTestServer(t, store, func(settings *config.Config) {
+		settings.OpenAPI.Validate = true
+	})
+	httpServer := httptest.NewServer(server.handler)
+	t.Cleanup(httpServer.Close)
+
+	options = append([]apiclient.Option{apiclient.WithBackoff(time.Millisecond, time.Millisecond)}, options...)
+	api, err := apiclient.New(httpServer.URL, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func TestAPIClientReads(t *testing.T) {
+	api := newAPIClient(t, newFakeStore())
+	ctx := context.Background()
+
+	var names []string
+	clients := api.Clients(ctx, &apiclient.ListOptions{Limit: 1})
+	for clients.Next() {
+		names = append(names, clients.Client().Name)
+	}
+	if err := clients.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "CIA" || names[1] != "FBI" {
+		t.Errorf("got clients %v, want [CIA FBI]", names)
+	}
+
+	client, err := api.GetClient(ctx, "CIA", &apiclient.GetOptions{Expand: []string{"vehicles"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Contact.Email != "jane@cia.gov" || client.VehicleCount != 2 || client.Vehicles == nil || len(*client.Vehicles) != 2 {
+		t.Errorf("got client %+v, want CIA with two embedded vehicles", client)
+	}
+
+	trimmed, err := api.GetClient(ctx, "CIA", &apiclient.GetOptions{Fields: []string{"name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trimmed.Name != "CIA" || trimmed.Contact.Email != "" {
+		t.Errorf("got client %+v, want only the name", trimmed)
+	}
+
+	vehicles, err := api.GetClientVehicles(ctx, "CIA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vehicles.Vehicles) != 2 || vehicles.Vehicles[0].Vin != "1A" || vehicles.Vehicles[0].LargestWeight != 12000 {
+		t.Errorf("got vehicles %+v, want 1A at 12000 first", vehicles.Vehicles)
+	}
+
+	vehicle, err := api.GetVehicle(ctx, "1A", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vehicle.Mileage != 1200 || vehicle.Owner == nil || vehicle.Owner.Name != "CIA" || len(vehicle.Weights) != 2 {
+		t.Errorf("got vehicle %+v, want 1A owned by CIA with two weights", vehicle)
+	}
+
+	if _, err := api.GetVehicle(ctx, "9Z", nil); !errors.Is(err, apiclient.ErrNotFound) {
+		t.Errorf("got %v for a missing vehicle, want ErrNotFound", err)
+	}
+}
+
+func TestAPIClientPartial(t *testing.T) {
+	store := newFakeStore()
+	store.broken["1B"] = true
+	api := newAPIClient(t, store)
+	ctx := context.Background()
+
+	vehicles, err := api.GetClientVehicles(ctx, "CIA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vehicles.Partial || len(vehicles.Warnings) == 0 {
+		t.Errorf("got %+v, want a partial response with warnings", vehicles)
+	}
+
+	_, err = api.GetClientVehicles(ctx, "CIA", &apiclient.GetOptions{Strict: true})
+	var apiErr *apiclient.Error
+	if !errors.Is(err, apiclient.ErrPartial) || !errors.As(err, &apiErr) || len(apiErr.Warnings) == 0 {
+		t.Errorf("got %v with strict, want ErrPartial with warnings", err)
+	}
+}
+
+func TestAPIClientWrites(t *testing.T) {
+	store := newFakeStore()
+	api := newAPIClient(t, store, apiclient.WithAPIKey(testAPIKey))
+	ctx := context.Background()
+
+	record, err := api.PutClient(ctx, "NSA", apiclient.ClientUpdate{ContactName: "Ann", ContactEmail: "ann@nsa.gov"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Name != "NSA" || record.ContactEmail != "ann@nsa.gov" {
+		t.Errorf("got client record %+v", record)
+	}
+
+	vehicle, err := api.PutVehicle(ctx, "2A", apiclient.VehicleUpdate{Client: "NSA", Mileage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vehicle.Vin != "2A" || vehicle.Client != "NSA" || vehicle.Mileage != 10 {
+		t.Errorf("got vehicle record %+v", vehicle)
+	}
+
+	if _, err := api.PutVehicle(ctx, "2B", apiclient.VehicleUpdate{Client: "KGB"}); !errors.Is(err, apiclient.ErrInvalid) {
+		t.Errorf("got %v for an unknown client, want ErrInvalid", err)
+	}
+
+	reading, err := api.AddWeight(ctx, "2A", 1250.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reading.Vin != "2A" || reading.Weight != 1250.5 {
+		t.Errorf("got reading %+v", reading)
+	}
+	if weights := store.weights["2A"]; len(weights) != 1 {
+		t.Errorf("the store holds %d readings for 2A, want 1", len(weights))
+	}
+
+	if _, err := api.AddWeight(ctx, "9Z", 100); !errors.Is(err, apiclient.ErrNotFound) {
+		t.Errorf("got %v for a missing vehicle, want ErrNotFound", err)
+	}
+
+	anonymous := newAPIClient(t, store)
+	if _, err := anonymous.PutClient(ctx, "NSA", apiclient.ClientUpdate{ContactName: "Eve", ContactEmail: "eve@nsa.gov"}); !errors.Is(err, apiclient.ErrUnauthorized) {
+		t.Errorf("got %v without an API key, want ErrUnauthorized", err)
+	}
+}
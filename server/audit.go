@@ -0,0 +1,225 @@
+/*
+* @file audit.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the middleware that records every API call in the audit
+* log and the admin handlers used to query it.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byron-ojua/starter-project/audit"
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// auditMiddleware records the actor, action, resource, source IP and outcome
+// of every API call once it has been handled.
+func auditMiddleware(log *audit.Log, limiter *ratelimit.Limiter, sessions *auth.SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The docs UI and the frontend are not fleet data, so their assets
+		// are not audited.
+		if strings.HasPrefix(c.Request.URL.Path, "/swagger/") || isFrontendPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		action := c.FullPath()
+		if action == "" {
+			action = c.Request.URL.Path
+		}
+
+		_, err := log.Append(audit.Entry{
+			Actor:    actorName(c, limiter, sessions),
+			Action:   c.Request.Method + " " + action,
+			Resource: auditResource(c),
+			SourceIP: c.ClientIP(),
+			Outcome:  auditOutcome(c.Writer.Status()),
+			Status:   c.Writer.Status(),
+		})
+		if err != nil {
+			slog.Error("writing the audit log failed", "err", err)
+		}
+	}
+}
+
+// actorName returns the subject of the user a protected route let in. A
+// public route lets anyone in, so its caller is found the way
+// rateLimitCaller finds it: by a known API key, then by the session. A
+// caller with neither is "anonymous".
+func actorName(c *gin.Context, limiter *ratelimit.Limiter, sessions *auth.SessionStore) string {
+	if subject, found := userSubject(c); found {
+		return subject
+	}
+
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		if _, found := limiter.KeyPlan(key); found {
+			return apiKeyName(key)
+		}
+		return "anonymous"
+	}
+	if session, found := sessions.Get(sessionID(c)); found {
+		return session.User.Subject
+	}
+	return "anonymous"
+}
+
+// userSubject returns the subject of the user a protected route let in.
+func userSubject(c *gin.Context) (string, bool) {
+	if value, found := c.Get("user"); found {
+		if user, ok := value.(auth.User); ok {
+			return user.Subject, true
+		}
+	}
+	return "", false
+}
+
+// auditResource names the client or vehicle a route refers to.
+func auditResource(c *gin.Context) string {
+	id := c.Param("id")
+	if id == "" {
+		return ""
+	}
+
+	path := c.FullPath()
+	if version, found := c.Get(apiVersionKey); found {
+		path = strings.TrimPrefix(path, "/"+version.(*apiVersion).Name)
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/clients"):
+		return "client:" + id
+	case strings.HasPrefix(path, "/vehicles"):
+		return "vin:" + id
+	}
+	return id
+}
+
+// auditOutcome classifies a response status.
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return audit.OutcomeDenied
+	case status >= 400:
+		return audit.OutcomeFailure
+	}
+	return audit.OutcomeSuccess
+}
+
+// listAudit responds with the audit entries matching the actor, action,
+// resource, outcome, since, until and limit query parameters. With
+// format=ndjson, or an Accept header asking for application/x-ndjson, the
+// entries are exported one per line.
+// @Summary Query the audit log
+// @Description List audit entries, oldest first, optionally exported as NDJSON
+// @Tags admin
+// @Produce json,application/x-ndjson
+// @Param actor query string false "Only entries by this actor"
+// @Param action query string false "Only entries for this action, such as GET /clients/:id"
+// @Param resource query string false "Only entries about this resource, such as client:CIA or vin:123"
+// @Param outcome query string false "Only entries with this outcome: success, denied or failure"
+// @Param since query string false "Only entries at or after this RFC 3339 time"
+// @Param until query string false "Only entries before this RFC 3339 time"
+// @Param limit query int false "Return at most this many entries, the newest"
+// @Param format query string false "ndjson to export one entry per line"
+// @Success 200 {array} audit.Entry
+// @Failure 400 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/audit [get]
+func listAudit(log *audit.Log) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := audit.Filter{
+			Actor:    c.Query("actor"),
+			Action:   c.Query("action"),
+			Resource: c.Query("resource"),
+			Outcome:  c.Query("outcome"),
+		}
+
+		var err error
+		if since := c.Query("since"); since != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "since must be an RFC 3339 time"})
+				return
+			}
+		}
+		if until := c.Query("until"); until != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "until must be an RFC 3339 time"})
+				return
+			}
+		}
+		if limit := c.Query("limit"); limit != "" {
+			if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "limit must be a positive number"})
+				return
+			}
+		}
+
+		if c.Query("format") == "ndjson" || strings.Contains(c.GetHeader("Accept"), "application/x-ndjson") {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Content-Disposition", `attachment; filename="audit.ndjson"`)
+			c.Status(http.StatusOK)
+
+			// Without a limit the export is streamed, so the whole log is
+			// never held in memory.
+			if filter.Limit == 0 {
+				encoder := json.NewEncoder(c.Writer)
+				err = log.Scan(filter, func(entry audit.Entry) error {
+					return encoder.Encode(entry)
+				})
+			} else {
+				var entries []audit.Entry
+				if entries, err = log.Query(filter); err == nil {
+					err = audit.WriteNDJSON(c.Writer, entries)
+				}
+			}
+			if err != nil {
+				slog.Error("exporting the audit log failed", "err", err)
+			}
+			return
+		}
+
+		entries, err := log.Query(filter)
+		if err != nil {
+			slog.Error("reading the audit log failed", "err", err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error reading the audit log"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, entries)
+	}
+}
+
+// verifyAudit checks the audit log's hash chain for tampering.
+// @Summary Verify the audit log
+// @Description Check the audit log's hash chain for entries that were changed or removed
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/audit/verify [get]
+func verifyAudit(log *audit.Log) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := log.Verify(); err != nil {
+			c.IndentedJSON(http.StatusConflict, gin.H{"valid": false, "message": err.Error()})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, gin.H{"valid": true})
+	}
+}
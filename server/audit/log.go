@@ -0,0 +1,319 @@
+// Package audit keeps an append-only, hash-chained record of who read or
+// changed fleet data.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Outcomes recorded for an entry.
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+// Entry is a single audited action. Hash covers every other field, including
+// PrevHash, so changing or removing an entry breaks the chain after it.
+type Entry struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	Resource string    `json:"resource,omitempty"`
+	SourceIP string    `json:"source_ip,omitempty"`
+	Outcome  string    `json:"outcome"`
+	Status   int       `json:"status,omitempty"`
+	PrevHash string    `json:"prev_hash"`
+	Hash     string    `json:"hash"`
+}
+
+// Filter selects entries from the log. Zero fields match everything.
+type Filter struct {
+	Actor    string
+	Action   string
+	Resource string
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// MemoryLimit is the number of recent entries a log without a file keeps.
+// Older ones are dropped, so it can only be verified from the oldest it has.
+const MemoryLimit = 10000
+
+// Log is an append-only audit log. A log opened on a file only remembers the
+// last entry's sequence number and hash, and reads the file again to answer
+// queries; one without a file keeps the last MemoryLimit entries in memory.
+type Log struct {
+	mu      sync.Mutex
+	path    string
+	out     *os.File
+	size    int64
+	seq     uint64
+	last    string
+	entries []Entry
+	now     func() time.Time
+}
+
+// NewLog returns an empty in-memory log.
+func NewLog() *Log {
+	return &Log{now: time.Now}
+}
+
+// Open returns a log backed by the NDJSON file at path. Existing entries are
+// verified as they are read so the chain continues where it left off.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	var links chain
+	if err := readEntries(file, links.next); err != nil {
+		file.Close()
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	log := NewLog()
+	log.path = path
+	log.out = file
+	log.size = info.Size()
+	log.seq, log.last = links.seq, links.last
+	return log, nil
+}
+
+// Append adds an entry, filling in its sequence number, time and hashes, and
+// returns the stored entry.
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.seq + 1
+	if entry.Time.IsZero() {
+		entry.Time = l.now()
+	}
+	entry.Time = entry.Time.UTC()
+	entry.PrevHash = l.last
+	entry.Hash = hash(entry)
+
+	if l.path != "" {
+		if l.out == nil {
+			return entry, errors.New("writing audit log: log is closed")
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return entry, err
+		}
+		n, err := l.out.Write(append(line, '\n'))
+		l.size += int64(n)
+		if err != nil {
+			return entry, fmt.Errorf("writing audit log: %w", err)
+		}
+	} else {
+		// Dropping the oldest half at once, into a new array, keeps appends
+		// cheap and leaves the entries a reader is walking untouched.
+		if len(l.entries) >= 2*MemoryLimit {
+			l.entries = append([]Entry(nil), l.entries[len(l.entries)-MemoryLimit:]...)
+		}
+		l.entries = append(l.entries, entry)
+	}
+
+	l.seq, l.last = entry.Seq, entry.Hash
+	return entry, nil
+}
+
+// Query returns the entries matching filter, oldest first. When Limit is set
+// only the most recent matching entries are returned.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	results := []Entry{}
+	var oldest int
+	err := l.Scan(filter, func(entry Entry) error {
+		// Past the limit, each match replaces the oldest one kept.
+		if filter.Limit > 0 && len(results) == filter.Limit {
+			results[oldest] = entry
+			oldest = (oldest + 1) % filter.Limit
+			return nil
+		}
+		results = append(results, entry)
+		return nil
+	})
+	return append(results[oldest:], results[:oldest]...), err
+}
+
+// Scan calls fn with each entry matching filter, oldest first, ignoring its
+// Limit, and stops at the first error fn returns. Entries appended while it
+// runs are not included.
+func (l *Log) Scan(filter Filter, fn func(Entry) error) error {
+	return l.snapshot().each(func(entry Entry) error {
+		if !filter.matches(entry) {
+			return nil
+		}
+		return fn(entry)
+	})
+}
+
+// Verify walks the chain and reports the first entry that has been altered,
+// removed or reordered.
+func (l *Log) Verify() error {
+	view := l.snapshot()
+	var links chain
+	if len(view.entries) > 0 {
+		links = chain{seq: view.entries[0].Seq - 1, last: view.entries[0].PrevHash}
+	}
+
+	if err := view.each(links.next); err != nil {
+		return err
+	}
+	if links.seq != view.seq || links.last != view.last {
+		return fmt.Errorf("audit entry %d: missing", links.seq+1)
+	}
+	return nil
+}
+
+// view is the part of a log written when it was taken.
+type view struct {
+	path    string
+	size    int64
+	entries []Entry
+	seq     uint64
+	last    string
+}
+
+func (l *Log) snapshot() view {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return view{path: l.path, size: l.size, entries: l.entries, seq: l.seq, last: l.last}
+}
+
+// each calls fn with every entry in the view, oldest first.
+func (v view) each(fn func(Entry) error) error {
+	if v.path == "" {
+		for _, entry := range v.entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Only the entries written so far are read, so a line being appended
+	// is never seen half written.
+	file, err := os.Open(v.path)
+	if err != nil {
+		return fmt.Errorf("reading audit log: %w", err)
+	}
+	defer file.Close()
+	return readEntries(io.LimitReader(file, v.size), fn)
+}
+
+// Close closes the backing file, if any.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.out == nil {
+		return nil
+	}
+	err := l.out.Close()
+	l.out = nil
+	return err
+}
+
+// WriteNDJSON writes entries to w, one JSON object per line.
+func WriteNDJSON(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f Filter) matches(entry Entry) bool {
+	switch {
+	case f.Actor != "" && entry.Actor != f.Actor:
+		return false
+	case f.Action != "" && entry.Action != f.Action:
+		return false
+	case f.Resource != "" && entry.Resource != f.Resource:
+		return false
+	case f.Outcome != "" && entry.Outcome != f.Outcome:
+		return false
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && entry.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// chain checks that entries follow on from the last one it was given.
+type chain struct {
+	seq  uint64
+	last string
+}
+
+func (c *chain) next(entry Entry) error {
+	if entry.Seq != c.seq+1 {
+		return fmt.Errorf("audit entry %d: unexpected sequence number %d", c.seq+1, entry.Seq)
+	}
+	if entry.PrevHash != c.last {
+		return fmt.Errorf("audit entry %d: previous hash does not match", entry.Seq)
+	}
+	if entry.Hash != hash(entry) {
+		return fmt.Errorf("audit entry %d: hash does not match contents", entry.Seq)
+	}
+	c.seq, c.last = entry.Seq, entry.Hash
+	return nil
+}
+
+// readEntries decodes the NDJSON entries in r, calling fn with each.
+func readEntries(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("reading audit log: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading audit log: %w", err)
+	}
+	return nil
+}
+
+// hash returns the SHA-256 of entry with its Hash field cleared.
+func hash(entry Entry) string {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// Entry only holds strings, numbers and a time, which always marshal.
+		panic("audit: unable to marshal entry: " + err.Error())
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
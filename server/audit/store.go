@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/database"
+)
+
+// Store is a database.Store that records every write in log, whether it
+// succeeds or not, as the user in the write's context. Reads, Ping and Close
+// go straight to the wrapped store.
+type Store struct {
+	database.Store
+	log *Log
+}
+
+// NewStore wraps store so its writes are audited in log.
+func NewStore(store database.Store, log *Log) *Store {
+	return &Store{Store: store, log: log}
+}
+
+// SaveClient creates or replaces a client
+func (s *Store) SaveClient(ctx context.Context, client database.Client) error {
+	err := s.Store.SaveClient(ctx, client)
+	s.record(ctx, "STORE SaveClient", "client:"+client.Name, err)
+	return err
+}
+
+// SaveVehicle creates or replaces a vehicle
+func (s *Store) SaveVehicle(ctx context.Context, vehicle database.Vehicle) (*database.Vehicle, error) {
+	previous, err := s.Store.SaveVehicle(ctx, vehicle)
+	s.record(ctx, "STORE SaveVehicle", "vin:"+vehicle.Vin, err)
+	return previous, err
+}
+
+// AddWeight records a new weight reading for a vehicle
+func (s *Store) AddWeight(ctx context.Context, weight database.Weight) error {
+	err := s.Store.AddWeight(ctx, weight)
+	s.record(ctx, "STORE AddWeight", "vin:"+weight.Vin, err)
+	return err
+}
+
+// record appends an entry for a write. A write without a user in its context
+// is recorded as anonymous.
+func (s *Store) record(ctx context.Context, action, resource string, err error) {
+	entry := Entry{Actor: "anonymous", Action: action, Resource: resource, Outcome: OutcomeSuccess}
+	if user, ok := auth.UserFrom(ctx); ok {
+		entry.Actor = user.Subject
+	}
+	if err != nil {
+		entry.Outcome = OutcomeFailure
+	}
+
+	if _, appendErr := s.log.Append(entry); appendErr != nil {
+		slog.Error("writing the audit log failed", "err", appendErr)
+	}
+}
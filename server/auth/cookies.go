@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CookieConfig holds the attributes applied to every cookie the server sets.
+type CookieConfig struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+	MaxAge   int
+}
+
+// ParseSameSite converts "lax", "strict" or "none" to an http.SameSite value.
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return http.SameSiteDefaultMode, fmt.Errorf("invalid SameSite value %q", value)
+}
+
+// Cookie returns a cookie carrying name and value with the configured attributes.
+func (config CookieConfig) Cookie(name, value string, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   config.Domain,
+		MaxAge:   config.MaxAge,
+		Secure:   config.Secure,
+		HttpOnly: httpOnly,
+		SameSite: config.SameSite,
+	}
+}
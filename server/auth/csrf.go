@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// Names used to carry the CSRF token. The token is stored in a cookie and
+// must be echoed back in a form field or header on state-changing requests.
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFFieldName  = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// NewCSRFToken returns a random, URL-safe CSRF token.
+func NewCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CSRFTokensMatch reports whether the token submitted with a request matches
+// the one from its cookie, in constant time.
+func CSRFTokensMatch(cookie, submitted string) bool {
+	if cookie == "" || submitted == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(submitted)) == 1
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default settings used by NewLoginGuard.
+const (
+	DefaultMaxFailures     = 5
+	DefaultBaseDelay       = time.Second
+	DefaultMaxDelay        = time.Minute
+	DefaultLockoutDuration = 15 * time.Minute
+)
+
+// guardSweepInterval is how often a LoginGuard drops keys it no longer needs.
+const guardSweepInterval = time.Minute
+
+// LoginGuard tracks failed login attempts per source IP and per account. Each
+// failure doubles the delay before the next attempt is accepted, and once
+// MaxFailures is reached the key is locked out for LockoutDuration. A key's
+// failures are forgotten once its lockout ends, or LockoutDuration after its
+// last failure if it was never locked out.
+type LoginGuard struct {
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]*attempt
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Lockout describes a key that is currently blocked from logging in.
+type Lockout struct {
+	Key       string    `json:"key"`
+	Failures  int       `json:"failures"`
+	Until     time.Time `json:"until"`
+	Remaining string    `json:"remaining"`
+}
+
+type attempt struct {
+	failures    int
+	lastFailure time.Time
+	nextAllowed time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginGuard returns a LoginGuard using the default limits.
+func NewLoginGuard() *LoginGuard {
+	return &LoginGuard{
+		MaxFailures:     DefaultMaxFailures,
+		BaseDelay:       DefaultBaseDelay,
+		MaxDelay:        DefaultMaxDelay,
+		LockoutDuration: DefaultLockoutDuration,
+		attempts:        make(map[string]*attempt),
+		now:             time.Now,
+	}
+}
+
+// IPKey returns the key used to track attempts from an IP address.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// AccountKey returns the key used to track attempts against an account.
+func AccountKey(account string) string {
+	return "account:" + strings.ToLower(account)
+}
+
+// Check returns how long the caller must wait before another attempt from ip
+// against account is accepted, and whether that wait is a full lockout. A zero
+// duration means the attempt may proceed.
+func (g *LoginGuard) Check(ip, account string) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	var wait time.Duration
+	var locked bool
+
+	for _, key := range keys(ip, account) {
+		a, found := g.attempts[key]
+		if !found || g.expired(a, now) {
+			continue
+		}
+
+		if a.lockedUntil.After(now) {
+			locked = true
+			if d := a.lockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+			continue
+		}
+
+		if d := a.nextAllowed.Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	return wait, locked
+}
+
+// Fail records a failed attempt from ip against account.
+func (g *LoginGuard) Fail(ip, account string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+
+	for _, key := range keys(ip, account) {
+		a, found := g.attempts[key]
+		if !found {
+			a = &attempt{}
+			g.attempts[key] = a
+		}
+
+		// Failures that have been forgotten start the count again.
+		if g.expired(a, now) {
+			*a = attempt{}
+		}
+
+		a.failures++
+		a.lastFailure = now
+		a.nextAllowed = now.Add(g.backoff(a.failures))
+		if a.failures >= g.MaxFailures {
+			a.lockedUntil = now.Add(g.LockoutDuration)
+		}
+	}
+}
+
+// Succeed clears the failure history for ip and account.
+func (g *LoginGuard) Succeed(ip, account string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys(ip, account) {
+		delete(g.attempts, key)
+	}
+}
+
+// Unlock clears the failure history for a key returned by IPKey or
+// AccountKey. It reports whether the key was being tracked.
+func (g *LoginGuard) Unlock(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	_, found := g.attempts[key]
+	delete(g.attempts, key)
+	return found
+}
+
+// Lockouts returns every key that is currently locked out, sorted by key.
+func (g *LoginGuard) Lockouts() []Lockout {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	results := []Lockout{}
+	for key, a := range g.attempts {
+		if !a.lockedUntil.After(now) {
+			continue
+		}
+		results = append(results, Lockout{
+			Key:       key,
+			Failures:  a.failures,
+			Until:     a.lockedUntil,
+			Remaining: a.lockedUntil.Sub(now).Round(time.Second).String(),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results
+}
+
+// expired reports whether a's failures are forgotten by now: its lockout has
+// run out, or it was never locked out and its last failure is LockoutDuration
+// old.
+func (g *LoginGuard) expired(a *attempt, now time.Time) bool {
+	if !a.lockedUntil.IsZero() {
+		return !a.lockedUntil.After(now)
+	}
+	return !a.lastFailure.Add(g.LockoutDuration).After(now)
+}
+
+// sweep drops expired keys, so usernames that were tried once and never
+// again are not kept for good. The caller must hold g.mu.
+func (g *LoginGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < guardSweepInterval {
+		return
+	}
+	g.lastSweep = now
+
+	for key, a := range g.attempts {
+		if g.expired(a, now) {
+			delete(g.attempts, key)
+		}
+	}
+}
+
+// backoff returns the delay enforced after the given number of failures.
+func (g *LoginGuard) backoff(failures int) time.Duration {
+	delay := g.BaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= g.MaxDelay {
+			return g.MaxDelay
+		}
+	}
+	return delay
+}
+
+func keys(ip, account string) []string {
+	results := []string{IPKey(ip)}
+	if account != "" {
+		results = append(results, AccountKey(account))
+	}
+	return results
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestGuard returns a LoginGuard with the default limits and a clock that
+// only moves when the returned function is called.
+func newTestGuard() (*LoginGuard, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard := NewLoginGuard()
+	guard.now = func() time.Time { return now }
+	return guard, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLoginGuardBacksOffThenLocksOut(t *testing.T) {
+	guard, advance := newTestGuard()
+
+	for i := 1; i < guard.MaxFailures; i++ {
+		guard.Fail("10.0.0.1", "admin")
+		wait, locked := guard.Check("10.0.0.1", "admin")
+		if want := guard.backoff(i); wait != want || locked {
+			t.Fatalf("after %d failures: got wait %v, locked %v; want %v, not locked", i, wait, locked, want)
+		}
+		advance(wait)
+	}
+
+	guard.Fail("10.0.0.1", "admin")
+	wait, locked := guard.Check("10.0.0.1", "admin")
+	if wait != guard.LockoutDuration || !locked {
+		t.Fatalf("got wait %v, locked %v; want a %v lockout", wait, locked, guard.LockoutDuration)
+	}
+	if lockouts := guard.Lockouts(); len(lockouts) != 2 || lockouts[0].Key != AccountKey("admin") || lockouts[1].Key != IPKey("10.0.0.1") {
+		t.Errorf("got lockouts %+v, want the account and the IP", lockouts)
+	}
+
+	advance(guard.LockoutDuration)
+	if wait, locked := guard.Check("10.0.0.1", "admin"); wait != 0 || locked {
+		t.Errorf("got wait %v, locked %v after the lockout; want none", wait, locked)
+	}
+
+	// The count starts again once the lockout is over.
+	guard.Fail("10.0.0.1", "admin")
+	if wait, locked := guard.Check("10.0.0.1", "admin"); wait != guard.BaseDelay || locked {
+		t.Errorf("got wait %v, locked %v; want the first backoff again", wait, locked)
+	}
+}
+
+func TestLoginGuardKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		fail     func(*LoginGuard, int)
+		ip       string
+		account  string
+		isLocked bool
+	}{
+		{
+			name:     "one account from many addresses locks the account",
+			fail:     func(g *LoginGuard, i int) { g.Fail(fmt.Sprintf("10.0.0.%d", i), "Admin") },
+			ip:       "10.0.1.1",
+			account:  "admin",
+			isLocked: true,
+		},
+		{
+			name:     "many accounts from one address locks the address",
+			fail:     func(g *LoginGuard, i int) { g.Fail("10.0.0.1", fmt.Sprintf("user%d", i)) },
+			ip:       "10.0.0.1",
+			account:  "someone",
+			isLocked: true,
+		},
+		{
+			name:    "another account from another address is not locked",
+			fail:    func(g *LoginGuard, i int) { g.Fail("10.0.0.1", "admin") },
+			ip:      "10.0.0.2",
+			account: "someone",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guard, _ := newTestGuard()
+			for i := 0; i < guard.MaxFailures; i++ {
+				test.fail(guard, i)
+			}
+			if _, locked := guard.Check(test.ip, test.account); locked != test.isLocked {
+				t.Errorf("got locked %v, want %v", locked, test.isLocked)
+			}
+		})
+	}
+}
+
+func TestLoginGuardForgetsOldFailures(t *testing.T) {
+	guard, advance := newTestGuard()
+
+	guard.Fail("10.0.0.1", "admin")
+	guard.Fail("10.0.0.1", "admin")
+	advance(guard.LockoutDuration)
+
+	guard.Fail("10.0.0.1", "admin")
+	if wait, _ := guard.Check("10.0.0.1", "admin"); wait != guard.BaseDelay {
+		t.Errorf("got wait %v, want the first backoff once earlier failures are forgotten", wait)
+	}
+}
+
+func TestLoginGuardDropsExpiredKeys(t *testing.T) {
+	guard, advance := newTestGuard()
+
+	for i := 0; i < 100; i++ {
+		guard.Fail("10.0.0.1", fmt.Sprintf("user%d", i))
+	}
+	for i := 0; i < guard.MaxFailures; i++ {
+		guard.Fail("10.0.0.2", "admin")
+	}
+	if len(guard.attempts) != 103 {
+		t.Fatalf("tracking %d keys, want 103", len(guard.attempts))
+	}
+
+	// After the lockout every key has expired, and the next failure sweeps
+	// them away.
+	advance(guard.LockoutDuration)
+	guard.Fail("10.0.0.3", "")
+	if len(guard.attempts) != 1 {
+		t.Errorf("tracking %d keys after they expired, want 1", len(guard.attempts))
+	}
+}
+
+func TestLoginGuardSucceedAndUnlock(t *testing.T) {
+	guard, _ := newTestGuard()
+
+	for i := 0; i < guard.MaxFailures; i++ {
+		guard.Fail("10.0.0.1", "admin")
+	}
+	if !guard.Unlock(AccountKey("ADMIN")) || guard.Unlock(AccountKey("nobody")) {
+		t.Error("Unlock should report only keys being tracked")
+	}
+	if _, locked := guard.Check("10.0.0.2", "admin"); locked {
+		t.Error("the account is still locked after Unlock")
+	}
+
+	guard.Succeed("10.0.0.1", "admin")
+	if wait, locked := guard.Check("10.0.0.1", "admin"); wait != 0 || locked {
+		t.Errorf("got wait %v, locked %v after a success; want none", wait, locked)
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Roles understood by the server.
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+// RoleMapper maps identity provider groups to local roles.
+type RoleMapper struct {
+	GroupRoles   map[string][]string
+	DefaultRoles []string
+}
+
+// ParseRoleMap parses a mapping of the form "group=role,role;group=role".
+func ParseRoleMap(value string) (map[string][]string, error) {
+	results := make(map[string][]string)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		group, roles, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(group) == "" {
+			return nil, fmt.Errorf("invalid role mapping %q", entry)
+		}
+
+		for _, role := range strings.Split(roles, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				results[strings.TrimSpace(group)] = append(results[strings.TrimSpace(group)], role)
+			}
+		}
+	}
+	return results, nil
+}
+
+// Roles returns the roles granted to a member of groups, including the
+// default roles, sorted and without duplicates.
+func (m RoleMapper) Roles(groups []string) []string {
+	set := make(map[string]bool)
+	for _, role := range m.DefaultRoles {
+		set[role] = true
+	}
+	for _, group := range groups {
+		for _, role := range m.GroupRoles[group] {
+			set[role] = true
+		}
+	}
+
+	results := make([]string, 0, len(set))
+	for role := range set {
+		results = append(results, role)
+	}
+	sort.Strings(results)
+	return results
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// Session kinds, recording how the user logged in.
+const (
+	SessionPassword = "password"
+	SessionOIDC     = "oidc"
+)
+
+// SessionCookieName is the cookie holding the session ID.
+const SessionCookieName = "session"
+
+// User is the identity attached to a session.
+type User struct {
+	Subject string   `json:"subject"`
+	Email   string   `json:"email,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Roles   []string `json:"roles"`
+}
+
+// HasRole reports whether the user has been granted role.
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// userKey is the context key of the user a request was authenticated as.
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying user, so code the request reaches
+// through the store can tell who made it.
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the user stored in ctx by WithUser.
+func UserFrom(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey{}).(User)
+	return user, ok
+}
+
+// Session is a logged in user.
+type Session struct {
+	ID      string    `json:"-"`
+	Kind    string    `json:"kind"`
+	User    User      `json:"user"`
+	Expires time.Time `json:"expires"`
+}
+
+// SessionStore keeps sessions in memory, keyed by a random session ID.
+type SessionStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewSessionStore returns a store whose sessions expire after ttl.
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		ttl:      ttl,
+		now:      time.Now,
+		sessions: make(map[string]Session),
+	}
+}
+
+// Create starts a new session for user.
+func (s *SessionStore) Create(kind string, user User) (Session, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return Session{}, err
+	}
+
+	session := Session{
+		ID:      base64.RawURLEncoding.EncodeToString(buf),
+		Kind:    kind,
+		User:    user,
+		Expires: s.now().Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired()
+	s.sessions[session.ID] = session
+	return session, nil
+}
+
+// Get returns the session with the given ID if it exists and has not expired.
+func (s *SessionStore) Get(id string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, found := s.sessions[id]
+	if !found {
+		return Session{}, false
+	}
+	if !session.Expires.After(s.now()) {
+		delete(s.sessions, id)
+		return Session{}, false
+	}
+	return session, true
+}
+
+// Delete ends the session with the given ID.
+func (s *SessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+}
+
+// removeExpired drops every expired session. The caller must hold s.mu.
+func (s *SessionStore) removeExpired() {
+	now := s.now()
+	for id, session := range s.sessions {
+		if !session.Expires.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+/*
+* @file batch.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the batch endpoint, which runs several API calls in one
+* round-trip by passing each of them through the router as the caller.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BatchRequest is the body accepted by POST /batch.
+type BatchRequest struct {
+	// Sequential runs the requests one at a time, in order, instead of all
+	// at once.
+	Sequential bool        `json:"sequential"`
+	Requests   []BatchItem `json:"requests" binding:"required"`
+}
+
+// BatchItem is one API call in a batch.
+type BatchItem struct {
+	// ID names the item so later items can depend on it.
+	ID      string            `json:"id,omitempty"`
+	Method  string            `json:"method" binding:"required"`
+	Path    string            `json:"path" binding:"required"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty" swaggertype:"object"`
+
+	// DependsOn lists the IDs of earlier items that must succeed before this
+	// one runs. Their responses can be referred to in Path and Body as
+	// ${id.field}, such as ${client.vehicles.0.vin}.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// BatchResult is the response to one item of a batch.
+type BatchResult struct {
+	ID     string          `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Header http.Header     `json:"headers,omitempty" swaggertype:"object"`
+	Body   json.RawMessage `json:"body,omitempty" swaggertype:"object"`
+}
+
+// BatchResponse is the response to POST /batch, with a result for each
+// request in the order they were sent.
+type BatchResponse struct {
+	Responses []BatchResult `json:"responses"`
+}
+
+// batchReference matches a reference to an earlier item's response.
+var batchReference = regexp.MustCompile(`\$\{([A-Za-z0-9_-]+)((?:\.[A-Za-z0-9_-]+)+)\}`)
+
+// batchForwardedHeaders are the caller's headers every item is sent with, so
+// items run with the caller's login, CSRF token and address and count against
+// their rate limit. Items can't set them. They are canonical, to compare with an item's
+// own headers.
+var batchForwardedHeaders = []string{"Cookie", "Authorization", "X-Api-Key", "X-Csrf-Token", "X-Forwarded-For", "X-Real-Ip"}
+
+// batchItemKey marks the context of a request run as an item of a batch, so
+// a batch reached through some spelling of its path is still refused.
+type batchItemKey struct{}
+
+// runBatch runs the requests of a batch through router and responds with
+// their results. Items run concurrently unless sequential is set, and an
+// item waits for the items it depends on; if one of them fails it is
+// skipped with 424 Failed Dependency.
+// @Summary Run several API calls at once
+// @Description Run up to BATCH_MAX_SIZE API calls in one request, concurrently or in order, with the caller's login
+// @Tags batch
+// @Accept json
+// @Produce json
+// @Param batch body BatchRequest true "Requests to run"
+// @Success 200 {object} BatchResponse
+// @Failure 400 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Router /batch [post]
+func runBatch(router http.Handler, maxSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Context().Value(batchItemKey{}) != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "batches can't be nested"})
+			return
+		}
+
+		// Items run with the caller's cookies, so a form on another site
+		// must not be able to post a batch.
+		if c.ContentType() != "application/json" {
+			c.IndentedJSON(http.StatusUnsupportedMediaType, gin.H{"message": "batches must be sent as application/json"})
+			return
+		}
+
+		var batch BatchRequest
+		if err := c.ShouldBindJSON(&batch); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		if len(batch.Requests) > maxSize {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("a batch may hold at most %d requests", maxSize),
+			})
+			return
+		}
+		if err := validateBatch(batch.Requests); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		runner := &batchRunner{
+			router:  router,
+			caller:  c.Request,
+			items:   batch.Requests,
+			results: make([]BatchResult, len(batch.Requests)),
+			done:    make([]chan struct{}, len(batch.Requests)),
+			index:   make(map[string]int),
+		}
+		for i, item := range batch.Requests {
+			runner.done[i] = make(chan struct{})
+			if item.ID != "" {
+				runner.index[item.ID] = i
+			}
+		}
+
+		if batch.Sequential {
+			for i := range batch.Requests {
+				runner.run(i)
+			}
+		} else {
+			var wg sync.WaitGroup
+			for i := range batch.Requests {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					runner.run(i)
+				}(i)
+			}
+			wg.Wait()
+		}
+
+		c.IndentedJSON(http.StatusOK, BatchResponse{Responses: runner.results})
+	}
+}
+
+// validateBatch checks that item IDs are unique, that items only depend on
+// earlier items, so a batch can't deadlock, and that no item is a call that
+// can't be batched.
+func validateBatch(items []BatchItem) error {
+	seen := make(map[string]bool)
+	for i, item := range items {
+		for _, dependency := range item.DependsOn {
+			if !seen[dependency] {
+				return fmt.Errorf("request %d depends on %q, which is not an earlier request", i, dependency)
+			}
+		}
+		for _, match := range batchReference.FindAllStringSubmatch(item.Path+string(item.Body), -1) {
+			if !contains(item.DependsOn, match[1]) {
+				return fmt.Errorf("request %d refers to %q without depending on it", i, match[1])
+			}
+		}
+
+		if item.ID != "" {
+			if seen[item.ID] {
+				return fmt.Errorf("request id %q is used more than once", item.ID)
+			}
+			seen[item.ID] = true
+		}
+
+		if !strings.HasPrefix(item.Path, "/") {
+			return fmt.Errorf("request %d: path must start with /", i)
+		}
+		target, err := url.Parse(item.Path)
+		if err != nil {
+			return fmt.Errorf("request %d: %v", i, err)
+		}
+		if !batchable(target.Path) {
+			return fmt.Errorf("request %d: %s can't be batched", i, target.Path)
+		}
+	}
+	return nil
+}
+
+// batchRunner runs the items of one batch.
+type batchRunner struct {
+	router  http.Handler
+	caller  *http.Request
+	items   []BatchItem
+	results []BatchResult
+	done    []chan struct{}
+	index   map[string]int
+}
+
+// run runs item i once the items it depends on have finished.
+func (b *batchRunner) run(i int) {
+	defer close(b.done[i])
+
+	item := b.items[i]
+	b.results[i].ID = item.ID
+
+	for _, dependency := range item.DependsOn {
+		j := b.index[dependency]
+		<-b.done[j]
+		if status := b.results[j].Status; status < 200 || status > 299 {
+			b.results[i].Status = http.StatusFailedDependency
+			b.results[i].Body = batchMessage(fmt.Sprintf("request %q failed with status %d", dependency, status))
+			return
+		}
+	}
+
+	path, err := b.resolve(item.Path, true)
+	if err == nil {
+		var body string
+		body, err = b.resolve(string(item.Body), false)
+		item.Body = json.RawMessage(body)
+	}
+	if err != nil {
+		b.results[i].Status = http.StatusBadRequest
+		b.results[i].Body = batchMessage(err.Error())
+		return
+	}
+
+	ctx := context.WithValue(b.caller.Context(), batchItemKey{}, true)
+	request, err := http.NewRequestWithContext(ctx, strings.ToUpper(item.Method), path, bytes.NewReader(item.Body))
+	if err != nil {
+		b.results[i].Status = http.StatusBadRequest
+		b.results[i].Body = batchMessage(err.Error())
+		return
+	}
+	// References are resolved by now, so this is the path the router sees.
+	if !batchable(request.URL.Path) {
+		b.results[i].Status = http.StatusBadRequest
+		b.results[i].Body = batchMessage(fmt.Sprintf("%s can't be batched", request.URL.Path))
+		return
+	}
+	request.RemoteAddr = b.caller.RemoteAddr
+	for _, name := range batchForwardedHeaders {
+		if value := b.caller.Header.Get(name); value != "" {
+			request.Header.Set(name, value)
+		}
+	}
+	for name, value := range item.Headers {
+		if !contains(batchForwardedHeaders, http.CanonicalHeaderKey(name)) {
+			request.Header.Set(name, value)
+		}
+	}
+	if len(item.Body) > 0 && request.Header.Get("Content-Type") == "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	writer := &batchWriter{header: make(http.Header)}
+	b.router.ServeHTTP(writer, request)
+
+	// Cookies set by an item would never reach the caller, and the batch's
+	// own response varies on nothing an item does.
+	writer.header.Del("Set-Cookie")
+	writer.header.Del("Vary")
+
+	b.results[i].Status = writer.Status()
+	b.results[i].Header = writer.header
+	if json.Valid(writer.body.Bytes()) {
+		b.results[i].Body = writer.body.Bytes()
+	} else if writer.body.Len() > 0 {
+		b.results[i].Body, _ = json.Marshal(writer.body.String())
+	}
+}
+
+// batchable reports whether the decoded path p may be run in a batch. Batches,
+// the WebSocket and the streams are long-lived or would recurse.
+func batchable(p string) bool {
+	p = path.Clean(p)
+	return p != "/batch" && p != "/ws" && !strings.HasSuffix(p, "/stream")
+}
+
+// resolve replaces the references to earlier items' responses in value.
+// Values put into a path are path-escaped. A body is valid JSON, so its
+// references are inside strings, and values are JSON-escaped to stay there.
+func (b *batchRunner) resolve(value string, path bool) (string, error) {
+	var err error
+	resolved := batchReference.ReplaceAllStringFunc(value, func(reference string) string {
+		match := batchReference.FindStringSubmatch(reference)
+		field, found := lookupField(b.results[b.index[match[1]]].Body, strings.Split(match[2][1:], "."))
+		if !found {
+			err = fmt.Errorf("%s is not in the response to %q", reference, match[1])
+			return reference
+		}
+		if path {
+			return url.PathEscape(field)
+		}
+		quoted, _ := json.Marshal(field)
+		return string(quoted[1 : len(quoted)-1])
+	})
+	return resolved, err
+}
+
+// lookupField returns the value at path in a JSON document, as text. Lists
+// are indexed by number.
+func lookupField(document json.RawMessage, path []string) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+
+	for _, name := range path {
+		switch current := value.(type) {
+		case map[string]any:
+			var found bool
+			if value, found = current[name]; !found {
+				return "", false
+			}
+		case []any:
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= len(current) {
+				return "", false
+			}
+			value = current[index]
+		default:
+			return "", false
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	return "", false
+}
+
+// batchMessage is the body of an item the batch could not run.
+func batchMessage(message string) json.RawMessage {
+	body, _ := json.Marshal(gin.H{"message": message})
+	return body
+}
+
+// batchWriter collects an item's response.
+type batchWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(data)
+}
+
+// Flush does nothing; the response is sent when the batch finishes.
+func (w *batchWriter) Flush() {}
+
+// Status returns the item's response status.
+func (w *batchWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
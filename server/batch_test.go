@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/byron-ojua/starter-project/database"
+)
+
+// newBatchRouter serves the test handlers with /batch in front of them.
+func newBatchRouter(store *fakeStore) http.Handler {
+	router := newTestRouter(store)
+	router.POST("/batch", runBatch(router, 20))
+	return router
+}
+
+func TestBatchRefusesNestedBatches(t *testing.T) {
+	store := newFakeStore()
+	store.clients["CIA"] = database.Client{Name: "CIA", ContactName: "batch"}
+	router := newBatchRouter(store)
+
+	for _, path := range []string{"/batch", "/%62atch", "/./batch", "/vehicles/1A/weights/%73tream"} {
+		res := serveTest(router, http.MethodPost, "/batch", `{"requests": [{"method": "POST", "path": "`+path+`", "body": {"requests": []}}]}`)
+		if res.Code != http.StatusBadRequest {
+			t.Errorf("batching %s: got %d, want 400", path, res.Code)
+		}
+	}
+
+	// A path built from a reference is checked once it is resolved.
+	res := serveTest(router, http.MethodPost, "/batch", `{"requests": [
+		{"id": "client", "method": "GET", "path": "/clients/CIA"},
+		{"method": "POST", "path": "/${client.contact_name}", "depends_on": ["client"], "body": {"requests": []}}
+	]}`)
+	var batch BatchResponse
+	decodeTest(t, res, &batch)
+	if len(batch.Responses) != 2 || batch.Responses[1].Status != http.StatusBadRequest {
+		t.Errorf("got %+v, want the second request refused", batch.Responses)
+	}
+}
+
+func TestBatchEscapesReferencesInBodies(t *testing.T) {
+	store := newFakeStore()
+	store.clients["CIA"] = database.Client{Name: "CIA", ContactName: `Jane", "contact_email": "eve@example.com`}
+	router := newBatchRouter(store)
+
+	res := serveTest(router, http.MethodPost, "/batch", `{"sequential": true, "requests": [
+		{"id": "cia", "method": "GET", "path": "/clients/CIA"},
+		{"method": "PUT", "path": "/clients/NSA", "depends_on": ["cia"],
+		 "body": {"name": "NSA", "contact_name": "${cia.contact_name}", "contact_email": "nsa@nsa.gov"}}
+	]}`)
+	var batch BatchResponse
+	decodeTest(t, res, &batch)
+	if len(batch.Responses) != 2 || batch.Responses[1].Status != http.StatusOK {
+		t.Fatalf("got %+v, want the client saved", batch.Responses)
+	}
+
+	saved := store.clients["NSA"]
+	if saved.ContactName != store.clients["CIA"].ContactName || saved.ContactEmail != "nsa@nsa.gov" {
+		t.Errorf("got %+v, want the contact name copied as a string", saved)
+	}
+}
@@ -0,0 +1,22 @@
+// Package cache provides a read-through cache in front of a database.Store.
+package cache
+
+import "time"
+
+// Backend stores encoded values by key. Values are byte slices so a shared
+// backend such as Redis can implement the same interface as the in-process
+// LRU.
+type Backend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(keys ...string)
+	Len() int
+}
+
+// Stats are the counters reported by a cached store.
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+}
@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/byron-ojua/starter-project/database"
+)
+
+// Store is a database.Store that serves reads from a Backend and invalidates
+// the affected keys whenever a client, vehicle or weight is written.
+type Store struct {
+	store   database.Store
+	backend Backend
+	ttl     time.Duration
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+
+	// loading tracks the keys being loaded from the store, so a load that
+	// raced with a write does not put the stale value back in the cache.
+	mu      sync.Mutex
+	loading map[string]*pendingLoad
+}
+
+// pendingLoad counts the loads of a key in flight and the writes to the key
+// since the first of them began. It is dropped when the last load finishes.
+type pendingLoad struct {
+	loads   int
+	version uint64
+}
+
+// NewStore wraps store with a read-through cache whose entries live for ttl.
+func NewStore(store database.Store, backend Backend, ttl time.Duration) *Store {
+	return &Store{
+		store:   store,
+		backend: backend,
+		ttl:     ttl,
+		loading: make(map[string]*pendingLoad),
+	}
+}
+
+// Keys under which each query is cached.
+func allClientsKey() string                  { return "clients" }
+func clientKey(name string) string           { return "client:" + name }
+func clientVehiclesKey(client string) string { return "client-vehicles:" + client }
+func vehicleKey(vin string) string           { return "vehicle:" + vin }
+func weightsKey(vin string) string           { return "weights:" + vin }
+
+// Stats returns the cache's hit, miss and invalidation counts.
+func (s *Store) Stats() Stats {
+	return Stats{
+		Hits:          s.hits.Load(),
+		Misses:        s.misses.Load(),
+		Invalidations: s.invalidations.Load(),
+		Entries:       s.backend.Len(),
+	}
+}
+
+// GetAllClients returns a list of all available clients
+func (s *Store) GetAllClients(ctx context.Context) (*[]database.Client, error) {
+	return readThrough(s, allClientsKey(), func() (*[]database.Client, error) {
+		return s.store.GetAllClients(ctx)
+	})
+}
+
+// GetClientsByName returns the client given its name
+func (s *Store) GetClientsByName(ctx context.Context, params string) (*database.Client, error) {
+	return readThrough(s, clientKey(params), func() (*database.Client, error) {
+		return s.store.GetClientsByName(ctx, params)
+	})
+}
+
+// GetVehiclesByClient returns a list of VINs associated with a client
+func (s *Store) GetVehiclesByClient(ctx context.Context, client string) (*[]string, error) {
+	return readThrough(s, clientVehiclesKey(client), func() (*[]string, error) {
+		return s.store.GetVehiclesByClient(ctx, client)
+	})
+}
+
+// GetVehicleByVin returns the vehicle given its vin
+func (s *Store) GetVehicleByVin(ctx context.Context, params string) (*database.Vehicle, error) {
+	return readThrough(s, vehicleKey(params), func() (*database.Vehicle, error) {
+		return s.store.GetVehicleByVin(ctx, params)
+	})
+}
+
+// GetWeightsByVin returns the weights of a vehicle given its vin
+func (s *Store) GetWeightsByVin(ctx context.Context, params string) (*[]database.Weight, error) {
+	return readThrough(s, weightsKey(params), func() (*[]database.Weight, error) {
+		return s.store.GetWeightsByVin(ctx, params)
+	})
+}
+
+// GetClientsByNames returns the named clients, keyed by name
+func (s *Store) GetClientsByNames(ctx context.Context, names []string) (map[string]database.Client, error) {
+	return readThroughMany(s, names, clientKey, func(missing []string) (map[string]database.Client, error) {
+		return s.store.GetClientsByNames(ctx, missing)
+	})
+}
+
+// GetVehiclesByClients returns the VINs of each client's vehicles, keyed by
+// client
+func (s *Store) GetVehiclesByClients(ctx context.Context, clients []string) (map[string][]string, error) {
+	return readThroughMany(s, clients, clientVehiclesKey, func(missing []string) (map[string][]string, error) {
+		return s.store.GetVehiclesByClients(ctx, missing)
+	})
+}
+
+// GetVehiclesByVins returns the vehicles with the given vins, keyed by vin
+func (s *Store) GetVehiclesByVins(ctx context.Context, vins []string) (map[string]database.Vehicle, error) {
+	return readThroughMany(s, vins, vehicleKey, func(missing []string) (map[string]database.Vehicle, error) {
+		return s.store.GetVehiclesByVins(ctx, missing)
+	})
+}
+
+// GetWeightsByVins returns the weights of each vehicle, keyed by vin
+func (s *Store) GetWeightsByVins(ctx context.Context, vins []string) (map[string][]database.Weight, error) {
+	return readThroughMany(s, vins, weightsKey, func(missing []string) (map[string][]database.Weight, error) {
+		return s.store.GetWeightsByVins(ctx, missing)
+	})
+}
+
+// SaveClient creates or replaces a client
+func (s *Store) SaveClient(ctx context.Context, client database.Client) error {
+	err := s.store.SaveClient(ctx, client)
+	if err == nil {
+		s.invalidate(allClientsKey(), clientKey(client.Name))
+	}
+	return err
+}
+
+// SaveVehicle creates or replaces a vehicle. Both the new owner's vehicle
+// list and, if the vehicle moved, the previous owner's are invalidated. A
+// new or moved vehicle also changes when its owners were last updated, so
+// their records are invalidated too.
+func (s *Store) SaveVehicle(ctx context.Context, vehicle database.Vehicle) (*database.Vehicle, error) {
+	previous, err := s.store.SaveVehicle(ctx, vehicle)
+	if err != nil {
+		return previous, err
+	}
+
+	keys := []string{vehicleKey(vehicle.Vin), clientVehiclesKey(vehicle.Client)}
+	if previous == nil || previous.Client != vehicle.Client {
+		keys = append(keys, allClientsKey(), clientKey(vehicle.Client))
+	}
+	if previous != nil && previous.Client != vehicle.Client {
+		keys = append(keys, clientVehiclesKey(previous.Client), clientKey(previous.Client))
+	}
+	s.invalidate(keys...)
+	return previous, nil
+}
+
+// AddWeight records a new weight reading for a vehicle
+func (s *Store) AddWeight(ctx context.Context, weight database.Weight) error {
+	err := s.store.AddWeight(ctx, weight)
+	if err == nil {
+		s.invalidate(weightsKey(weight.Vin))
+	}
+	return err
+}
+
+// Ping reports whether the underlying store can serve requests.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.store.Ping(ctx)
+}
+
+// Close closes the underlying store.
+func (s *Store) Close() error {
+	return s.store.Close()
+}
+
+func (s *Store) invalidate(keys ...string) {
+	s.mu.Lock()
+	for _, key := range keys {
+		if pending, found := s.loading[key]; found {
+			pending.version++
+		}
+	}
+	s.mu.Unlock()
+
+	s.backend.Delete(keys...)
+	s.invalidations.Add(uint64(len(keys)))
+}
+
+// startLoad records a load of key and returns the version it began at.
+func (s *Store) startLoad(key string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, found := s.loading[key]
+	if !found {
+		pending = &pendingLoad{}
+		s.loading[key] = pending
+	}
+	pending.loads++
+	return pending.version
+}
+
+// finishLoad caches data under key, unless it is nil or key was written since
+// the load began at version, and forgets the load.
+func (s *Store) finishLoad(key string, version uint64, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.loading[key]
+	if data != nil && pending.version == version {
+		s.backend.Set(key, data, s.ttl)
+	}
+	pending.loads--
+	if pending.loads == 0 {
+		delete(s.loading, key)
+	}
+}
+
+// readThrough returns the value cached under key, or loads, caches and
+// returns it. Errors are never cached.
+func readThrough[T any](s *Store, key string, load func() (*T, error)) (*T, error) {
+	if data, found := s.backend.Get(key); found {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			s.hits.Add(1)
+			return &value, nil
+		}
+		s.backend.Delete(key)
+	}
+
+	s.misses.Add(1)
+	version := s.startLoad(key)
+	value, err := load()
+	if err != nil || value == nil {
+		s.finishLoad(key, version, nil)
+		return value, err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		slog.Warn("caching failed", "key", key, "err", err)
+	}
+	s.finishLoad(key, version, data)
+	return value, nil
+}
+
+// readThroughMany is readThrough for batch reads. Cached ids are served from
+// the backend and the rest are loaded in one call, each cached under the same
+// key as the single read would use. Ids the load leaves out are not cached.
+func readThroughMany[T any](s *Store, ids []string, key func(string) string, load func(missing []string) (map[string]T, error)) (map[string]T, error) {
+	results := make(map[string]T, len(ids))
+	versions := make(map[string]uint64)
+	var missing []string
+
+	for _, id := range ids {
+		if _, seen := results[id]; seen {
+			continue
+		}
+		if _, seen := versions[id]; seen {
+			continue
+		}
+
+		if data, found := s.backend.Get(key(id)); found {
+			var value T
+			if err := json.Unmarshal(data, &value); err == nil {
+				s.hits.Add(1)
+				results[id] = value
+				continue
+			}
+			s.backend.Delete(key(id))
+		}
+
+		s.misses.Add(1)
+		versions[id] = s.startLoad(key(id))
+		missing = append(missing, id)
+	}
+
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	loaded, err := load(missing)
+	for _, id := range missing {
+		value, found := loaded[id]
+		if err != nil || !found {
+			s.finishLoad(key(id), versions[id], nil)
+			continue
+		}
+		results[id] = value
+
+		data, marshalErr := json.Marshal(value)
+		if marshalErr != nil {
+			slog.Warn("caching failed", "key", key(id), "err", marshalErr)
+		}
+		s.finishLoad(key(id), versions[id], data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byron-ojua/starter-project/database"
+)
+
+// fakeStore holds clients in memory. A read can be held after it has looked
+// at the data, to stand in for a slow query that races with a write.
+type fakeStore struct {
+	database.Store
+
+	mu      sync.Mutex
+	clients map[string]database.Client
+	reads   int
+	hold    chan struct{} // the next read waits on it, once started is sent
+	started chan struct{}
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{clients: map[string]database.Client{"CIA": {Name: "CIA", ContactName: "Jane"}}}
+}
+
+func (f *fakeStore) GetClientsByName(ctx context.Context, name string) (*database.Client, error) {
+	f.mu.Lock()
+	client, found := f.clients[name]
+	f.reads++
+	hold := f.hold
+	f.hold = nil
+	f.mu.Unlock()
+
+	if hold != nil {
+		f.started <- struct{}{}
+		<-hold
+	}
+	if !found {
+		return nil, database.ErrNotFound
+	}
+	return &client, nil
+}
+
+func (f *fakeStore) GetClientsByNames(ctx context.Context, names []string) (map[string]database.Client, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reads++
+	results := make(map[string]database.Client)
+	for _, name := range names {
+		if client, found := f.clients[name]; found {
+			results[name] = client
+		}
+	}
+	return results, nil
+}
+
+func (f *fakeStore) SaveClient(ctx context.Context, client database.Client) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.clients[client.Name] = client
+	return nil
+}
+
+// newTestStore caches store the way main does, behind request coalescing.
+func newTestStore(store database.Store) *Store {
+	return NewStore(database.NewCoalesced(store), NewLRU(100), time.Minute)
+}
+
+func TestWriteDuringLoadIsNotCached(t *testing.T) {
+	fake := newFakeStore()
+	hold := make(chan struct{})
+	fake.hold = hold
+	fake.started = make(chan struct{})
+	cached := newTestStore(fake)
+	ctx := context.Background()
+
+	// A read starts before the write and sees the old contact.
+	slow := make(chan string, 1)
+	go func() {
+		client, err := cached.GetClientsByName(ctx, "CIA")
+		if err != nil {
+			t.Error(err)
+		}
+		slow <- client.ContactName
+	}()
+	<-fake.started
+
+	if err := cached.SaveClient(ctx, database.Client{Name: "CIA", ContactName: "Stan"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A read after the write must not share the slow read's answer, so it
+	// does not wait for it either.
+	fresh := make(chan string, 1)
+	go func() {
+		client, err := cached.GetClientsByName(ctx, "CIA")
+		if err != nil {
+			t.Error(err)
+		}
+		fresh <- client.ContactName
+	}()
+	select {
+	case contact := <-fresh:
+		if contact != "Stan" {
+			t.Errorf("a read after the write got contact %q, want Stan", contact)
+		}
+	case <-time.After(time.Second):
+		close(hold)
+		t.Fatal("a read after the write joined the read that began before it")
+	}
+
+	close(hold)
+	if contact := <-slow; contact != "Jane" {
+		t.Errorf("the slow read got contact %q, want Jane", contact)
+	}
+
+	client, err := cached.GetClientsByName(ctx, "CIA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ContactName != "Stan" {
+		t.Errorf("the cache holds contact %q, want Stan", client.ContactName)
+	}
+	if len(cached.loading) != 0 {
+		t.Errorf("still tracking %d loads, want none", len(cached.loading))
+	}
+}
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	fake := newFakeStore()
+	cached := newTestStore(fake)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				cached.GetClientsByName(ctx, "CIA")
+				cached.GetClientsByNames(ctx, []string{"CIA", "NSA"})
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				contact := fmt.Sprintf("contact %d-%d", i, j)
+				cached.SaveClient(ctx, database.Client{Name: "CIA", ContactName: contact})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Once the writes are over, the cache must agree with the store.
+	final := database.Client{Name: "CIA", ContactName: "final"}
+	if err := cached.SaveClient(ctx, final); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		client, err := cached.GetClientsByName(ctx, "CIA")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.ContactName != "final" {
+			t.Errorf("read %d got contact %q, want final", i, client.ContactName)
+		}
+	}
+	if len(cached.loading) != 0 {
+		t.Errorf("still tracking %d loads, want none", len(cached.loading))
+	}
+}
+
+func TestBatchReadsShareTheCache(t *testing.T) {
+	fake := newFakeStore()
+	cached := newTestStore(fake)
+	ctx := context.Background()
+
+	clients, err := cached.GetClientsByNames(ctx, []string{"CIA", "NSA", "CIA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 || clients["CIA"].ContactName != "Jane" {
+		t.Errorf("got %+v, want only CIA", clients)
+	}
+
+	if _, err := cached.GetClientsByName(ctx, "CIA"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.reads != 1 {
+		t.Errorf("the store was read %d times, want once", fake.reads)
+	}
+	if len(cached.loading) != 0 {
+		t.Errorf("still tracking %d loads, want none", len(cached.loading))
+	}
+}
@@ -0,0 +1,187 @@
+/*
+* @file conditional.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the support for conditional requests: ETag and
+* Last-Modified on resource responses, 304 for GETs the caller already has,
+* and If-Match/If-None-Match on writes for optimistic concurrency.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/gin-gonic/gin"
+)
+
+// respondJSON sends body as indented JSON with a strong ETag computed from
+// its bytes and, if modified is set, a Last-Modified date. If the caller's
+// If-None-Match or If-Modified-Since show it already has this response, it
+// gets a 304 instead.
+func respondJSON(c *gin.Context, body any, modified time.Time) {
+	data, err := json.MarshalIndent(body, "", "    ")
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	etag := entityTag(data)
+	c.Header("ETag", etag)
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(c, etag, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// notModified reports whether a GET's validators match the current response.
+// If-None-Match takes precedence over If-Modified-Since.
+func notModified(c *gin.Context, etag string, modified time.Time) bool {
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		return etagListed(header, etag, false)
+	}
+
+	if header := c.GetHeader("If-Modified-Since"); header != "" && !modified.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !modified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// checkPreconditions evaluates a write's If-Match and If-None-Match headers
+// against the resource as it would be returned by a GET. current loads that
+// response and returns database.ErrNotFound if the resource does not exist.
+// If a precondition fails it responds with 412, and if current fails any
+// other way it responds as storeFailed does; either way it returns false.
+func checkPreconditions(c *gin.Context, current func(ctx context.Context) (any, error)) bool {
+	ifMatch := c.GetHeader("If-Match")
+	ifNoneMatch := c.GetHeader("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return true
+	}
+
+	var etag string
+	body, err := current(c.Request.Context())
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		storeFailed(c, err)
+		return false
+	}
+	if err == nil {
+		data, err := json.MarshalIndent(body, "", "    ")
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return false
+		}
+		etag = entityTag(data)
+	}
+
+	exists := etag != ""
+	failed := (ifMatch != "" && (!exists || !etagListed(ifMatch, etag, true))) ||
+		(ifNoneMatch != "" && exists && etagListed(ifNoneMatch, etag, false))
+	if !failed {
+		return true
+	}
+
+	if exists {
+		c.Header("ETag", etag)
+	}
+	c.IndentedJSON(http.StatusPreconditionFailed, gin.H{"message": "the resource has changed; fetch it again and retry"})
+	return false
+}
+
+// latest returns the latest of times.
+func latest(times ...time.Time) time.Time {
+	var result time.Time
+	for _, t := range times {
+		if t.After(result) {
+			result = t
+		}
+	}
+	return result
+}
+
+// entityTag returns a strong ETag for a response body.
+func entityTag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagListed reports whether a comma-separated If-Match or If-None-Match
+// header lists etag or "*". If-Match uses strong comparison, so weak tags
+// never match it.
+func etagListed(header, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak, found := strings.CutPrefix(candidate, "W/"); found {
+			if strong {
+				continue
+			}
+			candidate = weak
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// keyedMutex serializes writes to the same resource, so a precondition can't
+// be overtaken by another write between being checked and the save.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// lock locks key and returns the function that unlocks it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	entry, found := k.locks[key]
+	if !found {
+		entry = &keyedLock{}
+		k.locks[key] = entry
+	}
+	entry.waiters++
+	k.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+
+		k.mu.Lock()
+		entry.waiters--
+		if entry.waiters == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
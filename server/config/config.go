@@ -0,0 +1,321 @@
+// Package config holds the server's settings. They are read from defaults,
+// then a YAML or TOML file, then environment variables, then command-line
+// flags, each overriding the one before.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/byron-ojua/starter-project/cors"
+	"github.com/byron-ojua/starter-project/graph"
+)
+
+// Config is every setting the server reads when it starts. Each field's env
+// tag names the environment variable that sets it; its flag is its path
+// through the file's keys, such as --server.addr.
+type Config struct {
+	// Env is the deployment environment. Production tightens the defaults
+	// for cookies and refuses the development login password.
+	Env string `yaml:"env" toml:"env" env:"APP_ENV"`
+
+	Server      Server      `yaml:"server" toml:"server"`
+	Log         Log         `yaml:"log" toml:"log"`
+	Auth        Auth        `yaml:"auth" toml:"auth"`
+	Store       Store       `yaml:"store" toml:"store"`
+	Cache       Cache       `yaml:"cache" toml:"cache"`
+	Fanout      Fanout      `yaml:"fanout" toml:"fanout"`
+	CORS        CORS        `yaml:"cors" toml:"cors"`
+	RateLimit   RateLimit   `yaml:"rate_limit" toml:"rate_limit"`
+	Webhooks    Webhooks    `yaml:"webhooks" toml:"webhooks"`
+	GraphQL     GraphQL     `yaml:"graphql" toml:"graphql"`
+	Idempotency Idempotency `yaml:"idempotency" toml:"idempotency"`
+	Batch       Batch       `yaml:"batch" toml:"batch"`
+	OIDC        OIDC        `yaml:"oidc" toml:"oidc"`
+	API         API         `yaml:"api" toml:"api"`
+	OpenAPI     OpenAPI     `yaml:"openapi" toml:"openapi"`
+	Frontend    Frontend    `yaml:"frontend" toml:"frontend"`
+	Audit       Audit       `yaml:"audit" toml:"audit"`
+}
+
+// Server is where the server listens.
+type Server struct {
+	Addr     string `yaml:"addr" toml:"addr" env:"LISTEN_ADDR"`
+	GRPCAddr string `yaml:"grpc_addr" toml:"grpc_addr" env:"GRPC_ADDR"`
+
+	// ExternalURL is the address browsers reach the server at, for links
+	// such as the single sign-on callback. It defaults to http:// and Addr.
+	ExternalURL string `yaml:"external_url" toml:"external_url" env:"EXTERNAL_URL"`
+
+	// TrustedProxies are the addresses or CIDR ranges of the proxies whose
+	// X-Forwarded-For headers name the caller. Requests from anywhere else
+	// are attributed to their own address. Empty trusts no proxy.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// Log is what the server logs. It is applied again on SIGHUP.
+type Log struct {
+	// Level is the least severe message logged: debug, info, warn or
+	// error. Requests are logged at info.
+	Level slog.Level `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+}
+
+// Auth is how users log in.
+type Auth struct {
+	// Password is the shared password for the login form.
+	Password string `yaml:"password" toml:"password" env:"LOGIN_PASSWORD" secret:"true"`
+
+	Cookie Cookie `yaml:"cookie" toml:"cookie"`
+}
+
+// Cookie is the attributes of the cookies the server sets. Secure and
+// SameSite default from Env.
+type Cookie struct {
+	Domain   string `yaml:"domain" toml:"domain" env:"COOKIE_DOMAIN"`
+	Secure   *bool  `yaml:"secure" toml:"secure" env:"COOKIE_SECURE"`
+	SameSite string `yaml:"same_site" toml:"same_site" env:"COOKIE_SAMESITE"`
+
+	// MaxAge is how long sessions last, in seconds.
+	MaxAge int `yaml:"max_age" toml:"max_age" env:"COOKIE_MAX_AGE"`
+}
+
+// Store is where clients, vehicles and weights are kept.
+type Store struct {
+	// Driver names the store. Only memory is supported.
+	Driver string `yaml:"driver" toml:"driver" env:"STORE_DRIVER"`
+}
+
+// Cache is the cache in front of the store.
+type Cache struct {
+	// TTL is how long entries are kept. Zero disables caching.
+	TTL  Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL"`
+	Size int      `yaml:"size" toml:"size" env:"CACHE_SIZE"`
+}
+
+// Fanout is how many store calls may be in flight. Zero means no limit.
+type Fanout struct {
+	Global     int `yaml:"global" toml:"global" env:"FANOUT_GLOBAL"`
+	PerRequest int `yaml:"per_request" toml:"per_request" env:"FANOUT_PER_REQUEST"`
+}
+
+// CORS is which browser origins may call the API.
+type CORS struct {
+	AllowedOrigins   []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string `yaml:"exposed_headers" toml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+
+	// MaxAge is how long preflights are cached, in seconds.
+	MaxAge int `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// RateLimit is how often callers may call the API, in the formats
+// ratelimit.ParsePolicy reads. It is applied again on SIGHUP.
+type RateLimit struct {
+	Plans string `yaml:"plans" toml:"plans" env:"RATE_LIMIT_PLANS"`
+	Keys  string `yaml:"keys" toml:"keys" env:"RATE_LIMIT_KEYS" secret:"true"`
+}
+
+// Webhooks is how outbound webhooks are kept and retried.
+type Webhooks struct {
+	// StoreFile is where subscriptions and deliveries are kept. Empty keeps
+	// them in memory.
+	StoreFile   string   `yaml:"store_file" toml:"store_file" env:"WEBHOOK_STORE_FILE"`
+	MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	RetryDelay  Duration `yaml:"retry_delay" toml:"retry_delay" env:"WEBHOOK_RETRY_DELAY"`
+
+	// AllowPrivateHosts lets webhooks be sent to private, loopback and
+	// link-local addresses, for receivers on the server's own network.
+	AllowPrivateHosts bool `yaml:"allow_private_hosts" toml:"allow_private_hosts" env:"WEBHOOK_ALLOW_PRIVATE_HOSTS"`
+}
+
+// GraphQL is the limits on GraphQL queries. Zero means no limit.
+type GraphQL struct {
+	MaxDepth      int `yaml:"max_depth" toml:"max_depth" env:"GRAPHQL_MAX_DEPTH"`
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity" env:"GRAPHQL_MAX_COMPLEXITY"`
+}
+
+// Idempotency is how long responses are kept to be replayed.
+type Idempotency struct {
+	Window Duration `yaml:"window" toml:"window" env:"IDEMPOTENCY_WINDOW"`
+}
+
+// Batch is the limits on batch requests.
+type Batch struct {
+	MaxSize int `yaml:"max_size" toml:"max_size" env:"BATCH_MAX_SIZE"`
+}
+
+// OIDC is the single sign-on provider. SSO is off unless IssuerURL is set or
+// Mock is.
+type OIDC struct {
+	IssuerURL    string   `yaml:"issuer_url" toml:"issuer_url" env:"OIDC_ISSUER_URL"`
+	ClientID     string   `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes       []string `yaml:"scopes" toml:"scopes" env:"OIDC_SCOPES"`
+	RoleMap      string   `yaml:"role_map" toml:"role_map" env:"OIDC_ROLE_MAP"`
+	Mock         bool     `yaml:"mock" toml:"mock" env:"OIDC_MOCK"`
+}
+
+// API is the schedule for retiring old API versions. v1 is not deprecated
+// until V1Deprecated is set.
+type API struct {
+	// V1Deprecated is when v1 stopped being recommended, and V1Sunset when
+	// it will be removed. They are sent in v1's Deprecation and Sunset
+	// headers.
+	V1Deprecated Date `yaml:"v1_deprecated" toml:"v1_deprecated" env:"API_V1_DEPRECATED"`
+	V1Sunset     Date `yaml:"v1_sunset" toml:"v1_sunset" env:"API_V1_SUNSET"`
+}
+
+// OpenAPI is whether traffic is checked against the OpenAPI document.
+type OpenAPI struct {
+	Validate bool `yaml:"validate" toml:"validate" env:"OPENAPI_VALIDATE"`
+}
+
+// Frontend is the settings passed to the React frontend.
+type Frontend struct {
+	// APIURL is where the frontend sends API requests. Empty means the
+	// origin it was served from.
+	APIURL string `yaml:"api_url" toml:"api_url" env:"FRONTEND_API_URL"`
+}
+
+// Audit is where the audit log is kept.
+type Audit struct {
+	// File is where entries are appended. Empty keeps them in memory.
+	File string `yaml:"file" toml:"file" env:"AUDIT_LOG_FILE"`
+}
+
+// DevelopmentPassword is the login password when none is configured. It is
+// refused in production.
+const DevelopmentPassword = "password"
+
+// Default returns the settings used where nothing overrides them.
+func Default() Config {
+	policy := cors.DefaultPolicy()
+
+	return Config{
+		Env: "development",
+		Server: Server{
+			Addr:     "localhost:8080",
+			GRPCAddr: "localhost:9090",
+		},
+		Log:    Log{Level: slog.LevelInfo},
+		Auth:   Auth{Password: DevelopmentPassword, Cookie: Cookie{MaxAge: 3600}},
+		Store:  Store{Driver: "memory"},
+		Cache:  Cache{TTL: Duration(30 * time.Second), Size: 1000},
+		Fanout: Fanout{Global: 64, PerRequest: 8},
+		CORS: CORS{
+			AllowedOrigins:   policy.AllowedOrigins,
+			AllowedMethods:   policy.AllowedMethods,
+			AllowedHeaders:   policy.AllowedHeaders,
+			ExposedHeaders:   policy.ExposedHeaders,
+			AllowCredentials: policy.AllowCredentials,
+			MaxAge:           int(policy.MaxAge / time.Second),
+		},
+		Webhooks:    Webhooks{MaxAttempts: 8, RetryDelay: Duration(30 * time.Second)},
+		GraphQL:     GraphQL{MaxDepth: graph.DefaultLimits.MaxDepth, MaxComplexity: graph.DefaultLimits.MaxComplexity},
+		Idempotency: Idempotency{Window: Duration(24 * time.Hour)},
+		Batch:       Batch{MaxSize: 20},
+		OIDC:        OIDC{Scopes: []string{"openid", "profile", "email"}},
+	}
+}
+
+// Production reports whether the server is deployed to production.
+func (c *Config) Production() bool {
+	return strings.EqualFold(c.Env, "production")
+}
+
+// resolve fills in the settings whose defaults depend on others.
+func (c *Config) resolve() {
+	if c.Auth.Cookie.Secure == nil {
+		secure := c.Production()
+		c.Auth.Cookie.Secure = &secure
+	}
+	if c.Auth.Cookie.SameSite == "" {
+		c.Auth.Cookie.SameSite = "lax"
+		if c.Production() {
+			c.Auth.Cookie.SameSite = "strict"
+		}
+	}
+	if c.Server.ExternalURL == "" {
+		host := c.Server.Addr
+		if strings.HasPrefix(host, ":") {
+			host = "localhost" + host
+		}
+		c.Server.ExternalURL = "http://" + host
+	}
+	c.Server.ExternalURL = strings.TrimSuffix(c.Server.ExternalURL, "/")
+	if c.OIDC.RedirectURL == "" {
+		c.OIDC.RedirectURL = c.Server.ExternalURL + "/login/sso/callback"
+	}
+	c.Frontend.APIURL = strings.TrimSuffix(c.Frontend.APIURL, "/")
+	for i, method := range c.CORS.AllowedMethods {
+		c.CORS.AllowedMethods[i] = strings.ToUpper(method)
+	}
+}
+
+// Validate reports every setting that is out of range or that the server
+// cannot use.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.GRPCAddr != "", "server.grpc_addr is required")
+	if external, err := url.Parse(c.Server.ExternalURL); err != nil || external.Host == "" ||
+		(external.Scheme != "http" && external.Scheme != "https") {
+		errs = append(errs, fmt.Errorf("server.external_url %q is not an http or https URL", c.Server.ExternalURL))
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies entry %q is not an IP address or CIDR range", proxy)
+	}
+
+	check(c.Auth.Password != "", "auth.password is required")
+	check(!c.Production() || c.Auth.Password != DevelopmentPassword, "auth.password must be changed from the development password in production")
+	switch strings.ToLower(c.Auth.Cookie.SameSite) {
+	case "lax", "strict":
+	case "none":
+		check(c.Auth.Cookie.Secure != nil && *c.Auth.Cookie.Secure, "auth.cookie.same_site none requires auth.cookie.secure")
+	default:
+		errs = append(errs, fmt.Errorf("auth.cookie.same_site %q must be lax, strict or none", c.Auth.Cookie.SameSite))
+	}
+	check(c.Auth.Cookie.MaxAge > 0, "auth.cookie.max_age must be positive")
+
+	check(c.Store.Driver == "memory", "store.driver %q is not supported; use memory", c.Store.Driver)
+
+	check(c.Cache.TTL >= 0, "cache.ttl must not be negative")
+	check(c.Cache.Size >= 0, "cache.size must not be negative")
+	check(c.Fanout.Global >= 0, "fanout.global must not be negative")
+	check(c.Fanout.PerRequest >= 0, "fanout.per_request must not be negative")
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+
+	check(c.Webhooks.MaxAttempts >= 1, "webhooks.max_attempts must be positive")
+	check(c.Webhooks.RetryDelay > 0, "webhooks.retry_delay must be positive")
+	check(c.GraphQL.MaxDepth >= 0, "graphql.max_depth must not be negative")
+	check(c.GraphQL.MaxComplexity >= 0, "graphql.max_complexity must not be negative")
+	check(c.Idempotency.Window > 0, "idempotency.window must be positive")
+	check(c.Batch.MaxSize >= 1, "batch.max_size must be positive")
+
+	deprecated, sunset := time.Time(c.API.V1Deprecated), time.Time(c.API.V1Sunset)
+	check(sunset.IsZero() || !deprecated.IsZero(), "api.v1_sunset requires api.v1_deprecated")
+	check(sunset.IsZero() || sunset.After(deprecated), "api.v1_sunset must be after api.v1_deprecated")
+
+	check(c.OIDC.IssuerURL == "" || c.OIDC.ClientID != "" || c.OIDC.Mock, "oidc.client_id is required with oidc.issuer_url")
+	// The mock provider signs anyone in as an admin without a prompt.
+	check(!c.Production() || !c.OIDC.Mock, "oidc.mock must not be used in production")
+	check(c.OIDC.IssuerURL == "" || !c.OIDC.Mock, "oidc.mock replaces oidc.issuer_url; set only one")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRefusesMockOIDC(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "in production",
+			args: []string{"--env=production", "--auth.password=s3cret", "--oidc.mock"},
+			want: "oidc.mock must not be used in production",
+		},
+		{
+			name: "with an issuer",
+			args: []string{"--oidc.mock", "--oidc.issuer_url=https://login.example.com", "--oidc.client_id=fleet"},
+			want: "oidc.mock replaces oidc.issuer_url",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := Load(test.args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+
+	if _, _, err := Load([]string{"--oidc.mock"}); err != nil {
+		t.Errorf("mock mode in development: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a Go duration, such as 30s or 24h.
+type Duration time.Duration
+
+// MarshalText writes the duration as a Go duration.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText reads a Go duration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Date is a day, written as 2006-01-02, or a time written in RFC 3339. The
+// zero Date is written as an empty string.
+type Date time.Time
+
+// MarshalText writes the date as 2006-01-02, or in RFC 3339 if it has a time
+// of day.
+func (d Date) MarshalText() ([]byte, error) {
+	t := time.Time(d).UTC()
+	switch {
+	case t.IsZero():
+		return []byte{}, nil
+	case t.Equal(t.Truncate(24 * time.Hour)):
+		return []byte(t.Format(time.DateOnly)), nil
+	}
+	return []byte(t.Format(time.RFC3339)), nil
+}
+
+// UnmarshalText reads a date as 2006-01-02, taken as midnight UTC, or a time
+// in RFC 3339. An empty string is the zero Date.
+func (d *Date) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := time.Parse(time.DateOnly, string(text))
+	if err != nil {
+		if parsed, err = time.Parse(time.RFC3339, string(text)); err != nil {
+			return fmt.Errorf("%q is not a date such as 2006-01-02", text)
+		}
+	}
+	*d = Date(parsed.UTC())
+	return nil
+}
+
+// Load reads the settings for a server started with args, the command-line
+// arguments after the program's name. Settings are read from Default, then
+// the file named by --config or CONFIG_FILE, then environment variables,
+// then flags, and are validated once all are applied. The arguments left
+// after the flags, which name a command to run, are returned as well.
+//
+// --help prints the flags and returns flag.ErrHelp.
+func Load(args []string) (*Config, []string, error) {
+	config := Default()
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: server [flags] [config print | openapi <file>]")
+		flags.PrintDefaults()
+	}
+	file := flags.String("config", "", "YAML or TOML `file` to read settings from (CONFIG_FILE)")
+
+	set := make(map[string]string)
+	fields(&config, func(path string, field reflect.StructField, value reflect.Value) {
+		usage := "sets " + path
+		if env := field.Tag.Get("env"); env != "" {
+			usage += " (" + env + ")"
+		}
+		flags.Var(&flagValue{name: path, set: set, boolean: isBool(value.Type())}, path, usage)
+	})
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file == "" {
+		*file = os.Getenv("CONFIG_FILE")
+	}
+	if *file != "" {
+		if err := readFile(*file, &config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	fields(&config, func(path string, field reflect.StructField, value reflect.Value) {
+		env := field.Tag.Get("env")
+		if env == "" {
+			return
+		}
+		// An empty variable is ignored, except that it clears a list.
+		text, found := os.LookupEnv(env)
+		if !found || (text == "" && value.Kind() != reflect.Slice) {
+			return
+		}
+		if err := setText(value, text); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q", env, text))
+		}
+	})
+	fields(&config, func(path string, field reflect.StructField, value reflect.Value) {
+		text, found := set[path]
+		if !found {
+			return
+		}
+		if err := setText(value, text); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --%s %q", path, text))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	config.resolve()
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &config, flags.Args(), nil
+}
+
+// readFile decodes the YAML or TOML file at path, chosen by its extension,
+// over config. Keys the file does not set keep their values; keys config
+// does not have are an error, so typos are not silently ignored.
+func readFile(path string, config *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".toml":
+		err = toml.NewDecoder(file).DisallowUnknownFields().Decode(config)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// textUnmarshaler is the type of encoding.TextUnmarshaler.
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// fields calls fn with each setting in config, named by its path through the
+// file's keys, such as server.addr.
+func fields(config *Config, fn func(path string, field reflect.StructField, value reflect.Value)) {
+	var walk func(prefix string, value reflect.Value)
+	walk = func(prefix string, value reflect.Value) {
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			path := prefix + field.Tag.Get("yaml")
+			// A struct read from text, such as a Date, is one setting; any
+			// other is a section of them.
+			if field.Type.Kind() == reflect.Struct && !reflect.PointerTo(field.Type).Implements(textUnmarshaler) {
+				walk(path+".", value.Field(i))
+				continue
+			}
+			fn(path, field, value.Field(i))
+		}
+	}
+	walk("", reflect.ValueOf(config).Elem())
+}
+
+// setText sets value from text, as read from an environment variable or a
+// flag. Lists are separated by commas or spaces.
+func setText(value reflect.Value, text string) error {
+	if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(parsed))
+	case reflect.Slice:
+		value.Set(reflect.ValueOf(strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})))
+	case reflect.Pointer:
+		target := reflect.New(value.Type().Elem())
+		if err := setText(target.Elem(), text); err != nil {
+			return err
+		}
+		value.Set(target)
+	default:
+		return fmt.Errorf("config: cannot set a %s", value.Type())
+	}
+	return nil
+}
+
+// isBool reports whether a setting of type t is a bool, so its flag can be
+// given without a value.
+func isBool(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Bool
+}
+
+// flagValue records the text a flag is given, to be applied once the file
+// and environment variables are.
+type flagValue struct {
+	name    string
+	set     map[string]string
+	boolean bool
+}
+
+func (f *flagValue) String() string {
+	return ""
+}
+
+func (f *flagValue) Set(text string) error {
+	f.set[f.name] = text
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.boolean
+}
+
+// Redacted returns a copy of the config with secrets, such as the login
+// password, hidden.
+func (c *Config) Redacted() Config {
+	redacted := *c
+	fields(&redacted, func(path string, field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString("REDACTED")
+		}
+	})
+	return redacted
+}
+
+// Print writes the config to w as YAML, with secrets redacted, in the form a
+// config file takes.
+func (c *Config) Print(w io.Writer) error {
+	redacted := c.Redacted()
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redacted); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Changed returns the settings, by path, whose values differ between c and
+// other.
+func (c *Config) Changed(other *Config) []string {
+	values := make(map[string]any)
+	fields(other, func(path string, field reflect.StructField, value reflect.Value) {
+		values[path] = value.Interface()
+	})
+
+	var changed []string
+	fields(c, func(path string, field reflect.StructField, value reflect.Value) {
+		if !reflect.DeepEqual(values[path], value.Interface()) {
+			changed = append(changed, path)
+		}
+	})
+	return changed
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEnv are the environment variables the tests set, cleared before each
+// load so the settings come only from the test.
+var testEnv = []string{
+	"CONFIG_FILE", "CACHE_SIZE", "CACHE_TTL", "OIDC_SCOPES", "COOKIE_SECURE",
+	"LOG_LEVEL", "API_V1_DEPRECATED", "API_V1_SUNSET", "LOGIN_PASSWORD",
+}
+
+// writeConfigFile writes contents to a file called name in a temporary
+// directory and returns its path.
+func writeConfigFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadTest loads the settings from args with only the variables in env set.
+func loadTest(t *testing.T, env map[string]string, args ...string) (*Config, error) {
+	t.Helper()
+	for _, name := range testEnv {
+		// Setenv restores the variable when the test ends.
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	config, _, err := Load(args)
+	return config, err
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeConfigFile(t, "config.yaml", "cache:\n  size: 10\n")
+	tomlFile := writeConfigFile(t, "config.toml", "[cache]\nsize = 11\n")
+
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want int
+	}{
+		{name: "default", want: 1000},
+		{name: "yaml file", args: []string{"--config=" + yamlFile}, want: 10},
+		{name: "toml file", args: []string{"--config=" + tomlFile}, want: 11},
+		{name: "file from CONFIG_FILE", env: map[string]string{"CONFIG_FILE": yamlFile}, want: 10},
+		{name: "--config over CONFIG_FILE", env: map[string]string{"CONFIG_FILE": yamlFile}, args: []string{"--config=" + tomlFile}, want: 11},
+		{name: "env over default", env: map[string]string{"CACHE_SIZE": "20"}, want: 20},
+		{name: "env over file", env: map[string]string{"CACHE_SIZE": "20"}, args: []string{"--config=" + yamlFile}, want: 20},
+		{name: "empty env ignored", env: map[string]string{"CACHE_SIZE": ""}, args: []string{"--config=" + yamlFile}, want: 10},
+		{name: "flag over file", args: []string{"--config=" + yamlFile, "--cache.size", "30"}, want: 30},
+		{name: "flag over env", env: map[string]string{"CACHE_SIZE": "20"}, args: []string{"--config=" + yamlFile, "--cache.size=30"}, want: 30},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadTest(t, test.env, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Cache.Size != test.want {
+				t.Errorf("got cache.size %d, want %d", config.Cache.Size, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadLists(t *testing.T) {
+	file := writeConfigFile(t, "config.yaml", "oidc:\n  scopes: [openid, groups]\n")
+
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{name: "default", want: []string{"openid", "profile", "email"}},
+		{name: "file", args: []string{"--config=" + file}, want: []string{"openid", "groups"}},
+		{name: "env split on commas and spaces", env: map[string]string{"OIDC_SCOPES": "openid, email  groups"}, want: []string{"openid", "email", "groups"}},
+		{name: "empty env clears the default", env: map[string]string{"OIDC_SCOPES": ""}, want: []string{}},
+		{name: "empty env clears the file", env: map[string]string{"OIDC_SCOPES": ""}, args: []string{"--config=" + file}, want: []string{}},
+		{name: "flag", env: map[string]string{"OIDC_SCOPES": "email"}, args: []string{"--oidc.scopes=openid,offline_access"}, want: []string{"openid", "offline_access"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadTest(t, test.env, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config.OIDC.Scopes, test.want) {
+				t.Errorf("got %q, want %q", config.OIDC.Scopes, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadPointers(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want bool
+	}{
+		{name: "unset in development", want: false},
+		{name: "unset in production", args: []string{"--env=production", "--auth.password=s3cret"}, want: true},
+		{name: "env", env: map[string]string{"COOKIE_SECURE": "true"}, want: true},
+		{name: "env set false in production", env: map[string]string{"COOKIE_SECURE": "false"}, args: []string{"--env=production", "--auth.password=s3cret"}, want: false},
+		{name: "flag without a value", args: []string{"--auth.cookie.secure"}, want: true},
+		{name: "flag over env", env: map[string]string{"COOKIE_SECURE": "true"}, args: []string{"--auth.cookie.secure=false"}, want: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadTest(t, test.env, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Auth.Cookie.Secure == nil || *config.Auth.Cookie.Secure != test.want {
+				t.Errorf("got auth.cookie.secure %v, want %v", config.Auth.Cookie.Secure, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadTextUnmarshalers(t *testing.T) {
+	file := writeConfigFile(t, "config.yaml", "cache:\n  ttl: 1m\napi:\n  v1_deprecated: 2026-01-01\n")
+
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want func(*Config) bool
+	}{
+		{
+			name: "duration from the file",
+			args: []string{"--config=" + file},
+			want: func(c *Config) bool { return c.Cache.TTL == Duration(time.Minute) },
+		},
+		{
+			name: "duration from env",
+			env:  map[string]string{"CACHE_TTL": "5m"},
+			args: []string{"--config=" + file},
+			want: func(c *Config) bool { return c.Cache.TTL == Duration(5*time.Minute) },
+		},
+		{
+			name: "log level",
+			env:  map[string]string{"LOG_LEVEL": "debug"},
+			want: func(c *Config) bool { return c.Log.Level == slog.LevelDebug },
+		},
+		{
+			name: "dates from the file and a flag",
+			args: []string{"--config=" + file, "--api.v1_sunset=2026-07-01T12:00:00Z"},
+			want: func(c *Config) bool {
+				return time.Time(c.API.V1Deprecated).Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) &&
+					time.Time(c.API.V1Sunset).Equal(time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC))
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadTest(t, test.env, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.want(config) {
+				t.Errorf("got cache.ttl %v, log.level %v, api %+v", config.Cache.TTL, config.Log.Level, config.API)
+			}
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "int from env", env: map[string]string{"CACHE_SIZE": "lots"}, want: `invalid CACHE_SIZE "lots"`},
+		{name: "pointer from env", env: map[string]string{"COOKIE_SECURE": "maybe"}, want: `invalid COOKIE_SECURE "maybe"`},
+		{name: "duration from a flag", args: []string{"--cache.ttl=soon"}, want: `invalid --cache.ttl "soon"`},
+		{name: "date from env", env: map[string]string{"API_V1_DEPRECATED": "someday"}, want: `invalid API_V1_DEPRECATED "someday"`},
+		{name: "unknown key in the file", args: []string{"--config=" + writeConfigFile(t, "typo.yaml", "cache:\n  sise: 10\n")}, want: "sise"},
+		{name: "unknown file type", args: []string{"--config=" + writeConfigFile(t, "config.json", "{}")}, want: "must end in .yaml, .yml or .toml"},
+		{name: "out of range", args: []string{"--cache.size=-1"}, want: "cache.size must not be negative"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadTest(t, test.env, test.args...)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadArgs(t *testing.T) {
+	_, rest, err := Load([]string{"--cache.size=5", "openapi", "out.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rest, []string{"openapi", "out.json"}) {
+		t.Errorf("got %q, want the command after the flags", rest)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{name: "set", password: "s3cret", want: "REDACTED"},
+		{name: "empty", password: "", want: ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := Default()
+			config.Auth.Password = test.password
+			config.RateLimit.Keys = test.password
+			config.Cache.Size = 5
+
+			redacted := config.Redacted()
+			if redacted.Auth.Password != test.want || redacted.RateLimit.Keys != test.want {
+				t.Errorf("got password %q and keys %q, want %q", redacted.Auth.Password, redacted.RateLimit.Keys, test.want)
+			}
+			if redacted.Cache.Size != 5 {
+				t.Errorf("got cache.size %d, want other settings kept", redacted.Cache.Size)
+			}
+			if config.Auth.Password != test.password {
+				t.Errorf("redacting changed the original password to %q", config.Auth.Password)
+			}
+		})
+	}
+}
+
+func TestChanged(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{name: "nothing", change: func(*Config) {}},
+		{name: "int", change: func(c *Config) { c.Cache.Size = 1 }, want: []string{"cache.size"}},
+		{name: "list", change: func(c *Config) { c.OIDC.Scopes = []string{"openid"} }, want: []string{"oidc.scopes"}},
+		{name: "date", change: func(c *Config) { c.API.V1Sunset = Date(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) }, want: []string{"api.v1_sunset"}},
+		{
+			name: "pointer to the same value",
+			change: func(c *Config) {
+				secure := false
+				c.Auth.Cookie.Secure = &secure
+			},
+		},
+		{
+			name: "several",
+			change: func(c *Config) {
+				c.Log.Level = slog.LevelDebug
+				c.Cache.TTL = 0
+			},
+			want: []string{"log.level", "cache.ttl"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			before := Default()
+			secure := false
+			before.Auth.Cookie.Secure = &secure
+
+			after := Default()
+			after.Auth.Cookie.Secure = &secure
+			test.change(&after)
+
+			if got := after.Changed(&before); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
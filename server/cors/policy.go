@@ -0,0 +1,106 @@
+// Package cors describes which browser origins may call the API.
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Policy is a CORS configuration. Origins are matched exactly, except for
+// entries of the form "https://*.example.com", which match any subdomain,
+// and "*", which matches every origin.
+type Policy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// DefaultPolicy allows the React development server to call the API with
+// cookies.
+func DefaultPolicy() Policy {
+	return Policy{
+		AllowedOrigins:   []string{"http://localhost:3000"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-CSRF-Token", "If-Match", "If-None-Match", "If-Modified-Since", "Idempotency-Key", "X-API-Key"},
+		ExposedHeaders:   []string{"Retry-After", "API-Version", "Deprecation", "Sunset", "Link", "ETag", "Last-Modified", "Idempotent-Replayed", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+}
+
+// Validate reports configurations that browsers would reject.
+func (p Policy) Validate() error {
+	if p.AllowCredentials {
+		for _, origin := range p.AllowedOrigins {
+			if origin == "*" {
+				return errors.New("cors: the * origin cannot be combined with credentials")
+			}
+		}
+	}
+	return nil
+}
+
+// AllowsOrigin reports whether origin may call the API.
+func (p Policy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+
+		// "https://*.example.com" matches "https://fleet.example.com".
+		if scheme, host, found := strings.Cut(allowed, "://*."); found {
+			prefix := scheme + "://"
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(host)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AllowsMethod reports whether a preflight for method should succeed.
+func (p Policy) AllowsMethod(method string) bool {
+	for _, allowed := range p.AllowedMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHeaders reports whether every header in the comma-separated
+// Access-Control-Request-Headers value is allowed.
+func (p Policy) AllowsHeaders(requested string) bool {
+	for _, header := range splitList(requested) {
+		found := false
+		for _, allowed := range p.AllowedHeaders {
+			if strings.EqualFold(allowed, header) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(value string) []string {
+	results := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			results = append(results, item)
+		}
+	}
+	return results
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+)
+
+// GetClientsByNames returns the named clients, keyed by name. Names that do
+// not exist are left out.
+func (env *Database) GetClientsByNames(ctx context.Context, names []string) (map[string]Client, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
+
+	results := make(map[string]Client, len(names))
+	for _, name := range names {
+		if x, found := env.clients[name]; found {
+			results[name] = x
+		}
+	}
+
+	return results, nil
+}
+
+// GetVehiclesByClients returns the VINs of each client's vehicles, keyed by
+// client
+func (env *Database) GetVehiclesByClients(ctx context.Context, clients []string) (map[string][]string, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
+
+	results := make(map[string][]string, len(clients))
+	for _, client := range clients {
+		results[client] = nil
+	}
+	for key := range env.vehicles {
+		client := env.vehicles[key].Client
+		if vins, wanted := results[client]; wanted {
+			results[client] = append(vins, env.vehicles[key].Vin)
+		}
+	}
+
+	return results, nil
+}
+
+// GetVehiclesByVins returns the vehicles with the given vins, keyed by vin.
+// Vins that do not exist are left out.
+func (env *Database) GetVehiclesByVins(ctx context.Context, vins []string) (map[string]Vehicle, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
+
+	results := make(map[string]Vehicle, len(vins))
+	for _, vin := range vins {
+		if x, found := env.vehicles[vin]; found {
+			results[vin] = x
+		}
+	}
+
+	return results, nil
+}
+
+// GetWeightsByVins returns the weights of each vehicle, keyed by vin. Vins
+// without weights are left out.
+func (env *Database) GetWeightsByVins(ctx context.Context, vins []string) (map[string][]Weight, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
+
+	results := make(map[string][]Weight, len(vins))
+	for _, vin := range vins {
+		if x, found := env.weight[vin]; found {
+			results[vin] = x
+		}
+	}
+
+	return results, nil
+}
@@ -1,13 +1,23 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"time"
 )
 
 // GetAllClients returns a list of all available clients
-func (env *Database) GetAllClients() (*[]Client, error) {
-	time.Sleep(time.Millisecond * 750)
+func (env *Database) GetAllClients(ctx context.Context) (*[]Client, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
 
 	var results []Client
 	for key := range env.clients {
@@ -18,13 +28,44 @@ func (env *Database) GetAllClients() (*[]Client, error) {
 }
 
 // GetClientsByName returns the client given its name
-func (env *Database) GetClientsByName(params string) (*Client, error) {
-	time.Sleep(time.Millisecond * 750)
+func (env *Database) GetClientsByName(ctx context.Context, params string) (*Client, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
 
 	if x, found := env.clients[params]; found {
 		return &x, nil
 	}
 
-	return nil, errors.New("client does not exist")
+	return nil, notFound("client does not exist")
+
+}
+
+// SaveClient creates or replaces a client
+func (env *Database) SaveClient(ctx context.Context, client Client) error {
+	if err := latency(ctx); err != nil {
+		return err
+	}
+
+	if client.Name == "" {
+		return errors.New("client name is required")
+	}
+
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	if env.closed {
+		return ErrClosed
+	}
 
+	client.Updated = time.Now().UTC()
+	env.clients[client.Name] = client
+	return nil
 }
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"sync"
+)
+
+// Coalesced is a Store that lets concurrent callers asking for the same key
+// share one backend call. Each caller still returns as soon as its own context
+// is cancelled; the shared call is only cancelled once every caller waiting on
+// it has given up. Results are shared between callers and must not be
+// modified. A write stops later callers from joining a call that began before
+// it, so nobody who asks after a write is answered from before it. Batch
+// reads, Ping and Close go straight to the wrapped store.
+type Coalesced struct {
+	Store
+	group flightGroup
+}
+
+// NewCoalesced wraps store with in-flight deduplication of reads.
+func NewCoalesced(store Store) *Coalesced {
+	return &Coalesced{Store: store}
+}
+
+// Keys under which each read is shared.
+func allClientsFlight() string                  { return "clients" }
+func clientFlight(name string) string           { return "client:" + name }
+func clientVehiclesFlight(client string) string { return "client-vehicles:" + client }
+func vehicleFlight(vin string) string           { return "vehicle:" + vin }
+func weightsFlight(vin string) string           { return "weights:" + vin }
+
+// GetAllClients returns a list of all available clients
+func (env *Coalesced) GetAllClients(ctx context.Context) (*[]Client, error) {
+	return coalesce(ctx, &env.group, allClientsFlight(), env.Store.GetAllClients)
+}
+
+// GetClientsByName returns the client given its name
+func (env *Coalesced) GetClientsByName(ctx context.Context, params string) (*Client, error) {
+	return coalesce(ctx, &env.group, clientFlight(params), func(ctx context.Context) (*Client, error) {
+		return env.Store.GetClientsByName(ctx, params)
+	})
+}
+
+// GetVehiclesByClient returns a list of VINs associated with a client
+func (env *Coalesced) GetVehiclesByClient(ctx context.Context, client string) (*[]string, error) {
+	return coalesce(ctx, &env.group, clientVehiclesFlight(client), func(ctx context.Context) (*[]string, error) {
+		return env.Store.GetVehiclesByClient(ctx, client)
+	})
+}
+
+// GetVehicleByVin returns the vehicle given its vin
+func (env *Coalesced) GetVehicleByVin(ctx context.Context, params string) (*Vehicle, error) {
+	return coalesce(ctx, &env.group, vehicleFlight(params), func(ctx context.Context) (*Vehicle, error) {
+		return env.Store.GetVehicleByVin(ctx, params)
+	})
+}
+
+// GetWeightsByVin returns the weights of a vehicle given its vin
+func (env *Coalesced) GetWeightsByVin(ctx context.Context, params string) (*[]Weight, error) {
+	return coalesce(ctx, &env.group, weightsFlight(params), func(ctx context.Context) (*[]Weight, error) {
+		return env.Store.GetWeightsByVin(ctx, params)
+	})
+}
+
+// SaveClient creates or replaces a client
+func (env *Coalesced) SaveClient(ctx context.Context, client Client) error {
+	err := env.Store.SaveClient(ctx, client)
+	env.group.forget(allClientsFlight(), clientFlight(client.Name))
+	return err
+}
+
+// SaveVehicle creates or replaces a vehicle
+func (env *Coalesced) SaveVehicle(ctx context.Context, vehicle Vehicle) (*Vehicle, error) {
+	previous, err := env.Store.SaveVehicle(ctx, vehicle)
+	env.group.forget(allClientsFlight(), vehicleFlight(vehicle.Vin), clientFlight(vehicle.Client), clientVehiclesFlight(vehicle.Client))
+	if previous != nil {
+		env.group.forget(clientFlight(previous.Client), clientVehiclesFlight(previous.Client))
+	}
+	return previous, err
+}
+
+// AddWeight records a new weight reading for a vehicle
+func (env *Coalesced) AddWeight(ctx context.Context, weight Weight) error {
+	err := env.Store.AddWeight(ctx, weight)
+	env.group.forget(weightsFlight(weight.Vin))
+	return err
+}
+
+// flightGroup tracks the backend calls currently in flight, by key.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	value   any
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// coalesce runs load for key, or joins the call already running for it.
+func coalesce[T any](ctx context.Context, g *flightGroup, key string, load func(context.Context) (*T, error)) (*T, error) {
+	value, err := g.do(ctx, key, func(ctx context.Context) (any, error) {
+		return load(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*T), nil
+}
+
+func (g *flightGroup) do(ctx context.Context, key string, load func(context.Context) (any, error)) (any, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+
+	f, found := g.calls[key]
+	if !found {
+		// The shared call must outlive the caller that happened to start it.
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = f
+
+		go func() {
+			f.value, f.err = load(callCtx)
+
+			g.mu.Lock()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody is waiting any more, so stop the backend call and let
+			// the next caller start a fresh one.
+			f.cancel()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// forget makes the next caller for each key start a new call rather than join
+// the one in flight. Callers already waiting still get its result.
+func (g *flightGroup) forget(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowStore answers GetClientsByName once release is closed, with the client
+// as it was when the call began, and counts the calls and the ones cancelled
+// before they were answered. A cancelled call returns once stall, if set, is
+// closed.
+type slowStore struct {
+	Store
+
+	mu        sync.Mutex
+	client    Client
+	calls     atomic.Int32
+	cancelled atomic.Int32
+	release   chan struct{}
+	stall     chan struct{}
+}
+
+func (s *slowStore) GetClientsByName(ctx context.Context, name string) (*Client, error) {
+	s.mu.Lock()
+	client := s.client
+	release := s.release
+	s.mu.Unlock()
+	s.calls.Add(1)
+
+	select {
+	case <-release:
+		return &client, nil
+	case <-ctx.Done():
+		s.cancelled.Add(1)
+		if s.stall != nil {
+			<-s.stall
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *slowStore) SaveClient(ctx context.Context, client Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+	return nil
+}
+
+func TestCoalescedSharesOneCall(t *testing.T) {
+	slow := &slowStore{client: Client{Name: "CIA"}, release: make(chan struct{})}
+	store := NewCoalesced(slow)
+
+	var wg sync.WaitGroup
+	var answered atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if client, err := store.GetClientsByName(context.Background(), "CIA"); err == nil && client.Name == "CIA" {
+				answered.Add(1)
+			}
+		}()
+	}
+
+	// Let every caller join before the call returns.
+	for store.waiters("client:CIA") < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	close(slow.release)
+	wg.Wait()
+
+	if answered.Load() != 10 || slow.calls.Load() != 1 {
+		t.Errorf("%d callers answered by %d calls, want 10 by 1", answered.Load(), slow.calls.Load())
+	}
+}
+
+func TestCoalescedWriteStartsNewCall(t *testing.T) {
+	stale := make(chan struct{})
+	slow := &slowStore{client: Client{Name: "CIA", ContactName: "Jane"}, release: stale}
+	store := NewCoalesced(slow)
+	ctx := context.Background()
+
+	before := make(chan *Client, 1)
+	go func() {
+		client, _ := store.GetClientsByName(ctx, "CIA")
+		before <- client
+	}()
+	for store.waiters("client:CIA") < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	fresh := make(chan struct{})
+	close(fresh)
+	slow.mu.Lock()
+	slow.release = fresh
+	slow.mu.Unlock()
+	if err := store.SaveClient(ctx, Client{Name: "CIA", ContactName: "Stan"}); err != nil {
+		t.Fatal(err)
+	}
+
+	after := make(chan *Client, 1)
+	go func() {
+		client, _ := store.GetClientsByName(ctx, "CIA")
+		after <- client
+	}()
+	select {
+	case client := <-after:
+		if client == nil || client.ContactName != "Stan" {
+			t.Errorf("a read after the write got %+v, want contact Stan", client)
+		}
+	case <-time.After(time.Second):
+		t.Error("a read after the write joined the read that began before it")
+	}
+
+	close(stale)
+	if client := <-before; client == nil || client.ContactName != "Jane" {
+		t.Errorf("the read before the write got %+v, want contact Jane", client)
+	}
+}
+
+// lookup is the result of a GetClientsByName call made in the background.
+type lookup struct {
+	client *Client
+	err    error
+}
+
+// startLookup calls GetClientsByName for CIA in the background, and returns
+// once the caller is waiting on the shared call.
+func startLookup(t *testing.T, store *Coalesced, ctx context.Context) <-chan lookup {
+	t.Helper()
+	waiting := store.waiters("client:CIA")
+	result := make(chan lookup, 1)
+	go func() {
+		client, err := store.GetClientsByName(ctx, "CIA")
+		result <- lookup{client, err}
+	}()
+	waitFor(t, "the caller to join", func() bool { return store.waiters("client:CIA") > waiting })
+	return result
+}
+
+// waitFor waits until cond holds, failing the test if it doesn't within a
+// second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receive returns the result of a lookup, failing the test if it doesn't
+// arrive within a second.
+func receive(t *testing.T, result <-chan lookup) lookup {
+	t.Helper()
+	select {
+	case got := <-result:
+		return got
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a caller to return")
+		return lookup{}
+	}
+}
+
+func TestCoalescedCancelsWhenLastWaiterLeaves(t *testing.T) {
+	// The cancelled call is held up in the backend, so only the caller
+	// leaving can have made way for the next one.
+	slow := &slowStore{client: Client{Name: "CIA"}, release: make(chan struct{}), stall: make(chan struct{})}
+	defer close(slow.stall)
+	store := NewCoalesced(slow)
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	defer cancelFirst()
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	first := startLookup(t, store, firstCtx)
+	second := startLookup(t, store, secondCtx)
+
+	// The first caller leaves at once, but the call carries on for the
+	// second.
+	cancelFirst()
+	if got := receive(t, first); !errors.Is(got.err, context.Canceled) {
+		t.Errorf("the first caller got %+v, want context.Canceled", got)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if slow.cancelled.Load() != 0 || store.waiters("client:CIA") != 1 {
+		t.Fatalf("after one of two callers left, %d calls were cancelled with %d waiting, want 0 with 1",
+			slow.cancelled.Load(), store.waiters("client:CIA"))
+	}
+
+	// Once the second leaves too, nobody wants the answer.
+	cancelSecond()
+	if got := receive(t, second); !errors.Is(got.err, context.Canceled) {
+		t.Errorf("the second caller got %+v, want context.Canceled", got)
+	}
+	waitFor(t, "the shared call to be cancelled", func() bool { return slow.cancelled.Load() == 1 })
+
+	// The next caller starts a fresh call rather than joining the cancelled
+	// one.
+	third := startLookup(t, store, context.Background())
+	close(slow.release)
+	if got := receive(t, third); got.err != nil || got.client == nil || got.client.Name != "CIA" {
+		t.Errorf("the next caller got %+v, want the client", got)
+	}
+	if slow.calls.Load() != 2 {
+		t.Errorf("got %d calls, want 2", slow.calls.Load())
+	}
+}
+
+func TestCoalescedOutlivesTheCallerThatStartedIt(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		leave int // the caller that gives up, in the order they joined
+	}{
+		{name: "starter leaves", leave: 0},
+		{name: "joiner leaves", leave: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			slow := &slowStore{client: Client{Name: "CIA"}, release: make(chan struct{})}
+			store := NewCoalesced(slow)
+
+			var results [2]<-chan lookup
+			var cancels [2]context.CancelFunc
+			for i := range results {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				cancels[i] = cancel
+				results[i] = startLookup(t, store, ctx)
+			}
+
+			cancels[test.leave]()
+			if got := receive(t, results[test.leave]); !errors.Is(got.err, context.Canceled) {
+				t.Errorf("the caller that left got %+v, want context.Canceled", got)
+			}
+
+			close(slow.release)
+			stay := 1 - test.leave
+			if got := receive(t, results[stay]); got.err != nil || got.client == nil || got.client.Name != "CIA" {
+				t.Errorf("the caller that stayed got %+v, want the client", got)
+			}
+			if slow.calls.Load() != 1 || slow.cancelled.Load() != 0 {
+				t.Errorf("got %d calls with %d cancelled, want 1 uncancelled", slow.calls.Load(), slow.cancelled.Load())
+			}
+		})
+	}
+}
+
+// waiters returns how many callers are waiting on the call for key.
+func (env *Coalesced) waiters(key string) int {
+	env.group.mu.Lock()
+	defer env.group.mu.Unlock()
+
+	if f, found := env.group.calls[key]; found {
+		return f.waiters
+	}
+	return 0
+}
@@ -1,16 +1,121 @@
 package database
 
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by every method once the store has been closed.
+var ErrClosed = errors.New("database is closed")
+
+// ErrNotFound is matched, with errors.Is, by the errors returned for clients,
+// vehicles and weights that do not exist.
+var ErrNotFound = errors.New("not found")
+
+// notFound is the error for a record that does not exist.
+type notFound string
+
+func (e notFound) Error() string {
+	return string(e)
+}
+
+func (e notFound) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// Store is the set of operations the API needs from a data store. Database
+// is the in-memory implementation. The batch reads look up many keys in one
+// round trip and leave out keys that do not exist.
+type Store interface {
+	GetAllClients(ctx context.Context) (*[]Client, error)
+	GetClientsByName(ctx context.Context, params string) (*Client, error)
+	GetVehiclesByClient(ctx context.Context, client string) (*[]string, error)
+	GetVehicleByVin(ctx context.Context, params string) (*Vehicle, error)
+	GetWeightsByVin(ctx context.Context, params string) (*[]Weight, error)
+	GetClientsByNames(ctx context.Context, names []string) (map[string]Client, error)
+	GetVehiclesByClients(ctx context.Context, clients []string) (map[string][]string, error)
+	GetVehiclesByVins(ctx context.Context, vins []string) (map[string]Vehicle, error)
+	GetWeightsByVins(ctx context.Context, vins []string) (map[string][]Weight, error)
+	SaveClient(ctx context.Context, client Client) error
+	SaveVehicle(ctx context.Context, vehicle Vehicle) (*Vehicle, error)
+	AddWeight(ctx context.Context, weight Weight) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
 type Database struct {
+	mu       sync.RWMutex
+	closed   bool
 	clients  map[string]Client
 	vehicles map[string]Vehicle
 	weight   map[string][]Weight
 }
 
-func New() (*Database, error) {
+// Open loads the dataset and returns a store meant to be shared for the
+// lifetime of the server.
+func Open() (*Database, error) {
 	database := getdata()
+
+	// The sample data has no history, so it dates from when it was loaded.
+	now := time.Now().UTC()
+	for key, client := range database.clients {
+		client.Updated = now
+		database.clients[key] = client
+	}
+	for key, vehicle := range database.vehicles {
+		vehicle.Updated = now
+		database.vehicles[key] = vehicle
+	}
+	for key, weights := range database.weight {
+		for i := range weights {
+			weights[i].Time = now
+		}
+		database.weight[key] = weights
+	}
+
 	return database, nil
 }
 
+// latency simulates the round trip to a real database. It returns early with
+// the context's error if ctx is cancelled first.
+func latency(ctx context.Context) error {
+	timer := time.NewTimer(time.Millisecond * 750)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ping reports whether the store can serve requests.
+func (env *Database) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close releases the store. Calls made after Close return ErrClosed.
+func (env *Database) Close() error {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	env.closed = true
+	return nil
+}
+
 func getdata() *Database {
 	return &Database{
 		clients: map[string]Client{
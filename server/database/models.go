@@ -1,18 +1,23 @@
 package database
 
+import "time"
+
 type Client struct {
 	Name         string
 	ContactName  string
 	ContactEmail string
+	Updated      time.Time // when the client or its list of vehicles last changed
 }
 
 type Vehicle struct {
 	Vin     string
 	Client  string
 	Mileage int
+	Updated time.Time
 }
 
 type Weight struct {
 	Vin    string
 	Weight float32
+	Time   time.Time
 }
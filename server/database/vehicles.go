@@ -1,13 +1,23 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"time"
 )
 
 // GetVehiclesByClient returns a list of VINs associated with a client
-func (env *Database) GetVehiclesByClient(client string) (*[]string, error) {
-	time.Sleep(time.Millisecond * 750)
+func (env *Database) GetVehiclesByClient(ctx context.Context, client string) (*[]string, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
 
 	var results []string
 	for key := range env.vehicles {
@@ -20,12 +30,71 @@ func (env *Database) GetVehiclesByClient(client string) (*[]string, error) {
 }
 
 // GetVehicleByName returns the vehilc given its vin
-func (env *Database) GetVehicleByVin(params string) (*Vehicle, error) {
-	time.Sleep(time.Millisecond * 750)
+func (env *Database) GetVehicleByVin(ctx context.Context, params string) (*Vehicle, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
 
 	if x, found := env.vehicles[params]; found {
 		return &x, nil
 	}
 
-	return nil, errors.New("vehicle does not exist")
+	return nil, notFound("vehicle does not exist")
+}
+
+// SaveVehicle creates or replaces a vehicle and returns the vehicle it
+// replaced, if any
+func (env *Database) SaveVehicle(ctx context.Context, vehicle Vehicle) (*Vehicle, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	if vehicle.Vin == "" {
+		return nil, errors.New("vehicle vin is required")
+	}
+
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
+
+	if _, found := env.clients[vehicle.Client]; !found {
+		return nil, notFound("client does not exist")
+	}
+
+	vehicle.Updated = time.Now().UTC()
+	previous, found := env.vehicles[vehicle.Vin]
+	env.vehicles[vehicle.Vin] = vehicle
+
+	// A client changes when its list of vehicles does, so the owners a new
+	// or moved vehicle joins and leaves are updated too.
+	if !found || previous.Client != vehicle.Client {
+		env.touchClient(vehicle.Client, vehicle.Updated)
+		if found {
+			env.touchClient(previous.Client, vehicle.Updated)
+		}
+	}
+
+	if found {
+		return &previous, nil
+	}
+	return nil, nil
+}
+
+// touchClient sets when the named client last changed. The caller must hold
+// env.mu.
+func (env *Database) touchClient(name string, updated time.Time) {
+	if client, found := env.clients[name]; found {
+		client.Updated = updated
+		env.clients[name] = client
+	}
 }
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSaveVehicleUpdatesItsOwners(t *testing.T) {
+	then := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &Database{
+		clients: map[string]Client{
+			"CIA": {Name: "CIA", Updated: then},
+			"FBI": {Name: "FBI", Updated: then},
+			"NSA": {Name: "NSA", Updated: then},
+		},
+		vehicles: map[string]Vehicle{"1A": {Vin: "1A", Client: "CIA", Updated: then}},
+		weight:   map[string][]Weight{},
+	}
+
+	// Moving 1A changes both owners' lists, and no one else's.
+	if _, err := db.SaveVehicle(context.Background(), Vehicle{Vin: "1A", Client: "FBI"}); err != nil {
+		t.Fatal(err)
+	}
+	moved := db.vehicles["1A"].Updated
+	for name, want := range map[string]time.Time{"CIA": moved, "FBI": moved, "NSA": then} {
+		if got := db.clients[name].Updated; !got.Equal(want) {
+			t.Errorf("%s was updated at %v, want %v", name, got, want)
+		}
+	}
+}
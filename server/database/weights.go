@@ -1,17 +1,53 @@
 package database
 
 import (
-	"errors"
+	"context"
 	"time"
 )
 
 // GetWeightsByVin returns the weights of a vehicle given its vin
-func (env *Database) GetWeightsByVin(params string) (*[]Weight, error) {
-	time.Sleep(time.Millisecond * 750)
+func (env *Database) GetWeightsByVin(ctx context.Context, params string) (*[]Weight, error) {
+	if err := latency(ctx); err != nil {
+		return nil, err
+	}
+
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	if env.closed {
+		return nil, ErrClosed
+	}
 
 	if x, found := env.weight[params]; found {
 		return &x, nil
 	}
 
-	return nil, errors.New("vehicle weights do not exist")
+	return nil, notFound("vehicle weights do not exist")
+}
+
+// AddWeight records a new weight reading for a vehicle
+func (env *Database) AddWeight(ctx context.Context, weight Weight) error {
+	if err := latency(ctx); err != nil {
+		return err
+	}
+
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	if env.closed {
+		return ErrClosed
+	}
+
+	if _, found := env.vehicles[weight.Vin]; !found {
+		return notFound("vehicle does not exist")
+	}
+
+	if weight.Time.IsZero() {
+		weight.Time = time.Now().UTC()
+	}
+
+	// Readers may still hold the previous slice, so always append to a copy.
+	existing := env.weight[weight.Vin]
+	env.weight[weight.Vin] = append(existing[:len(existing):len(existing)], weight)
+	return nil
 }
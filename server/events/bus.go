@@ -0,0 +1,198 @@
+// Package events is the in-process pub/sub bus that carries changes made
+// through the store to live subscribers.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by Store.
+const (
+	WeightAdded    = "weight.added"
+	ClientSaved    = "client.saved"
+	VehicleSaved   = "vehicle.saved"
+	VehicleAdded   = "vehicle.added"
+	MileageChanged = "vehicle.mileage_changed"
+	Overweight     = "violation.overweight"
+)
+
+// Event is a single change. ID increases by one for every event published on
+// a bus, so subscribers can resume after the last ID they saw.
+type Event struct {
+	ID     uint64    `json:"id"`
+	Type   string    `json:"type"`
+	Client string    `json:"client,omitempty"`
+	Vin    string    `json:"vin,omitempty"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data"`
+}
+
+// Bus delivers published events to every matching subscription and keeps the
+// most recent ones for replay.
+type Bus struct {
+	mu       sync.Mutex
+	nextID   uint64
+	replay   []Event
+	capacity int
+	subs     map[*Subscription]struct{}
+	closed   bool
+	now      func() time.Time
+}
+
+// Subscription receives the events matching its filter on C. C is closed
+// when the subscription is closed, when the bus is closed, or when the
+// subscriber falls so far behind that its buffer fills up; Dropped reports
+// the last case.
+type Subscription struct {
+	C <-chan Event
+
+	bus     *Bus
+	ch      chan Event
+	filter  func(Event) bool
+	dropped bool
+	gap     bool
+	start   uint64
+}
+
+// NewBus returns a bus that keeps the last replaySize events for replay.
+func NewBus(replaySize int) *Bus {
+	return &Bus{
+		nextID:   1,
+		capacity: replaySize,
+		subs:     make(map[*Subscription]struct{}),
+		now:      time.Now,
+	}
+}
+
+// Publish assigns the event its ID and time, records it for replay and
+// delivers it to every matching subscription without blocking.
+func (b *Bus) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event.ID = b.nextID
+	b.nextID++
+	if event.Time.IsZero() {
+		event.Time = b.now().UTC()
+	}
+
+	if b.capacity > 0 {
+		if len(b.replay) == b.capacity {
+			copy(b.replay, b.replay[1:])
+			b.replay = b.replay[:len(b.replay)-1]
+		}
+		b.replay = append(b.replay, event)
+	}
+
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			// The subscriber can't keep up. Cut it off rather than block
+			// every publisher; it can resume from the replay buffer.
+			sub.dropped = true
+			b.remove(sub)
+		}
+	}
+
+	return event
+}
+
+// Subscribe returns a subscription to the events matching filter, buffering
+// up to buffer events.
+func (b *Bus) Subscribe(filter func(Event) bool, buffer int) *Subscription {
+	sub, _ := b.subscribe(filter, buffer, 0, false)
+	return sub
+}
+
+// SubscribeAfter is like Subscribe, but also returns the matching events
+// after afterID that are still held for replay. Subscribing and collecting
+// the replay happen atomically, so no event is missed or repeated between
+// the two. When some of the events after afterID are no longer held, Gap
+// reports it.
+func (b *Bus) SubscribeAfter(filter func(Event) bool, buffer int, afterID uint64) (*Subscription, []Event) {
+	return b.subscribe(filter, buffer, afterID, true)
+}
+
+func (b *Bus) subscribe(filter func(Event) bool, buffer int, afterID uint64, replay bool) (*Subscription, []Event) {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, bus: b, ch: ch, filter: filter}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return sub, nil
+	}
+
+	sub.start = b.nextID - 1
+
+	var events []Event
+	if replay {
+		// The events from afterID up to the oldest one held have been dropped,
+		// and an ID past the last one published comes from before a restart.
+		oldest := b.nextID
+		if len(b.replay) > 0 {
+			oldest = b.replay[0].ID
+		}
+		sub.gap = afterID+1 < oldest || afterID > sub.start
+
+		for _, event := range b.replay {
+			if event.ID > afterID && (filter == nil || filter(event)) {
+				events = append(events, event)
+			}
+		}
+	}
+
+	b.subs[sub] = struct{}{}
+	return sub, events
+}
+
+// Close closes every subscription and stops accepting new ones.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.remove(s)
+}
+
+// Dropped reports whether the subscription was closed because it fell behind.
+func (s *Subscription) Dropped() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	return s.dropped
+}
+
+// Gap reports whether a subscription from SubscribeAfter missed events that
+// had already left the replay buffer, and the ID of the last event published
+// before it started. A subscriber that refetches what it has missed can carry
+// on from that ID.
+func (s *Subscription) Gap() (uint64, bool) {
+	return s.start, s.gap
+}
+
+// remove closes sub if it is still subscribed. The caller must hold b.mu.
+func (b *Bus) remove(sub *Subscription) {
+	if _, found := b.subs[sub]; found {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
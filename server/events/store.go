@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/byron-ojua/starter-project/database"
+)
+
+// Store is a database.Store that publishes an event on bus after every
+// successful write. Reads, Ping and Close go straight to the wrapped store.
+type Store struct {
+	database.Store
+	bus *Bus
+
+	// OverweightThreshold is the reading above which an Overweight event is
+	// published as well. Zero disables it.
+	OverweightThreshold float32
+}
+
+// DefaultOverweightThreshold is the US federal gross vehicle weight limit,
+// in pounds.
+const DefaultOverweightThreshold = 80000
+
+// NewStore wraps store so its writes are published on bus.
+func NewStore(store database.Store, bus *Bus) *Store {
+	return &Store{Store: store, bus: bus, OverweightThreshold: DefaultOverweightThreshold}
+}
+
+// SaveClient creates or replaces a client
+func (s *Store) SaveClient(ctx context.Context, client database.Client) error {
+	if err := s.Store.SaveClient(ctx, client); err != nil {
+		return err
+	}
+
+	s.bus.Publish(Event{Type: ClientSaved, Client: client.Name, Data: client})
+	return nil
+}
+
+// SaveVehicle creates or replaces a vehicle
+func (s *Store) SaveVehicle(ctx context.Context, vehicle database.Vehicle) (*database.Vehicle, error) {
+	previous, err := s.Store.SaveVehicle(ctx, vehicle)
+	if err != nil {
+		return previous, err
+	}
+
+	s.bus.Publish(Event{Type: VehicleSaved, Client: vehicle.Client, Vin: vehicle.Vin, Data: vehicle})
+	if previous == nil || previous.Client != vehicle.Client {
+		s.bus.Publish(Event{Type: VehicleAdded, Client: vehicle.Client, Vin: vehicle.Vin, Data: vehicle})
+	}
+	if previous != nil && previous.Mileage != vehicle.Mileage {
+		s.bus.Publish(Event{Type: MileageChanged, Client: vehicle.Client, Vin: vehicle.Vin, Data: vehicle})
+	}
+	return previous, nil
+}
+
+// AddWeight records a new weight reading for a vehicle. The event names the
+// vehicle's owner so it reaches client-wide subscribers.
+func (s *Store) AddWeight(ctx context.Context, weight database.Weight) error {
+	if err := s.Store.AddWeight(ctx, weight); err != nil {
+		return err
+	}
+
+	var client string
+	if vehicle, err := s.Store.GetVehicleByVin(context.WithoutCancel(ctx), weight.Vin); err == nil {
+		client = vehicle.Client
+	} else {
+		slog.Warn("looking up the client of a weight's vehicle failed", "vin", weight.Vin, "err", err)
+	}
+
+	s.bus.Publish(Event{Type: WeightAdded, Client: client, Vin: weight.Vin, Time: weight.Time, Data: weight})
+	if s.OverweightThreshold > 0 && weight.Weight > s.OverweightThreshold {
+		s.bus.Publish(Event{Type: Overweight, Client: client, Vin: weight.Vin, Time: weight.Time, Data: weight})
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+// Package fleetpb holds the gRPC service definitions generated from
+// fleet.proto.
+package fleetpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative fleet.proto
@@ -0,0 +1,452 @@
+// The fleet API over gRPC. Messages mirror the JSON bodies of the REST
+// routes field for field, so both APIs return the same data.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: fleet.proto
+
+package fleetpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ClientService_ListClients_FullMethodName        = "/fleet.v1.ClientService/ListClients"
+	ClientService_GetClient_FullMethodName          = "/fleet.v1.ClientService/GetClient"
+	ClientService_ListClientVehicles_FullMethodName = "/fleet.v1.ClientService/ListClientVehicles"
+)
+
+// ClientServiceClient is the client API for ClientService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ClientServiceClient interface {
+	// Every client and the number of vehicles they have.
+	ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error)
+	// A client by name.
+	GetClient(ctx context.Context, in *GetClientRequest, opts ...grpc.CallOption) (*Client, error)
+	// A client's vehicles with their mileage and largest weight.
+	ListClientVehicles(ctx context.Context, in *ListClientVehiclesRequest, opts ...grpc.CallOption) (*ListClientVehiclesResponse, error)
+}
+
+type clientServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClientServiceClient(cc grpc.ClientConnInterface) ClientServiceClient {
+	return &clientServiceClient{cc}
+}
+
+func (c *clientServiceClient) ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListClientsResponse)
+	err := c.cc.Invoke(ctx, ClientService_ListClients_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clientServiceClient) GetClient(ctx context.Context, in *GetClientRequest, opts ...grpc.CallOption) (*Client, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Client)
+	err := c.cc.Invoke(ctx, ClientService_GetClient_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clientServiceClient) ListClientVehicles(ctx context.Context, in *ListClientVehiclesRequest, opts ...grpc.CallOption) (*ListClientVehiclesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListClientVehiclesResponse)
+	err := c.cc.Invoke(ctx, ClientService_ListClientVehicles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClientServiceServer is the server API for ClientService service.
+// All implementations must embed UnimplementedClientServiceServer
+// for forward compatibility.
+type ClientServiceServer interface {
+	// Every client and the number of vehicles they have.
+	ListClients(context.Context, *ListClientsRequest) (*ListClientsResponse, error)
+	// A client by name.
+	GetClient(context.Context, *GetClientRequest) (*Client, error)
+	// A client's vehicles with their mileage and largest weight.
+	ListClientVehicles(context.Context, *ListClientVehiclesRequest) (*ListClientVehiclesResponse, error)
+	mustEmbedUnimplementedClientServiceServer()
+}
+
+// UnimplementedClientServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedClientServiceServer struct{}
+
+func (UnimplementedClientServiceServer) ListClients(context.Context, *ListClientsRequest) (*ListClientsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClients not implemented")
+}
+func (UnimplementedClientServiceServer) GetClient(context.Context, *GetClientRequest) (*Client, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClient not implemented")
+}
+func (UnimplementedClientServiceServer) ListClientVehicles(context.Context, *ListClientVehiclesRequest) (*ListClientVehiclesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClientVehicles not implemented")
+}
+func (UnimplementedClientServiceServer) mustEmbedUnimplementedClientServiceServer() {}
+func (UnimplementedClientServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeClientServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClientServiceServer will
+// result in compilation errors.
+type UnsafeClientServiceServer interface {
+	mustEmbedUnimplementedClientServiceServer()
+}
+
+func RegisterClientServiceServer(s grpc.ServiceRegistrar, srv ClientServiceServer) {
+	// If the following call pancis, it indicates UnimplementedClientServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ClientService_ServiceDesc, srv)
+}
+
+func _ClientService_ListClients_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClientsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).ListClients(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClientService_ListClients_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).ListClients(ctx, req.(*ListClientsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClientService_GetClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).GetClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClientService_GetClient_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).GetClient(ctx, req.(*GetClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClientService_ListClientVehicles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClientVehiclesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).ListClientVehicles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClientService_ListClientVehicles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).ListClientVehicles(ctx, req.(*ListClientVehiclesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ClientService_ServiceDesc is the grpc.ServiceDesc for ClientService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ClientService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fleet.v1.ClientService",
+	HandlerType: (*ClientServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListClients",
+			Handler:    _ClientService_ListClients_Handler,
+		},
+		{
+			MethodName: "GetClient",
+			Handler:    _ClientService_GetClient_Handler,
+		},
+		{
+			MethodName: "ListClientVehicles",
+			Handler:    _ClientService_ListClientVehicles_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "fleet.proto",
+}
+
+const (
+	VehicleService_GetVehicle_FullMethodName = "/fleet.v1.VehicleService/GetVehicle"
+)
+
+// VehicleServiceClient is the client API for VehicleService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type VehicleServiceClient interface {
+	// A vehicle by VIN with its weights and owner.
+	GetVehicle(ctx context.Context, in *GetVehicleRequest, opts ...grpc.CallOption) (*Vehicle, error)
+}
+
+type vehicleServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVehicleServiceClient(cc grpc.ClientConnInterface) VehicleServiceClient {
+	return &vehicleServiceClient{cc}
+}
+
+func (c *vehicleServiceClient) GetVehicle(ctx context.Context, in *GetVehicleRequest, opts ...grpc.CallOption) (*Vehicle, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Vehicle)
+	err := c.cc.Invoke(ctx, VehicleService_GetVehicle_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// VehicleServiceServer is the server API for VehicleService service.
+// All implementations must embed UnimplementedVehicleServiceServer
+// for forward compatibility.
+type VehicleServiceServer interface {
+	// A vehicle by VIN with its weights and owner.
+	GetVehicle(context.Context, *GetVehicleRequest) (*Vehicle, error)
+	mustEmbedUnimplementedVehicleServiceServer()
+}
+
+// UnimplementedVehicleServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVehicleServiceServer struct{}
+
+func (UnimplementedVehicleServiceServer) GetVehicle(context.Context, *GetVehicleRequest) (*Vehicle, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVehicle not implemented")
+}
+func (UnimplementedVehicleServiceServer) mustEmbedUnimplementedVehicleServiceServer() {}
+func (UnimplementedVehicleServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeVehicleServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VehicleServiceServer will
+// result in compilation errors.
+type UnsafeVehicleServiceServer interface {
+	mustEmbedUnimplementedVehicleServiceServer()
+}
+
+func RegisterVehicleServiceServer(s grpc.ServiceRegistrar, srv VehicleServiceServer) {
+	// If the following call pancis, it indicates UnimplementedVehicleServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&VehicleService_ServiceDesc, srv)
+}
+
+func _VehicleService_GetVehicle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVehicleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VehicleServiceServer).GetVehicle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VehicleService_GetVehicle_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VehicleServiceServer).GetVehicle(ctx, req.(*GetVehicleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// VehicleService_ServiceDesc is the grpc.ServiceDesc for VehicleService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VehicleService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fleet.v1.VehicleService",
+	HandlerType: (*VehicleServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetVehicle",
+			Handler:    _VehicleService_GetVehicle_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "fleet.proto",
+}
+
+const (
+	WeightService_IngestWeights_FullMethodName = "/fleet.v1.WeightService/IngestWeights"
+	WeightService_WatchWeights_FullMethodName  = "/fleet.v1.WeightService/WatchWeights"
+)
+
+// WeightServiceClient is the client API for WeightService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WeightServiceClient interface {
+	// Records a stream of readings, for scales that upload in bulk. Readings
+	// are stored as they arrive; the first one that fails ends the stream.
+	IngestWeights(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestWeightRequest, IngestWeightsResponse], error)
+	// Streams new readings for a vehicle or for every vehicle a client owns.
+	WatchWeights(ctx context.Context, in *WatchWeightsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WeightReading], error)
+}
+
+type weightServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWeightServiceClient(cc grpc.ClientConnInterface) WeightServiceClient {
+	return &weightServiceClient{cc}
+}
+
+func (c *weightServiceClient) IngestWeights(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IngestWeightRequest, IngestWeightsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WeightService_ServiceDesc.Streams[0], WeightService_IngestWeights_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IngestWeightRequest, IngestWeightsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeightService_IngestWeightsClient = grpc.ClientStreamingClient[IngestWeightRequest, IngestWeightsResponse]
+
+func (c *weightServiceClient) WatchWeights(ctx context.Context, in *WatchWeightsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WeightReading], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WeightService_ServiceDesc.Streams[1], WeightService_WatchWeights_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchWeightsRequest, WeightReading]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeightService_WatchWeightsClient = grpc.ServerStreamingClient[WeightReading]
+
+// WeightServiceServer is the server API for WeightService service.
+// All implementations must embed UnimplementedWeightServiceServer
+// for forward compatibility.
+type WeightServiceServer interface {
+	// Records a stream of readings, for scales that upload in bulk. Readings
+	// are stored as they arrive; the first one that fails ends the stream.
+	IngestWeights(grpc.ClientStreamingServer[IngestWeightRequest, IngestWeightsResponse]) error
+	// Streams new readings for a vehicle or for every vehicle a client owns.
+	WatchWeights(*WatchWeightsRequest, grpc.ServerStreamingServer[WeightReading]) error
+	mustEmbedUnimplementedWeightServiceServer()
+}
+
+// UnimplementedWeightServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWeightServiceServer struct{}
+
+func (UnimplementedWeightServiceServer) IngestWeights(grpc.ClientStreamingServer[IngestWeightRequest, IngestWeightsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method IngestWeights not implemented")
+}
+func (UnimplementedWeightServiceServer) WatchWeights(*WatchWeightsRequest, grpc.ServerStreamingServer[WeightReading]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchWeights not implemented")
+}
+func (UnimplementedWeightServiceServer) mustEmbedUnimplementedWeightServiceServer() {}
+func (UnimplementedWeightServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeWeightServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WeightServiceServer will
+// result in compilation errors.
+type UnsafeWeightServiceServer interface {
+	mustEmbedUnimplementedWeightServiceServer()
+}
+
+func RegisterWeightServiceServer(s grpc.ServiceRegistrar, srv WeightServiceServer) {
+	// If the following call pancis, it indicates UnimplementedWeightServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WeightService_ServiceDesc, srv)
+}
+
+func _WeightService_IngestWeights_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WeightServiceServer).IngestWeights(&grpc.GenericServerStream[IngestWeightRequest, IngestWeightsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeightService_IngestWeightsServer = grpc.ClientStreamingServer[IngestWeightRequest, IngestWeightsResponse]
+
+func _WeightService_WatchWeights_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchWeightsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WeightServiceServer).WatchWeights(m, &grpc.GenericServerStream[WatchWeightsRequest, WeightReading]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeightService_WatchWeightsServer = grpc.ServerStreamingServer[WeightReading]
+
+// WeightService_ServiceDesc is the grpc.ServiceDesc for WeightService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WeightService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fleet.v1.WeightService",
+	HandlerType: (*WeightServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestWeights",
+			Handler:       _WeightService_IngestWeights_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchWeights",
+			Handler:       _WeightService_WatchWeights_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fleet.proto",
+}
@@ -0,0 +1,66 @@
+/*
+* @file frontend.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the handlers that serve the React frontend and the
+* login page templates, both embedded in the binary so it runs from any
+* working directory.
+ */
+
+package main
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/byron-ojua/starter-project/web"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+// loadTemplates parses the embedded login page templates.
+func loadTemplates() (*template.Template, error) {
+	return template.ParseFS(templateFiles, "templates/*.html")
+}
+
+// isFrontendPath reports whether path is under the frontend's prefix.
+func isFrontendPath(path string) bool {
+	return path == web.Prefix || strings.HasPrefix(path, web.Prefix+"/")
+}
+
+// serveFrontend serves the frontend's files for GET and HEAD requests
+// under its prefix that match no other route. It is the router's not-found
+// handler, so anything else still gets a plain 404.
+func serveFrontend(app *web.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isFrontendPath(c.Request.URL.Path) {
+			return
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		}
+
+		app.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// frontendConfig godoc
+// @Summary Get the frontend's settings
+// @Description Get the settings the React frontend reads when it starts, such as where the API is served
+// @Tags frontend
+// @Produce json
+// @Success 200 {object} web.Config
+// @Router /app/config.json [get]
+func frontendConfig(config web.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-cache")
+		c.IndentedJSON(http.StatusOK, config)
+	}
+}
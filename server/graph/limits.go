@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bounds the queries the schema will run. A limit of 0 is not
+// enforced.
+type Limits struct {
+	// MaxDepth is how deeply fields may be nested.
+	MaxDepth int
+
+	// MaxComplexity bounds the estimated number of objects a query
+	// returns. Each object field costs 1, and the cost of the fields below
+	// a list is multiplied by ListSize.
+	MaxComplexity int
+
+	// ListSize is the number of items a list is assumed to hold.
+	ListSize int
+}
+
+// DefaultLimits allows the nesting the schema needs for a client's vehicles'
+// weights with room to spare.
+var DefaultLimits = Limits{MaxDepth: 5, MaxComplexity: 1000, ListSize: 10}
+
+// check returns an error if the operation to run in document is over the
+// limits. Introspection fields are not counted.
+func (l Limits) check(schema *graphql.Schema, document *ast.Document, operationName string) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		return nil
+	}
+
+	root := schema.QueryType()
+	switch operation.Operation {
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	}
+
+	walker := costWalker{schema: schema, limits: l, fragments: fragments, visiting: make(map[string]bool)}
+	depth, complexity := walker.selections(root, operation.SelectionSet)
+
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", depth, l.MaxDepth)
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity)
+	}
+	return nil
+}
+
+// costWalker measures the depth and complexity of a selection set.
+type costWalker struct {
+	schema    *graphql.Schema
+	limits    Limits
+	fragments map[string]*ast.FragmentDefinition
+	visiting  map[string]bool
+}
+
+func (w costWalker) selections(parent *graphql.Object, set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil || parent == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, c = w.field(parent, selection)
+		case *ast.InlineFragment:
+			d, c = w.selections(w.condition(parent, selection.TypeCondition), selection.SelectionSet)
+		case *ast.FragmentSpread:
+			fragment, found := w.fragments[selection.Name.Value]
+			if !found || w.visiting[fragment.Name.Value] {
+				continue
+			}
+			w.visiting[fragment.Name.Value] = true
+			d, c = w.selections(w.condition(parent, fragment.TypeCondition), fragment.SelectionSet)
+			delete(w.visiting, fragment.Name.Value)
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (w costWalker) field(parent *graphql.Object, field *ast.Field) (depth, complexity int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+
+	definition, found := parent.Fields()[field.Name.Value]
+	if !found {
+		return 1, 0
+	}
+
+	fieldType := definition.Type
+	list := false
+	for {
+		switch wrapped := fieldType.(type) {
+		case *graphql.NonNull:
+			fieldType = wrapped.OfType
+			continue
+		case *graphql.List:
+			list = true
+			fieldType = wrapped.OfType
+			continue
+		}
+		break
+	}
+
+	object, isObject := fieldType.(*graphql.Object)
+	if !isObject {
+		return 1, 0
+	}
+
+	depth, complexity = w.selections(object, field.SelectionSet)
+	if list && w.limits.ListSize > 1 {
+		complexity *= w.limits.ListSize
+	}
+	return depth + 1, complexity + 1
+}
+
+// condition returns the object type named by a fragment's type condition, or
+// parent if it has none.
+func (w costWalker) condition(parent *graphql.Object, condition *ast.Named) *graphql.Object {
+	if condition == nil {
+		return parent
+	}
+	if object, ok := w.schema.Type(condition.Name.Value).(*graphql.Object); ok {
+		return object
+	}
+	return parent
+}
@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"context"
+	"sync"
+
+	"github.com/byron-ojua/starter-project/database"
+)
+
+// loaded is the outcome of looking up one key.
+type loaded[V any] struct {
+	value V
+	found bool
+	err   error
+}
+
+// loader batches lookups by key. Resolvers queue keys with load and get back
+// a thunk; the executor only calls thunks once every field at the same depth
+// has been resolved, so the first call fetches every queued key in one store
+// call. Results are kept for the rest of the request.
+type loader[V any] struct {
+	fetch func(ctx context.Context, keys []string) (map[string]V, error)
+
+	mu      sync.Mutex
+	pending []string
+	queued  map[string]bool
+	results map[string]loaded[V]
+}
+
+func newLoader[V any](fetch func(ctx context.Context, keys []string) (map[string]V, error)) *loader[V] {
+	return &loader[V]{
+		fetch:   fetch,
+		queued:  make(map[string]bool),
+		results: make(map[string]loaded[V]),
+	}
+}
+
+// load queues key and returns a thunk that waits for its value.
+func (l *loader[V]) load(ctx context.Context, key string) func() (V, bool, error) {
+	l.mu.Lock()
+	l.queue(key)
+	l.mu.Unlock()
+
+	return func() (V, bool, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.flush(ctx)
+		result := l.results[key]
+		return result.value, result.found, result.err
+	}
+}
+
+// loadMany fetches any of keys not already loaded, along with everything
+// queued, in one store call.
+func (l *loader[V]) loadMany(ctx context.Context, keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		l.queue(key)
+	}
+	l.flush(ctx)
+}
+
+// queue adds key to the next batch unless it is loaded or already queued. The
+// caller must hold l.mu.
+func (l *loader[V]) queue(key string) {
+	if _, done := l.results[key]; done || l.queued[key] {
+		return
+	}
+	l.queued[key] = true
+	l.pending = append(l.pending, key)
+}
+
+// flush fetches the queued keys. The caller must hold l.mu.
+func (l *loader[V]) flush(ctx context.Context) {
+	if len(l.pending) == 0 {
+		return
+	}
+
+	keys := l.pending
+	l.pending = nil
+	clear(l.queued)
+
+	values, err := l.fetch(ctx, keys)
+	for _, key := range keys {
+		value, found := values[key]
+		l.results[key] = loaded[V]{value: value, found: found, err: err}
+	}
+}
+
+// loaders holds the batch loaders for one request.
+type loaders struct {
+	clients        *loader[database.Client]
+	clientVehicles *loader[[]string]
+	vehicles       *loader[database.Vehicle]
+	weights        *loader[[]database.Weight]
+
+	mu     sync.Mutex
+	owners []string
+}
+
+func newLoaders(store database.Store) *loaders {
+	return &loaders{
+		clients:        newLoader(store.GetClientsByNames),
+		clientVehicles: newLoader(store.GetVehiclesByClients),
+		vehicles:       newLoader(store.GetVehiclesByVins),
+		weights:        newLoader(store.GetWeightsByVins),
+	}
+}
+
+// owner returns a thunk for the client that owns vin. The owners of every
+// vehicle queued alongside it are loaded together, so resolving the client of
+// N vehicles takes two store calls rather than N.
+func (l *loaders) owner(ctx context.Context, vin string) func() (database.Client, bool, error) {
+	vehicle := l.vehicles.load(ctx, vin)
+
+	l.mu.Lock()
+	l.owners = append(l.owners, vin)
+	l.mu.Unlock()
+
+	return func() (database.Client, bool, error) {
+		found, ok, err := vehicle()
+		if err != nil || !ok {
+			return database.Client{}, false, err
+		}
+
+		l.mu.Lock()
+		vins := l.owners
+		l.owners = nil
+		l.mu.Unlock()
+
+		if len(vins) > 0 {
+			l.vehicles.loadMany(ctx, vins)
+			var names []string
+			for _, vin := range vins {
+				if owned, ok, _ := l.vehicles.load(ctx, vin)(); ok {
+					names = append(names, owned.Client)
+				}
+			}
+			l.clients.loadMany(ctx, names)
+		}
+
+		return l.clients.load(ctx, found.Client)()
+	}
+}
@@ -0,0 +1,243 @@
+// Package graph serves clients, vehicles and their weight readings over
+// GraphQL. Nested fields are resolved with per-request batch loaders, so a
+// query costs one store call per level rather than one per object, and
+// queries are rejected up front if they are too deep or too expensive.
+package graph
+
+import (
+	"context"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string         `json:"query" form:"query"`
+	OperationName string         `json:"operationName" form:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Schema executes GraphQL requests against a store.
+type Schema struct {
+	schema graphql.Schema
+	store  database.Store
+	limits Limits
+}
+
+// vehicleRef is the source of a Vehicle. Only the VIN is known until a field
+// that needs the rest of the record is requested.
+type vehicleRef struct {
+	vin string
+}
+
+// loadersKey is the context key of the request's loaders.
+type loadersKey struct{}
+
+// New builds the schema for store.
+func New(store database.Store, limits Limits) (*Schema, error) {
+	weightType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "WeightReading",
+		Description: "A weight recorded for a vehicle",
+		Fields: graphql.Fields{
+			"vin":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"weight": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+
+	clientType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Client",
+		Description: "A customer and the vehicles they own",
+		Fields: graphql.Fields{
+			"name":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"contactName":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"contactEmail": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	vehicleType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Vehicle",
+		Description: "A vehicle and its weight readings",
+		Fields: graphql.Fields{
+			"vin": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(vehicleRef).vin, nil
+				},
+			},
+			"mileage": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					vehicle := loadersFrom(p.Context).vehicles.load(p.Context, p.Source.(vehicleRef).vin)
+					return func() (any, error) {
+						found, ok, err := vehicle()
+						if err != nil || !ok {
+							return nil, err
+						}
+						return found.Mileage, nil
+					}, nil
+				},
+			},
+			"client": &graphql.Field{
+				Type: clientType,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					owner := loadersFrom(p.Context).owner(p.Context, p.Source.(vehicleRef).vin)
+					return func() (any, error) {
+						found, ok, err := owner()
+						if err != nil || !ok {
+							return nil, err
+						}
+						return found, nil
+					}, nil
+				},
+			},
+			"weights": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(weightType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					weights := loadersFrom(p.Context).weights.load(p.Context, p.Source.(vehicleRef).vin)
+					return func() (any, error) {
+						found, _, err := weights()
+						if err != nil {
+							return nil, err
+						}
+						if found == nil {
+							found = []database.Weight{}
+						}
+						return found, nil
+					}, nil
+				},
+			},
+			"largestWeight": &graphql.Field{
+				Type: graphql.Float,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					weights := loadersFrom(p.Context).weights.load(p.Context, p.Source.(vehicleRef).vin)
+					return func() (any, error) {
+						found, _, err := weights()
+						if err != nil || len(found) == 0 {
+							return nil, err
+						}
+						largest := found[0].Weight
+						for _, weight := range found[1:] {
+							largest = max(largest, weight.Weight)
+						}
+						return largest, nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	clientType.AddFieldConfig("vehicles", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(vehicleType))),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			vins := loadersFrom(p.Context).clientVehicles.load(p.Context, p.Source.(database.Client).Name)
+			return func() (any, error) {
+				found, _, err := vins()
+				if err != nil {
+					return nil, err
+				}
+				refs := make([]vehicleRef, len(found))
+				for i, vin := range found {
+					refs[i] = vehicleRef{vin: vin}
+				}
+				return refs, nil
+			}, nil
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"clients": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(clientType))),
+				Description: "Every client",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					clients, err := store.GetAllClients(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					return *clients, nil
+				},
+			},
+			"client": &graphql.Field{
+				Type:        clientType,
+				Description: "A client by name, or null if there is none",
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					client := loadersFrom(p.Context).clients.load(p.Context, p.Args["name"].(string))
+					return func() (any, error) {
+						found, ok, err := client()
+						if err != nil || !ok {
+							return nil, err
+						}
+						return found, nil
+					}, nil
+				},
+			},
+			"vehicle": &graphql.Field{
+				Type:        vehicleType,
+				Description: "A vehicle by VIN, or null if there is none",
+				Args: graphql.FieldConfigArgument{
+					"vin": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					vin := p.Args["vin"].(string)
+					vehicle := loadersFrom(p.Context).vehicles.load(p.Context, vin)
+					return func() (any, error) {
+						_, ok, err := vehicle()
+						if err != nil || !ok {
+							return nil, err
+						}
+						return vehicleRef{vin: vin}, nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schema{schema: schema, store: store, limits: limits}, nil
+}
+
+// Do runs a request. ok is false if the request was rejected before it ran,
+// because it did not parse, was invalid or was over the limits.
+func (s *Schema) Do(ctx context.Context, request Request) (result *graphql.Result, ok bool) {
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(request.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, false
+	}
+
+	validation := graphql.ValidateDocument(&s.schema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}, false
+	}
+
+	if err := s.limits.check(&s.schema, document, request.OperationName); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, false
+	}
+
+	ctx = context.WithValue(ctx, loadersKey{}, newLoaders(s.store))
+	result = graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       ctx,
+	})
+	return result, true
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
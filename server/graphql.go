@@ -0,0 +1,91 @@
+/*
+* @file graphql.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the handler that serves the GraphQL endpoint alongside
+* the REST routes.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/byron-ojua/starter-project/graph"
+	"github.com/gin-gonic/gin"
+)
+
+// graphQLLimits returns the limits queries are checked against.
+func graphQLLimits(settings config.GraphQL) graph.Limits {
+	limits := graph.DefaultLimits
+	limits.MaxDepth = settings.MaxDepth
+	limits.MaxComplexity = settings.MaxComplexity
+	return limits
+}
+
+// graphQL godoc
+// @Summary Query clients, vehicles and weights with GraphQL
+// @Description Run a GraphQL query. Requests may be sent as a JSON body or, for GET, as the query, operationName and variables query parameters. Queries that are too deep or too complex are rejected with 400.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body graph.Request true "GraphQL request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /graphql [post]
+func graphQL(schema *graph.Schema) gin.HandlerFunc {
+	return serveGraphQL(schema)
+}
+
+// graphQLQuery godoc
+// @Summary Query clients, vehicles and weights with GraphQL
+// @Description Run a GraphQL query sent as query parameters
+// @Tags graphql
+// @Produce json
+// @Param query query string true "GraphQL query"
+// @Param operationName query string false "Operation to run, if the query has several"
+// @Param variables query string false "Variables as a JSON object"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /graphql [get]
+func graphQLQuery(schema *graph.Schema) gin.HandlerFunc {
+	return serveGraphQL(schema)
+}
+
+// serveGraphQL runs a GraphQL request sent either way.
+func serveGraphQL(schema *graph.Schema) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request graph.Request
+
+		if c.Request.Method == http.MethodGet {
+			request.Query = c.Query("query")
+			request.OperationName = c.Query("operationName")
+			if variables := c.Query("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": "variables must be a JSON object"}}})
+					return
+				}
+			}
+		} else if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": err.Error()}}})
+			return
+		}
+
+		if request.Query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": "query is required"}}})
+			return
+		}
+
+		result, ok := schema.Do(c.Request.Context(), request)
+		if !ok {
+			c.JSON(http.StatusBadRequest, result)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,443 @@
+/*
+* @file grpc.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the gRPC services, which serve the same lookups as the
+* REST handlers, and the mappers that turn the REST types into their
+* protobuf messages so both APIs return the same data.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/byron-ojua/starter-project/audit"
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+	"github.com/byron-ojua/starter-project/fleetpb"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// apiKeyMetadata is the metadata key integrations send their API key in.
+const apiKeyMetadata = "x-api-key"
+
+// newGRPCServer returns a gRPC server for the API. Every call must carry an
+// API key in "x-api-key" metadata or a session, the same one the login form
+// sets as a cookie, in an "authorization: Bearer <session>" header. Each call
+// takes a token from the caller's rate limit, as a REST request does, and is
+// audited.
+func newGRPCServer(api *handlers, sessions *auth.SessionStore, limiter *ratelimit.Limiter, log *audit.Log) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				ctx, caller, err := authenticate(ctx, sessions, limiter)
+				if err == nil {
+					err = allowCall(ctx, limiter, caller, info.FullMethod)
+				}
+				var resp any
+				if err == nil {
+					resp, err = handler(ctx, req)
+				}
+				auditCall(ctx, log, info.FullMethod, grpcResource(req), err)
+				return resp, err
+			},
+		),
+		grpc.ChainStreamInterceptor(
+			func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				ctx, caller, err := authenticate(stream.Context(), sessions, limiter)
+				if err == nil {
+					err = allowCall(ctx, limiter, caller, info.FullMethod)
+				}
+				if err == nil {
+					err = handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+				}
+				auditCall(ctx, log, info.FullMethod, "", err)
+				return err
+			},
+		),
+	)
+
+	fleetpb.RegisterClientServiceServer(server, &clientService{api: api})
+	fleetpb.RegisterVehicleServiceServer(server, &vehicleService{api: api})
+	fleetpb.RegisterWeightServiceServer(server, &weightService{api: api})
+	return server
+}
+
+// serveGRPC serves server on addr until it is stopped.
+func serveGRPC(addr string, server *grpc.Server) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// grpcCaller names who made a call and the rate limit plan they are on, as
+// rateLimitCaller does for REST requests.
+type grpcCaller struct {
+	name string
+	plan string
+}
+
+// authenticate looks up the API key in the call's metadata or, failing that,
+// the session named in its authorization header, and stores the caller's
+// user in the returned context. A caller with an API key is recorded as the
+// key's name, as apiProtected does.
+func authenticate(ctx context.Context, sessions *auth.SessionStore, limiter *ratelimit.Limiter) (context.Context, grpcCaller, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(apiKeyMetadata); len(keys) > 0 {
+		plan, found := limiter.KeyPlan(keys[0])
+		if !found {
+			return ctx, grpcCaller{}, status.Error(codes.Unauthenticated, "unknown API key")
+		}
+		name := apiKeyName(keys[0])
+		return auth.WithUser(ctx, auth.User{Subject: name}), grpcCaller{name: name, plan: plan}, nil
+	}
+
+	for _, value := range md.Get("authorization") {
+		id, found := strings.CutPrefix(value, "Bearer ")
+		if !found {
+			continue
+		}
+		if session, found := sessions.Get(id); found {
+			caller := grpcCaller{name: "user:" + session.User.Subject, plan: ratelimit.PlanUser}
+			return auth.WithUser(ctx, session.User), caller, nil
+		}
+	}
+	return ctx, grpcCaller{}, status.Error(codes.Unauthenticated, "a valid session or API key is required")
+}
+
+// allowCall takes a token from caller's buckets for a call to method, which
+// route limits name as "GRPC <method>". Once they are empty it refuses the
+// call with RESOURCE_EXHAUSTED and says when to retry in "retry-after"
+// metadata. A stream takes one token when it opens.
+func allowCall(ctx context.Context, limiter *ratelimit.Limiter, caller grpcCaller, method string) error {
+	result, limited := limiter.Allow(caller.name, caller.plan, "GRPC "+method)
+	if !limited || result.Allowed {
+		return nil
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", ceilSeconds(result.RetryAfter)))
+	return status.Error(codes.ResourceExhausted, "too many requests")
+}
+
+// authenticatedStream carries the authenticated context into a stream
+// handler.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// auditCall records a gRPC call in the audit log the way auditMiddleware
+// records REST calls.
+func auditCall(ctx context.Context, log *audit.Log, method, resource string, err error) {
+	actor := "anonymous"
+	if user, ok := auth.UserFrom(ctx); ok {
+		actor = user.Subject
+	}
+
+	var source string
+	if p, ok := peer.FromContext(ctx); ok {
+		source, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+
+	code := httpStatus(status.Code(err))
+	_, appendErr := log.Append(audit.Entry{
+		Actor:    actor,
+		Action:   "GRPC " + method,
+		Resource: resource,
+		SourceIP: source,
+		Outcome:  auditOutcome(code),
+		Status:   code,
+	})
+	if appendErr != nil {
+		slog.Error("writing the audit log failed", "err", appendErr)
+	}
+}
+
+// grpcResource names the client or vehicle a request refers to.
+func grpcResource(req any) string {
+	switch req := req.(type) {
+	case interface{ GetVin() string }:
+		return "vin:" + req.GetVin()
+	case interface{ GetName() string }:
+		return "client:" + req.GetName()
+	}
+	return ""
+}
+
+// lookupError maps an error from one of the handlers' lookups to the status
+// the REST route would have responded with, as lookupFailed and storeFailed
+// do.
+func lookupError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.Canceled, "request cancelled")
+	case errors.Is(err, database.ErrClosed):
+		return status.Error(codes.Unavailable, "store unavailable")
+	}
+	return status.Error(codes.Internal, "store error")
+}
+
+// strictError is returned instead of a partial response when strict was
+// asked for, like the 502 from the REST routes.
+func strictError(warnings []Warning) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	return status.Error(codes.Unavailable, "some fields could not be loaded")
+}
+
+// httpStatus returns the HTTP status equivalent to a gRPC code.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable, codes.Canceled:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// clientService serves fleetpb.ClientService.
+type clientService struct {
+	fleetpb.UnimplementedClientServiceServer
+	api *handlers
+}
+
+func (s *clientService) ListClients(ctx context.Context, req *fleetpb.ListClientsRequest) (*fleetpb.ListClientsResponse, error) {
+	clients, _, err := s.api.listClients(ctx, includeAll, clientPage{})
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	resp := &fleetpb.ListClientsResponse{}
+	for _, client := range clients {
+		resp.Clients = append(resp.Clients, clientMessage(&client))
+	}
+	return resp, nil
+}
+
+func (s *clientService) GetClient(ctx context.Context, req *fleetpb.GetClientRequest) (*fleetpb.Client, error) {
+	client, err := s.api.findClient(ctx, req.GetName(), includeAll)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	if req.GetStrict() {
+		if err := strictError(client.Warnings); err != nil {
+			return nil, err
+		}
+	}
+	return clientMessage(client), nil
+}
+
+func (s *clientService) ListClientVehicles(ctx context.Context, req *fleetpb.ListClientVehiclesRequest) (*fleetpb.ListClientVehiclesResponse, error) {
+	vehicles, err := s.api.findClientVehicles(ctx, req.GetName(), includeAll)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	if req.GetStrict() {
+		if err := strictError(vehicles.Warnings); err != nil {
+			return nil, err
+		}
+	}
+	return clientVehiclesMessage(vehicles), nil
+}
+
+// vehicleService serves fleetpb.VehicleService.
+type vehicleService struct {
+	fleetpb.UnimplementedVehicleServiceServer
+	api *handlers
+}
+
+func (s *vehicleService) GetVehicle(ctx context.Context, req *fleetpb.GetVehicleRequest) (*fleetpb.Vehicle, error) {
+	vehicle, err := s.api.findVehicle(ctx, req.GetVin(), includeAll)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	if req.GetStrict() {
+		if err := strictError(vehicle.Warnings); err != nil {
+			return nil, err
+		}
+	}
+	return vehicleMessage(vehicle), nil
+}
+
+// weightService serves fleetpb.WeightService.
+type weightService struct {
+	fleetpb.UnimplementedWeightServiceServer
+	api *handlers
+}
+
+func (s *weightService) IngestWeights(stream fleetpb.WeightService_IngestWeightsServer) error {
+	var accepted int64
+	for {
+		reading, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&fleetpb.IngestWeightsResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+
+		if reading.GetVin() == "" {
+			return status.Errorf(codes.InvalidArgument, "reading %d: vin is required", accepted+1)
+		}
+
+		weight := database.Weight{Vin: reading.GetVin(), Weight: reading.GetWeight(), Time: time.Now().UTC()}
+		if err := s.api.store.AddWeight(stream.Context(), weight); err != nil {
+			slog.Warn("ingesting a reading failed", "vin", weight.Vin, "err", err)
+			failed := status.Convert(lookupError(err))
+			return status.Errorf(failed.Code(), "reading %d: %s", accepted+1, failed.Message())
+		}
+		accepted++
+	}
+}
+
+func (s *weightService) WatchWeights(req *fleetpb.WatchWeightsRequest, stream fleetpb.WeightService_WatchWeightsServer) error {
+	ctx := stream.Context()
+
+	var filter func(events.Event) bool
+	switch target := req.GetTarget().(type) {
+	case *fleetpb.WatchWeightsRequest_Vin:
+		if _, err := s.api.store.GetVehicleByVin(ctx, target.Vin); err != nil {
+			return lookupError(err)
+		}
+		filter = func(event events.Event) bool {
+			return event.Type == events.WeightAdded && event.Vin == target.Vin
+		}
+	case *fleetpb.WatchWeightsRequest_Client:
+		if _, err := s.api.store.GetClientsByName(ctx, target.Client); err != nil {
+			return lookupError(err)
+		}
+		filter = func(event events.Event) bool {
+			return event.Type == events.WeightAdded && event.Client == target.Client
+		}
+	default:
+		return status.Error(codes.InvalidArgument, "a vin or client is required")
+	}
+
+	subscription := s.api.bus.Subscribe(filter, streamBuffer)
+	defer subscription.Close()
+
+	for {
+		select {
+		case event, ok := <-subscription.C:
+			if !ok {
+				if subscription.Dropped() {
+					return status.Error(codes.ResourceExhausted, "stream fell too far behind")
+				}
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+			if err := stream.Send(weightMessage(event)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// clientMessage maps the REST client response to its message.
+func clientMessage(client *ClientWithVehicles) *fleetpb.Client {
+	return &fleetpb.Client{
+		Name:             client.Name,
+		ContactName:      client.ContactName,
+		ContactEmail:     client.ContactEmail,
+		NumberOfVehicles: int64(client.NumVehicles),
+		Partial:          client.Partial,
+		Warnings:         warningMessages(client.Warnings),
+	}
+}
+
+// clientVehiclesMessage maps the REST client vehicles response to its
+// message.
+func clientVehiclesMessage(vehicles *ClientVehicles) *fleetpb.ListClientVehiclesResponse {
+	resp := &fleetpb.ListClientVehiclesResponse{
+		Name:     vehicles.Name,
+		Partial:  vehicles.Partial,
+		Warnings: warningMessages(vehicles.Warnings),
+	}
+	for _, vehicle := range vehicles.Vehicles {
+		resp.Vehicles = append(resp.Vehicles, &fleetpb.ClientVehicle{
+			Vin:           vehicle.Vin,
+			Mileage:       int64(vehicle.Mileage),
+			LargestWeight: int64(vehicle.LargestWeight),
+		})
+	}
+	return resp
+}
+
+// vehicleMessage maps the REST vehicle response to its message.
+func vehicleMessage(vehicle *VehicleInfo) *fleetpb.Vehicle {
+	msg := &fleetpb.Vehicle{
+		Vin:          vehicle.Vin,
+		ClientName:   vehicle.ClientName,
+		ContactName:  vehicle.ContactName,
+		ContactEmail: vehicle.ContactEmail,
+		Mileage:      int64(vehicle.Mileage),
+		Partial:      vehicle.Partial,
+		Warnings:     warningMessages(vehicle.Warnings),
+	}
+	for _, weight := range vehicle.Weights {
+		msg.Weights = append(msg.Weights, int64(weight))
+	}
+	return msg
+}
+
+// weightMessage maps a weight.added event to its message.
+func weightMessage(event events.Event) *fleetpb.WeightReading {
+	reading, _ := eventPayload(event).(WeightReading)
+	return &fleetpb.WeightReading{
+		Vin:    reading.Vin,
+		Client: reading.Client,
+		Weight: reading.Weight,
+		Time:   timestamppb.New(reading.Time),
+	}
+}
+
+func warningMessages(warnings []Warning) []*fleetpb.Warning {
+	var results []*fleetpb.Warning
+	for _, warning := range warnings {
+		results = append(results, &fleetpb.Warning{
+			Resource: warning.Resource,
+			Field:    warning.Field,
+			Message:  warning.Message,
+		})
+	}
+	return results
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/byron-ojua/starter-project/audit"
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/fleetpb"
+	"github.com/byron-ojua/starter-project/pool"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcTest is the gRPC server over a test store, and a session it accepts.
+type grpcTest struct {
+	conn    *grpc.ClientConn
+	session string
+}
+
+// newGRPCTest serves the gRPC API over store in memory, limiting callers by
+// policy, with testAPIKey on the user plan.
+func newGRPCTest(t *testing.T, store database.Store, policy ratelimit.Policy) *grpcTest {
+	t.Helper()
+	policy.Keys = map[string]string{testAPIKey: ratelimit.PlanUser}
+	sessions := auth.NewSessionStore(time.Hour)
+	api := &handlers{store: store, pool: pool.NewLimiter(0, 0)}
+	server := newGRPCServer(api, sessions, ratelimit.NewLimiter(policy, ratelimit.NewMemory()), audit.NewLog())
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///fleet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	session, err := sessions.Create(auth.SessionPassword, auth.User{Subject: "admin", Roles: []string{auth.RoleAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &grpcTest{conn: conn, session: session.ID}
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	server := newGRPCTest(t, newFakeStore(), ratelimit.DefaultPolicy())
+	clients := fleetpb.NewClientServiceClient(server.conn)
+
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want codes.Code
+	}{
+		{"API key", metadata.Pairs("x-api-key", testAPIKey), codes.OK},
+		{"session", metadata.Pairs("authorization", "Bearer "+server.session), codes.OK},
+		{"unknown API key", metadata.Pairs("x-api-key", "wrong"), codes.Unauthenticated},
+		{"unknown session", metadata.Pairs("authorization", "Bearer wrong"), codes.Unauthenticated},
+		{"nothing", metadata.MD{}, codes.Unauthenticated},
+	}
+	for _, test := range tests {
+		ctx := metadata.NewOutgoingContext(context.Background(), test.md)
+		_, err := clients.GetClient(ctx, &fleetpb.GetClientRequest{Name: "CIA"})
+		if got := status.Code(err); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	policy := ratelimit.DefaultPolicy()
+	policy.Plans[ratelimit.PlanUser] = ratelimit.Plan{
+		Limit:  ratelimit.Limit{Requests: 10, Per: time.Minute},
+		Routes: map[string]ratelimit.Limit{"GRPC " + fleetpb.ClientService_GetClient_FullMethodName: {Requests: 2, Per: time.Minute}},
+	}
+	server := newGRPCTest(t, newFakeStore(), policy)
+	clients := fleetpb.NewClientServiceClient(server.conn)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-api-key", testAPIKey))
+
+	for i := 0; i < 2; i++ {
+		if _, err := clients.GetClient(ctx, &fleetpb.GetClientRequest{Name: "CIA"}); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+
+	var header metadata.MD
+	_, err := clients.GetClient(ctx, &fleetpb.GetClientRequest{Name: "CIA"}, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("got %v past the route limit, want ResourceExhausted", err)
+	}
+	if retry := header.Get("retry-after"); len(retry) != 1 || retry[0] != "30" {
+		t.Errorf("got retry-after %v, want 30", retry)
+	}
+
+	// Other methods are only held to the plan's overall limit.
+	if _, err := clients.ListClients(ctx, &fleetpb.ListClientsRequest{}); err != nil {
+		t.Errorf("ListClients: %v", err)
+	}
+}
+
+func TestGRPCIngestWeightsErrors(t *testing.T) {
+	tests := []struct {
+		vin  string
+		down error
+		want codes.Code
+	}{
+		{"1A", nil, codes.OK},
+		{"9Z", nil, codes.NotFound},
+		{"1A", database.ErrClosed, codes.Unavailable},
+		{"1A", errors.New("disk full"), codes.Internal},
+	}
+
+	for _, test := range tests {
+		store := newFakeStore()
+		store.down = test.down
+		server := newGRPCTest(t, store, ratelimit.DefaultPolicy())
+		weights := fleetpb.NewWeightServiceClient(server.conn)
+		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-api-key", testAPIKey))
+
+		stream, err := weights.IngestWeights(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Send(&fleetpb.IngestWeightRequest{Vin: test.vin, Weight: 1000}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = stream.CloseAndRecv()
+		if got := status.Code(err); got != test.want {
+			t.Errorf("%s with %v: got %v, want %v", test.vin, test.down, got, test.want)
+		}
+	}
+}
+
+func TestLookupError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("vehicle does not exist: %w", database.ErrNotFound), codes.NotFound},
+		{context.Canceled, codes.Canceled},
+		{context.DeadlineExceeded, codes.Canceled},
+		{database.ErrClosed, codes.Unavailable},
+		{errors.New("disk full"), codes.Internal},
+	}
+	for _, test := range tests {
+		if got := status.Code(lookupError(test.err)); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,802 @@
+/*
+* @file handlers.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the handlers for the API endpoints.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byron-ojua/starter-project/cache"
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+	"github.com/byron-ojua/starter-project/pool"
+	"github.com/gin-gonic/gin"
+)
+
+// ClientWithVehicles is a struct that represents a client and the number of vehicles they have.
+type ClientWithVehicles struct {
+	Name         string    `json:"name"`
+	ContactName  string    `json:"contact_name"`
+	ContactEmail string    `json:"contact_email"`
+	NumVehicles  int       `json:"number_of_vehicles"`
+	Partial      bool      `json:"partial,omitempty"`
+	Warnings     []Warning `json:"warnings,omitempty"`
+
+	// Vehicles is only set when expand=vehicles was asked for.
+	Vehicles *[]EmbeddedVehicle `json:"vehicles,omitempty"`
+
+	// modified is when the newest of the records it was built from changed.
+	modified time.Time
+}
+
+// EmbeddedVehicle is a vehicle embedded in a client by expand=vehicles.
+type EmbeddedVehicle struct {
+	Vin     string `json:"vin"`
+	Mileage int    `json:"mileage"`
+	Weights *[]int `json:"weights,omitempty"`
+
+	// modified is when the vehicle or its newest weight changed.
+	modified time.Time
+}
+
+// VehicleInfo is a struct that represents a vehicle and its owner's information.
+type VehicleInfo struct {
+	Vin          string    `json:"vin"`
+	ClientName   string    `json:"client_name"`
+	ContactName  string    `json:"contact_name"`
+	ContactEmail string    `json:"contact_email"`
+	Mileage      int       `json:"mileage"`
+	Weights      []int     `json:"weights"`
+	Partial      bool      `json:"partial,omitempty"`
+	Warnings     []Warning `json:"warnings,omitempty"`
+
+	// modified is when the newest of the records it was built from changed.
+	modified time.Time
+}
+
+// ClientVehicle is a struct that represents a vehicle and its basic information.
+type ClientVehicle struct {
+	Vin           string `json:"vin"`
+	Mileage       int    `json:"mileage"`
+	LargestWeight int    `json:"largest_weight"`
+}
+
+// ClientVehicles is a struct that represents a client and their vehicles.
+type ClientVehicles struct {
+	Name     string          `json:"name"`
+	Vehicles []ClientVehicle `json:"vehicles"`
+	Partial  bool            `json:"partial,omitempty"`
+	Warnings []Warning       `json:"warnings,omitempty"`
+
+	// modified is when the newest of the records it was built from changed.
+	modified time.Time
+}
+
+// ClientRecord is a struct that represents a client as it is stored.
+type ClientRecord struct {
+	Name         string `json:"name"`
+	ContactName  string `json:"contact_name"`
+	ContactEmail string `json:"contact_email"`
+}
+
+// VehicleRecord is a struct that represents a vehicle as it is stored.
+type VehicleRecord struct {
+	Vin     string `json:"vin"`
+	Client  string `json:"client"`
+	Mileage int    `json:"mileage"`
+}
+
+// ClientUpdate is the body accepted when creating or replacing a client.
+type ClientUpdate struct {
+	ContactName  string `json:"contact_name" binding:"required"`
+	ContactEmail string `json:"contact_email" binding:"required,email"`
+}
+
+// VehicleUpdate is the body accepted when creating or replacing a vehicle.
+type VehicleUpdate struct {
+	Client  string `json:"client" binding:"required"`
+	Mileage int    `json:"mileage" binding:"min=0"`
+}
+
+// handlers serves the API endpoints from a store shared by every request.
+type handlers struct {
+	store  database.Store
+	pool   *pool.Limiter
+	bus    *events.Bus
+	writes keyedMutex
+}
+
+// health reports whether the store is reachable.
+// @Summary Check the server's health
+// @Description Check that the server is up and its store is reachable
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /healthz [get]
+func (h *handlers) health(c *gin.Context) {
+	if err := h.store.Ping(c.Request.Context()); err != nil {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// cacheStats responds with the store cache's hit and miss counts.
+// @Summary Get cache statistics
+// @Description Get the store cache's hit, miss and invalidation counts
+// @Tags admin
+// @Produce json
+// @Success 200 {object} cache.Stats
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/cache [get]
+func cacheStats(store *cache.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.IndentedJSON(http.StatusOK, store.Stats())
+	}
+}
+
+// getAllClients responds with the list of all clients as JSON.
+// @Summary Get all clients
+// @Description Get all clients, in name order, and the number of vehicles they have. With limit the clients are paged, and each page but the last has a Link header with rel="next".
+// @Tags clients
+// @Param strict query bool false "Fail the request if any vehicle count cannot be loaded"
+// @Param fields query string false "Comma-separated fields to include, such as name,contact_email"
+// @Param expand query string false "Related resources to embed: vehicles or vehicles.weights"
+// @Param limit query int false "Return at most this many clients; a Link header points to the next page"
+// @Param after query string false "Return the clients after this one, from the previous page's Link header"
+// @Success 200 {array} ClientWithVehicles
+// @Success 304 "Not modified since the ETag in If-None-Match or the time in If-Modified-Since"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} PartialFailure
+// @Failure 503 {object} map[string]string
+// @Router /clients [get]
+func (h *handlers) getAllClients(c *gin.Context) {
+	sel, ok := selectionFor(c, resourceClient)
+	if !ok {
+		return
+	}
+
+	page, ok := clientPageFrom(c)
+	if !ok {
+		return
+	}
+
+	all_clients, more, err := h.listClients(c.Request.Context(), sel.include, page)
+	if err != nil {
+		lookupFailed(c, err, "clients not found")
+		return
+	}
+	if more {
+		c.Writer.Header().Add("Link", nextPageLink(c, all_clients[len(all_clients)-1].Name))
+	}
+
+	var warnings []Warning
+	for _, client := range all_clients {
+		warnings = append(warnings, client.Warnings...)
+	}
+	if !allowPartial(c, warnings) {
+		return
+	}
+
+	// The list is as new as its newest client, and has no date if any
+	// client has none.
+	var modified time.Time
+	for _, client := range all_clients {
+		if client.modified.IsZero() {
+			modified = time.Time{}
+			break
+		}
+		modified = latest(modified, client.modified)
+	}
+
+	respondJSON(c, sel.apply(versionOf(c).clients(all_clients)), modified)
+}
+
+// listClients loads the clients on page, in name order, and the parts of
+// them include asks for. Clients whose vehicles could not be loaded carry
+// warnings. It also reports whether there are more clients after the page.
+func (h *handlers) listClients(ctx context.Context, include include, page clientPage) ([]ClientWithVehicles, bool, error) {
+	var group = h.pool.Group(ctx)
+	var mu sync.Mutex
+
+	var clients *[]database.Client
+	var err_client error
+	var vehicles_by_client = make(map[string][]string)
+	var embedded map[string][]EmbeddedVehicle
+	var all_clients []ClientWithVehicles
+
+	clients, err_client = h.store.GetAllClients(ctx)
+
+	if err_client != nil {
+		return nil, false, err_client
+	}
+
+	// Only the clients on the page need their vehicles loaded.
+	clients, more := page.of(clients)
+
+	// Use Goroutines to speed up the process of getting the number of vehicles for each client.
+	// The vehicles are only needed to count or expand them.
+	for i := 0; i < len(*clients) && (include.vehicleCount || include.vehicles); i++ {
+		var client_name string = (*clients)[i].Name
+		group.Go(func(ctx context.Context) error {
+			temp_vehicles, err_vehicle := h.store.GetVehiclesByClient(ctx, client_name)
+
+			if err_vehicle != nil {
+				return failedField("client:"+client_name, "number_of_vehicles", err_vehicle)
+			}
+
+			// Maps are not thread-safe, so we need to use a mutex to prevent
+			mu.Lock()
+			vehicles_by_client[client_name] = *temp_vehicles
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	err_fanout := group.Wait()
+
+	if include.vehicles && ctx.Err() == nil {
+		var err_embed error
+		embedded, err_embed = h.embedVehicles(ctx, vehicles_by_client, include)
+		err_fanout = errors.Join(err_fanout, err_embed)
+	}
+
+	warnings, err := fanoutWarnings(ctx, err_fanout)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i := 0; i < len(*clients); i++ {
+		var client_name string = (*clients)[i].Name
+		var client_warnings = warningsFor(warnings, "client:"+client_name)
+		var client = ClientWithVehicles{
+			Name:         client_name,
+			ContactName:  (*clients)[i].ContactName,
+			ContactEmail: (*clients)[i].ContactEmail,
+			NumVehicles:  len(vehicles_by_client[client_name]),
+			Partial:      len(client_warnings) > 0,
+			Warnings:     client_warnings,
+		}
+		if vehicles, found := embedded[client_name]; found {
+			client.Vehicles = &vehicles
+		}
+		client.modified = clientModified((*clients)[i], client)
+		all_clients = append(all_clients, client)
+	}
+
+	return all_clients, more, nil
+}
+
+// getClientByID locates the client whose ID value matches the id
+// parameter sent by the client, then returns that client as a response.
+// @Summary Get a client by ID
+// @Description Get a client by their ID and the number of vehicles they have
+// @Tags clients
+// @Param id path string true "Client ID"
+// @Param strict query bool false "Fail the request if the vehicle count cannot be loaded"
+// @Param fields query string false "Comma-separated fields to include, such as name,contact_email"
+// @Param expand query string false "Related resources to embed: vehicles or vehicles.weights"
+// @Success 200 {object} ClientWithVehicles
+// @Success 304 "Not modified since the ETag in If-None-Match or the time in If-Modified-Since"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} PartialFailure
+// @Failure 503 {object} map[string]string
+// @Router /clients/{id} [get]
+func (h *handlers) getClientByID(c *gin.Context) {
+	sel, ok := selectionFor(c, resourceClient)
+	if !ok {
+		return
+	}
+
+	clientInfo, err := h.findClient(c.Request.Context(), c.Param("id"), sel.include)
+	if err != nil {
+		lookupFailed(c, err, err.Error())
+		return
+	}
+
+	if !allowPartial(c, clientInfo.Warnings) {
+		return
+	}
+
+	respondJSON(c, sel.apply(versionOf(c).client(clientInfo)), clientInfo.modified)
+}
+
+// findClient loads a client and the parts of them include asks for.
+func (h *handlers) findClient(ctx context.Context, id string, include include) (*ClientWithVehicles, error) {
+	var group = h.pool.Group(ctx)
+	var client *database.Client
+	var err_client error
+	var vehicles *[]string
+	var embedded map[string][]EmbeddedVehicle
+
+	// Use Goroutines to speed up the process of getting the client and their vehicles.
+	// The client itself is required, so its error is handled separately from
+	// the fan-out's warnings.
+	group.Go(func(ctx context.Context) error {
+		client, err_client = h.store.GetClientsByName(ctx, id)
+		return nil
+	})
+
+	if include.vehicleCount || include.vehicles {
+		group.Go(func(ctx context.Context) error {
+			var err_vehicles error
+			vehicles, err_vehicles = h.store.GetVehiclesByClient(ctx, id)
+			return failedField("client:"+id, "number_of_vehicles", err_vehicles)
+		})
+	}
+
+	err_fanout := group.Wait()
+
+	// Error handling
+	if err_client != nil {
+		return nil, err_client
+	}
+
+	if include.vehicles && vehicles != nil && ctx.Err() == nil {
+		var err_embed error
+		embedded, err_embed = h.embedVehicles(ctx, map[string][]string{id: *vehicles}, include)
+		err_fanout = errors.Join(err_fanout, err_embed)
+	}
+
+	warnings, err := fanoutWarnings(ctx, err_fanout)
+	if err != nil {
+		return nil, err
+	}
+
+	var numVehicles int
+	if vehicles != nil {
+		numVehicles = len(*vehicles)
+	}
+
+	var client_info = ClientWithVehicles{
+		Name:         client.Name,
+		ContactName:  client.ContactName,
+		ContactEmail: client.ContactEmail,
+		NumVehicles:  numVehicles,
+		Partial:      len(warnings) > 0,
+		Warnings:     warnings,
+	}
+	if vehicles, found := embedded[id]; found {
+		client_info.Vehicles = &vehicles
+	}
+	client_info.modified = clientModified(*client, client_info)
+
+	return &client_info, nil
+}
+
+// clientModified returns when the newest of the records a client's response
+// was built from changed: the client, whose date covers its list of
+// vehicles, and any vehicles embedded in it. A partial response may be
+// missing newer data, so it has no date.
+func clientModified(client database.Client, response ClientWithVehicles) time.Time {
+	if response.Partial {
+		return time.Time{}
+	}
+
+	modified := client.Updated
+	if response.Vehicles != nil {
+		for _, vehicle := range *response.Vehicles {
+			modified = latest(modified, vehicle.modified)
+		}
+	}
+	return modified
+}
+
+// getClientVehicles locates the vehicles of the client whose ID value matches
+// the id parameter sent by the client, then returns them as a response.
+// @Summary Get a client's vehicles
+// @Description Get a client's vehicles with their mileage and largest weight
+// @Tags clients
+// @Param id path string true "Client ID"
+// @Param strict query bool false "Fail the request if any vehicle's mileage or weight cannot be loaded"
+// @Param fields query string false "Comma-separated fields to include, such as vehicles.vin,vehicles.mileage"
+// @Success 200 {object} ClientVehicles
+// @Success 304 "Not modified since the ETag in If-None-Match or the time in If-Modified-Since"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} PartialFailure
+// @Failure 503 {object} map[string]string
+// @Router /clients/{id}/vehicles [get]
+func (h *handlers) getClientVehicles(c *gin.Context) {
+	sel, ok := selectionFor(c, resourceClientVehicles)
+	if !ok {
+		return
+	}
+
+	client_vehicles, err := h.findClientVehicles(c.Request.Context(), c.Param("id"), sel.include)
+	if err != nil {
+		lookupFailed(c, err, err.Error())
+		return
+	}
+
+	if !allowPartial(c, client_vehicles.Warnings) {
+		return
+	}
+
+	respondJSON(c, sel.apply(versionOf(c).clientVehicles(client_vehicles)), client_vehicles.modified)
+}
+
+// findClientVehicles loads a client's vehicles with their mileage and largest
+// weight, if include asks for them.
+func (h *handlers) findClientVehicles(ctx context.Context, id string, include include) (*ClientVehicles, error) {
+	var group = h.pool.Group(ctx)
+	var mu sync.Mutex
+	var vehicle_vins *[]string
+	var err_vins error
+	var vehicle_info = make(map[string]ClientVehicle)
+	var modified time.Time
+	var client *database.Client
+
+	// The store lists no vehicles for a client that does not exist, so the
+	// client's own record is loaded to tell the two apart. Its date also
+	// covers its list of vehicles.
+	var err_client error
+	group.Go(func(ctx context.Context) error {
+		client, err_client = h.store.GetClientsByName(ctx, id)
+		return nil
+	})
+
+	vehicle_vins, err_vins = h.store.GetVehiclesByClient(ctx, id)
+	group.Wait()
+
+	if err_client != nil {
+		return nil, err_client
+	}
+	if err_vins != nil {
+		return nil, err_vins
+	}
+
+	// create default objects for vehicleInfo map
+	for i := 0; i < len(*vehicle_vins); i++ {
+		vehicle_info[(*vehicle_vins)[i]] = ClientVehicle{
+			Vin:           (*vehicle_vins)[i],
+			Mileage:       0,
+			LargestWeight: 0,
+		}
+	}
+
+	// Get the vehicle mileage and weight for each vehicle.
+	// These calls are made using Goroutines to speed up the process.
+	for i := 0; i < len(*vehicle_vins); i++ {
+		var vin string = (*vehicle_vins)[i]
+		group.Go(func(ctx context.Context) error {
+			if !include.mileage {
+				return nil
+			}
+
+			vehicle, err_vehicle := h.store.GetVehicleByVin(ctx, vin)
+
+			if err_vehicle != nil {
+				return failedField("vin:"+vin, "mileage", err_vehicle)
+			}
+
+			// Update the vehicleInfo map with the vehicle mileage.
+			// Maps are not thread-safe, so we need to use a mutex to prevent
+			mu.Lock()
+			vInfo := vehicle_info[vin] // You can't update a field in a struct in a map directly, so you need to get the struct first.
+			vInfo.Mileage = vehicle.Mileage
+			vehicle_info[vin] = vInfo
+			modified = latest(modified, vehicle.Updated)
+			mu.Unlock()
+			return nil
+		})
+
+		group.Go(func(ctx context.Context) error {
+			if !include.weights {
+				return nil
+			}
+
+			weights, err_weights := h.store.GetWeightsByVin(ctx, vin)
+
+			if err_weights != nil {
+				return failedField("vin:"+vin, "largest_weight", err_weights)
+			}
+
+			var largest_weight int
+			var newest time.Time
+
+			for i := 0; i < len(*weights); i++ {
+				if int((*weights)[i].Weight) > largest_weight {
+					largest_weight = int((*weights)[i].Weight)
+				}
+				newest = latest(newest, (*weights)[i].Time)
+			}
+
+			// Update the vehicleInfo map with the largest weight.
+			// Maps are not thread-safe, so we need to use a mutex to prevent
+			mu.Lock()
+			vInfo := vehicle_info[vin] // You can't update a field in a struct in a map directly, so you need to get the struct first.
+			vInfo.LargestWeight = largest_weight
+			vehicle_info[vin] = vInfo
+			modified = latest(modified, newest)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	warnings, err := fanoutWarnings(ctx, group.Wait())
+	if err != nil {
+		return nil, err
+	}
+
+	// sent the response using the vehicleInfo map
+	var client_vehicles ClientVehicles
+	client_vehicles.Name = id
+	client_vehicles.Vehicles = []ClientVehicle{}
+	client_vehicles.Partial = len(warnings) > 0
+	client_vehicles.Warnings = warnings
+
+	// List the vehicles by VIN, so the body and its ETag are the same on
+	// every request.
+	var sorted_vins = append([]string(nil), (*vehicle_vins)...)
+	sort.Strings(sorted_vins)
+	for _, vin := range sorted_vins {
+		client_vehicles.Vehicles = append(client_vehicles.Vehicles, vehicle_info[vin])
+	}
+
+	// A partial response may be missing newer data, so it has no date.
+	if client != nil && len(warnings) == 0 {
+		client_vehicles.modified = latest(modified, client.Updated)
+	}
+
+	return &client_vehicles, nil
+}
+
+// getVehicalByID locates the vehicle whoses ID value matches the id
+// parameter sent by the client, then returns that vehicle as a response.
+// @Summary Get a vehicle by ID
+// @Description Get a vehicle by its ID and its owner's information
+// @Tags vehicles
+// @Param id path string true "Vehicle ID"
+// @Param strict query bool false "Fail the request if the vehicle's owner or weights cannot be loaded"
+// @Param fields query string false "Comma-separated fields to include, such as vin,mileage"
+// @Success 200 {object} VehicleInfo
+// @Success 304 "Not modified since the ETag in If-None-Match or the time in If-Modified-Since"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} PartialFailure
+// @Failure 503 {object} map[string]string
+// @Router /vehicles/{id} [get]
+func (h *handlers) getVehicalByID(c *gin.Context) {
+	sel, ok := selectionFor(c, resourceVehicle)
+	if !ok {
+		return
+	}
+
+	vehicle_info, err := h.findVehicle(c.Request.Context(), c.Param("id"), sel.include)
+	if err != nil {
+		lookupFailed(c, err, err.Error())
+		return
+	}
+
+	if !allowPartial(c, vehicle_info.Warnings) {
+		return
+	}
+
+	respondJSON(c, sel.apply(versionOf(c).vehicle(vehicle_info)), vehicle_info.modified)
+}
+
+// findVehicle loads a vehicle with its weights and its owner's information,
+// if include asks for them.
+func (h *handlers) findVehicle(ctx context.Context, id string, include include) (*VehicleInfo, error) {
+	var group = h.pool.Group(ctx)
+	var vehicle *database.Vehicle
+	var err_vehicle error
+	var weights *[]database.Weight
+	var client *database.Client
+
+	// Use Goroutines to speed up the process of getting the vehicle, its weights, and its client.
+	// The vehicle itself is required, so its error is handled separately from
+	// the fan-out's warnings.
+	group.Go(func(ctx context.Context) error {
+		vehicle, err_vehicle = h.store.GetVehicleByVin(ctx, id)
+		if err_vehicle != nil || !include.owner {
+			return nil
+		}
+
+		var err_client error
+		client, err_client = h.store.GetClientsByName(ctx, vehicle.Client)
+		return failedField("vin:"+id, "client_name", err_client)
+	})
+
+	if include.weights {
+		group.Go(func(ctx context.Context) error {
+			var err_weight error
+			weights, err_weight = h.store.GetWeightsByVin(ctx, id)
+			return failedField("vin:"+id, "weights", err_weight)
+		})
+	}
+
+	err_fanout := group.Wait()
+
+	// Error handling
+	if err_vehicle != nil {
+		return nil, err_vehicle
+	}
+
+	warnings, err := fanoutWarnings(ctx, err_fanout)
+	if err != nil {
+		return nil, err
+	}
+
+	var modified = vehicle.Updated
+	var int_weights []int
+	if weights != nil {
+		for i := 0; i < len(*weights); i++ {
+			int_weights = append(int_weights, int((*weights)[i].Weight))
+			if (*weights)[i].Time.After(modified) {
+				modified = (*weights)[i].Time
+			}
+		}
+	}
+
+	var vehicle_info = VehicleInfo{
+		Vin:      vehicle.Vin,
+		Mileage:  vehicle.Mileage,
+		Weights:  int_weights,
+		Partial:  len(warnings) > 0,
+		Warnings: warnings,
+	}
+
+	if client != nil {
+		vehicle_info.ClientName = client.Name
+		vehicle_info.ContactName = client.ContactName
+		vehicle_info.ContactEmail = client.ContactEmail
+		if client.Updated.After(modified) {
+			modified = client.Updated
+		}
+	}
+
+	// A partial response may be missing newer data, so it has no date.
+	if len(warnings) == 0 {
+		vehicle_info.modified = modified
+	}
+
+	return &vehicle_info, nil
+}
+
+// saveClient creates or replaces the client whose ID value matches the id
+// parameter.
+// @Summary Create or replace a client
+// @Description Create or replace a client's contact details
+// @Tags clients
+// @Accept json
+// @Param id path string true "Client ID"
+// @Param client body ClientUpdate true "Client details"
+// @Param If-Match header string false "ETag from GET /clients/{id}; the write fails with 412 if the client has changed since"
+// @Success 200 {object} ClientRecord
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security apiKey
+// @Security bearerToken
+// @Router /clients/{id} [put]
+func (h *handlers) saveClient(c *gin.Context) {
+	id := c.Param("id")
+	var update ClientUpdate
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	unlock := h.writes.lock("client:" + id)
+	defer unlock()
+
+	if !checkPreconditions(c, func(ctx context.Context) (any, error) {
+		client, err := h.findClient(ctx, id, includeAll)
+		if err != nil {
+			return nil, err
+		}
+		return versionOf(c).client(client), nil
+	}) {
+		return
+	}
+
+	var client = database.Client{
+		Name:         id,
+		ContactName:  update.ContactName,
+		ContactEmail: update.ContactEmail,
+	}
+
+	if err := h.store.SaveClient(c.Request.Context(), client); err != nil {
+		slog.Error("saving a client failed", "client", id, "err", err)
+		storeFailed(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, ClientRecord{
+		Name:         client.Name,
+		ContactName:  client.ContactName,
+		ContactEmail: client.ContactEmail,
+	})
+}
+
+// saveVehicle creates or replaces the vehicle whose ID value matches the id
+// parameter.
+// @Summary Create or replace a vehicle
+// @Description Create or replace a vehicle, assigning it to an existing client
+// @Tags vehicles
+// @Accept json
+// @Param id path string true "Vehicle ID"
+// @Param vehicle body VehicleUpdate true "Vehicle details"
+// @Param If-Match header string false "ETag from GET /vehicles/{id}; the write fails with 412 if the vehicle has changed since"
+// @Success 200 {object} VehicleRecord
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security apiKey
+// @Security bearerToken
+// @Router /vehicles/{id} [put]
+func (h *handlers) saveVehicle(c *gin.Context) {
+	id := c.Param("id")
+	var update VehicleUpdate
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	unlock := h.writes.lock("vin:" + id)
+	defer unlock()
+
+	if !checkPreconditions(c, func(ctx context.Context) (any, error) {
+		vehicle, err := h.findVehicle(ctx, id, includeAll)
+		if err != nil {
+			return nil, err
+		}
+		return versionOf(c).vehicle(vehicle), nil
+	}) {
+		return
+	}
+
+	var vehicle = database.Vehicle{
+		Vin:     id,
+		Client:  update.Client,
+		Mileage: update.Mileage,
+	}
+
+	// The only record a vehicle refers to is its client, so a missing record
+	// is a body naming an unknown client.
+	if _, err := h.store.SaveVehicle(c.Request.Context(), vehicle); err != nil {
+		slog.Warn("saving a vehicle failed", "vin", id, "err", err)
+		if errors.Is(err, database.ErrNotFound) {
+			c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"message": err.Error()})
+			return
+		}
+		storeFailed(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, VehicleRecord{
+		Vin:     vehicle.Vin,
+		Client:  vehicle.Client,
+		Mileage: vehicle.Mileage,
+	})
+}
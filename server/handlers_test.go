@@ -0,0 +1,668 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+	"github.com/byron-ojua/starter-project/idempotency"
+	"github.com/byron-ojua/starter-project/pool"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeStore is a database.Store held in maps, answering at once. Lookups of
+// the VINs in broken fail, as a store that is partly down would, and every
+// call fails with down if it is set.
+type fakeStore struct {
+	mu       sync.Mutex
+	clients  map[string]database.Client
+	vehicles map[string]database.Vehicle
+	weights  map[string][]database.Weight
+	broken   map[string]bool
+	down     error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		clients: map[string]database.Client{
+			"CIA": {Name: "CIA", ContactName: "Jane", ContactEmail: "jane@cia.gov"},
+			"FBI": {Name: "FBI", ContactName: "John", ContactEmail: "john@fbi.gov"},
+		},
+		vehicles: map[string]database.Vehicle{
+			"1A": {Vin: "1A", Client: "CIA", Mileage: 1200},
+			"1B": {Vin: "1B", Client: "CIA", Mileage: 3400},
+		},
+		weights: map[string][]database.Weight{
+			"1A": {{Vin: "1A", Weight: 9000}, {Vin: "1A", Weight: 12000}},
+		},
+		broken: map[string]bool{},
+	}
+}
+
+func (s *fakeStore) GetAllClients(ctx context.Context) (*[]database.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return nil, s.down
+	}
+	clients := []database.Client{}
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	return &clients, nil
+}
+
+func (s *fakeStore) GetClientsByName(ctx context.Context, name string) (*database.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return nil, s.down
+	}
+	client, found := s.clients[name]
+	if !found {
+		return nil, fmt.Errorf("client does not exist: %w", database.ErrNotFound)
+	}
+	return &client, nil
+}
+
+func (s *fakeStore) GetVehiclesByClient(ctx context.Context, name string) (*[]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return nil, s.down
+	}
+	// Like the real store, an unknown client simply has no vehicles.
+	var vins []string
+	for _, vehicle := range s.vehicles {
+		if vehicle.Client == name {
+			vins = append(vins, vehicle.Vin)
+		}
+	}
+	return &vins, nil
+}
+
+func (s *fakeStore) GetVehicleByVin(ctx context.Context, vin string) (*database.Vehicle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return nil, s.down
+	}
+	vehicle, found := s.vehicles[vin]
+	if !found || s.broken[vin] {
+		return nil, fmt.Errorf("vehicle does not exist: %w", database.ErrNotFound)
+	}
+	return &vehicle, nil
+}
+
+func (s *fakeStore) GetWeightsByVin(ctx context.Context, vin string) (*[]database.Weight, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return nil, s.down
+	}
+	if _, found := s.vehicles[vin]; !found || s.broken[vin] {
+		return nil, fmt.Errorf("vehicle weights do not exist: %w", database.ErrNotFound)
+	}
+	weights := append([]database.Weight{}, s.weights[vin]...)
+	return &weights, nil
+}
+
+func (s *fakeStore) GetClientsByNames(ctx context.Context, names []string) (map[string]database.Client, error) {
+	if s.down != nil {
+		return nil, s.down
+	}
+	found := make(map[string]database.Client)
+	for _, name := range names {
+		if client, err := s.GetClientsByName(ctx, name); err == nil {
+			found[name] = *client
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeStore) GetVehiclesByClients(ctx context.Context, names []string) (map[string][]string, error) {
+	if s.down != nil {
+		return nil, s.down
+	}
+	found := make(map[string][]string)
+	for _, name := range names {
+		if vins, err := s.GetVehiclesByClient(ctx, name); err == nil {
+			found[name] = *vins
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeStore) GetVehiclesByVins(ctx context.Context, vins []string) (map[string]database.Vehicle, error) {
+	if s.down != nil {
+		return nil, s.down
+	}
+	found := make(map[string]database.Vehicle)
+	for _, vin := range vins {
+		if vehicle, err := s.GetVehicleByVin(ctx, vin); err == nil {
+			found[vin] = *vehicle
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeStore) GetWeightsByVins(ctx context.Context, vins []string) (map[string][]database.Weight, error) {
+	if s.down != nil {
+		return nil, s.down
+	}
+	found := make(map[string][]database.Weight)
+	for _, vin := range vins {
+		if weights, err := s.GetWeightsByVin(ctx, vin); err == nil {
+			found[vin] = *weights
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeStore) SaveClient(ctx context.Context, client database.Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return s.down
+	}
+	s.clients[client.Name] = client
+	return nil
+}
+
+func (s *fakeStore) SaveVehicle(ctx context.Context, vehicle database.Vehicle) (*database.Vehicle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return nil, s.down
+	}
+	if _, found := s.clients[vehicle.Client]; !found {
+		return nil, fmt.Errorf("client does not exist: %w", database.ErrNotFound)
+	}
+	previous, found := s.vehicles[vehicle.Vin]
+	s.vehicles[vehicle.Vin] = vehicle
+	if !found {
+		return nil, nil
+	}
+	return &previous, nil
+}
+
+func (s *fakeStore) AddWeight(ctx context.Context, weight database.Weight) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down != nil {
+		return s.down
+	}
+	if _, found := s.vehicles[weight.Vin]; !found {
+		return fmt.Errorf("vehicle does not exist: %w", database.ErrNotFound)
+	}
+	s.weights[weight.Vin] = append(s.weights[weight.Vin], weight)
+	return nil
+}
+
+func (s *fakeStore) Ping(ctx context.Context) error {
+	return s.down
+}
+
+func (s *fakeStore) Close() error {
+	return nil
+}
+
+// newTestRouter serves the handlers from store, without the middleware
+// main adds around them.
+func newTestRouter(store database.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	api := &handlers{store: store, pool: pool.NewLimiter(0, 0)}
+
+	router := gin.New()
+	router.GET("/healthz", api.health)
+	router.GET("/clients", api.getAllClients)
+	router.GET("/clients/:id", api.getClientByID)
+	router.GET("/clients/:id/vehicles", api.getClientVehicles)
+	router.GET("/vehicles/:id", api.getVehicalByID)
+	router.PUT("/clients/:id", api.saveClient)
+	router.PUT("/vehicles/:id", api.saveVehicle)
+	router.POST("/vehicles/:id/weights", api.addWeight)
+	return router
+}
+
+// serveTest sends a request to router and returns the response.
+func serveTest(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+// decodeTest decodes a response body into v, failing the test if it can't.
+func decodeTest(t *testing.T, res *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(res.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", res.Body.String(), err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	store := newFakeStore()
+	router := newTestRouter(store)
+
+	if res := serveTest(router, http.MethodGet, "/healthz", ""); res.Code != http.StatusOK {
+		t.Errorf("got %d, want 200", res.Code)
+	}
+
+	store.down = database.ErrClosed
+	if res := serveTest(router, http.MethodGet, "/healthz", ""); res.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d with the store down, want 503", res.Code)
+	}
+}
+
+func TestGetAllClients(t *testing.T) {
+	res := serveTest(newTestRouter(newFakeStore()), http.MethodGet, "/clients", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", res.Code)
+	}
+
+	var clients []ClientWithVehicles
+	decodeTest(t, res, &clients)
+	if len(clients) != 2 || clients[0].Name != "CIA" || clients[1].Name != "FBI" {
+		t.Fatalf("got %+v, want CIA then FBI", clients)
+	}
+	if clients[0].NumVehicles != 2 || clients[1].NumVehicles != 0 {
+		t.Errorf("got %d and %d vehicles, want 2 and 0", clients[0].NumVehicles, clients[1].NumVehicles)
+	}
+}
+
+func TestGetClientByID(t *testing.T) {
+	router := newTestRouter(newFakeStore())
+
+	res := serveTest(router, http.MethodGet, "/clients/CIA", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", res.Code)
+	}
+	var client ClientWithVehicles
+	decodeTest(t, res, &client)
+	if client.ContactEmail != "jane@cia.gov" || client.NumVehicles != 2 {
+		t.Errorf("got %+v, want jane@cia.gov with 2 vehicles", client)
+	}
+
+	if res := serveTest(router, http.MethodGet, "/clients/NSA", ""); res.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown client, want 404", res.Code)
+	}
+}
+
+func TestGetClientVehicles(t *testing.T) {
+	res := serveTest(newTestRouter(newFakeStore()), http.MethodGet, "/clients/CIA/vehicles", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", res.Code)
+	}
+
+	var vehicles ClientVehicles
+	decodeTest(t, res, &vehicles)
+	largest := make(map[string]int)
+	for _, vehicle := range vehicles.Vehicles {
+		largest[vehicle.Vin] = vehicle.LargestWeight
+	}
+	if len(largest) != 2 || largest["1A"] != 12000 || largest["1B"] != 0 {
+		t.Errorf("got %+v, want 1A at 12000 and 1B at 0", vehicles.Vehicles)
+	}
+}
+
+func TestGetClientVehiclesUnknownOrEmpty(t *testing.T) {
+	router := newTestRouter(newFakeStore())
+
+	// The store lists no vehicles for an unknown client, but the route
+	// knows the client does not exist.
+	if res := serveTest(router, http.MethodGet, "/clients/KGB/vehicles", ""); res.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown client, want 404", res.Code)
+	}
+
+	res := serveTest(router, http.MethodGet, "/clients/FBI/vehicles", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d for a client without vehicles, want 200", res.Code)
+	}
+	var body map[string]any
+	decodeTest(t, res, &body)
+	if vehicles, ok := body["vehicles"].([]any); !ok || len(vehicles) != 0 {
+		t.Errorf("got vehicles %v, want an empty list", body["vehicles"])
+	}
+}
+
+func TestClientVehiclesInVinOrder(t *testing.T) {
+	store := newFakeStore()
+	for _, vin := range []string{"1F", "1C", "1E", "1D"} {
+		store.vehicles[vin] = database.Vehicle{Vin: vin, Client: "CIA"}
+	}
+	router := newTestRouter(store)
+
+	for _, target := range []string{"/clients/CIA/vehicles", "/clients/CIA?expand=vehicles"} {
+		first := serveTest(router, http.MethodGet, target, "")
+		if first.Code != http.StatusOK {
+			t.Fatalf("%s: got %d, want 200", target, first.Code)
+		}
+		for i := 0; i < 10; i++ {
+			res := serveTest(router, http.MethodGet, target, "")
+			if res.Body.String() != first.Body.String() || res.Header().Get("ETag") != first.Header().Get("ETag") {
+				t.Fatalf("%s: the body changed between requests:\n%s\n%s", target, first.Body, res.Body)
+			}
+		}
+
+		var body struct {
+			Vehicles []struct {
+				Vin string `json:"vin"`
+			} `json:"vehicles"`
+		}
+		decodeTest(t, first, &body)
+		var vins []string
+		for _, vehicle := range body.Vehicles {
+			vins = append(vins, vehicle.Vin)
+		}
+		if want := []string{"1A", "1B", "1C", "1D", "1E", "1F"}; strings.Join(vins, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: got vehicles %v, want %v", target, vins, want)
+		}
+	}
+}
+
+func TestGetClientVehiclesPartial(t *testing.T) {
+	store := newFakeStore()
+	store.broken["1B"] = true
+	router := newTestRouter(store)
+
+	res := serveTest(router, http.MethodGet, "/clients/CIA/vehicles", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", res.Code)
+	}
+	var vehicles ClientVehicles
+	decodeTest(t, res, &vehicles)
+	if !vehicles.Partial || len(vehicles.Warnings) == 0 {
+		t.Errorf("got %+v, want a partial response with warnings", vehicles)
+	}
+
+	if res := serveTest(router, http.MethodGet, "/clients/CIA/vehicles?strict=true", ""); res.Code != http.StatusBadGateway {
+		t.Errorf("got %d with strict=true, want 502", res.Code)
+	}
+}
+
+func TestEmbeddedVehicleMissing(t *testing.T) {
+	store := newFakeStore()
+	store.broken["1B"] = true
+
+	res := serveTest(newTestRouter(store), http.MethodGet, "/clients/CIA?expand=vehicles", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", res.Code)
+	}
+	var client ClientWithVehicles
+	decodeTest(t, res, &client)
+	if !client.Partial || len(client.Warnings) != 1 {
+		t.Fatalf("got %+v, want a partial response with one warning", client)
+	}
+	if warning := client.Warnings[0]; warning.Resource != "client:CIA" || warning.Field != "vehicles.mileage" || !strings.Contains(warning.Message, "1B") {
+		t.Errorf("got warning %+v, want one for 1B's mileage", warning)
+	}
+
+	res = serveTest(newTestRouter(store), http.MethodGet, "/clients/CIA?expand=vehicles&strict=true", "")
+	if res.Code != http.StatusBadGateway {
+		t.Errorf("got %d with strict=true, want 502", res.Code)
+	}
+}
+
+func TestIdempotentBodyLimit(t *testing.T) {
+	store := newFakeStore()
+	router := newTestRouter(store)
+	keys := idempotency.NewStore(idempotency.NewMemory(), time.Hour)
+	api := &handlers{store: store, pool: pool.NewLimiter(0, 0)}
+	router.POST("/idempotent/:id/weights", idempotent(keys), api.addWeight)
+
+	send := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/idempotent/1A/weights", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotency.Header, "reading-1")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	padding := strings.Repeat(" ", idempotency.MaxBodySize)
+	if code := send(`{"weight": 100}` + padding); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d for an oversized body, want 413", code)
+	}
+	if code := send(`{"weight": 100}`); code != http.StatusCreated {
+		t.Errorf("got %d after an oversized body, want 201", code)
+	}
+}
+
+func TestGetVehicle(t *testing.T) {
+	router := newTestRouter(newFakeStore())
+
+	res := serveTest(router, http.MethodGet, "/vehicles/1A", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", res.Code)
+	}
+	var vehicle VehicleInfo
+	decodeTest(t, res, &vehicle)
+	if vehicle.ClientName != "CIA" || vehicle.Mileage != 1200 || len(vehicle.Weights) != 2 {
+		t.Errorf("got %+v, want CIA's 1A at 1200 miles with 2 weights", vehicle)
+	}
+
+	if res := serveTest(router, http.MethodGet, "/vehicles/9Z", ""); res.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown vehicle, want 404", res.Code)
+	}
+}
+
+func TestStoreFailures(t *testing.T) {
+	tests := []struct {
+		down error
+		want int
+	}{
+		{database.ErrClosed, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+	calls := []struct{ method, target, body string }{
+		{http.MethodGet, "/clients", ""},
+		{http.MethodGet, "/clients/CIA", ""},
+		{http.MethodGet, "/clients/CIA/vehicles", ""},
+		{http.MethodGet, "/vehicles/1A", ""},
+		{http.MethodPut, "/clients/CIA", `{"contact_name":"Ann","contact_email":"ann@cia.gov"}`},
+		{http.MethodPut, "/vehicles/1A", `{"client":"CIA","mileage":10}`},
+	}
+
+	for _, test := range tests {
+		store := newFakeStore()
+		store.down = test.down
+		router := newTestRouter(store)
+		for _, call := range calls {
+			if res := serveTest(router, call.method, call.target, call.body); res.Code != test.want {
+				t.Errorf("%s %s with %v: got %d, want %d", call.method, call.target, test.down, res.Code, test.want)
+			}
+		}
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	store := newFakeStore()
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dated := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+
+	cia, fbi := store.clients["CIA"], store.clients["FBI"]
+	cia.Updated, fbi.Updated = dated(1), dated(2)
+	store.clients["CIA"], store.clients["FBI"] = cia, fbi
+	a, b := store.vehicles["1A"], store.vehicles["1B"]
+	a.Updated, b.Updated = dated(3), dated(0)
+	store.vehicles["1A"], store.vehicles["1B"] = a, b
+	store.weights["1A"][0].Time = dated(4)
+	router := newTestRouter(store)
+
+	tests := []struct {
+		target string
+		want   time.Time
+	}{
+		{"/clients", dated(2)},
+		{"/clients/CIA", dated(1)},
+		{"/clients/CIA?expand=vehicles", dated(3)},
+		{"/clients/CIA?expand=vehicles.weights", dated(4)},
+		{"/clients/CIA/vehicles", dated(4)},
+		{"/clients/CIA/vehicles?fields=vehicles.vin,vehicles.mileage", dated(3)},
+		{"/vehicles/1A", dated(4)},
+	}
+	for _, test := range tests {
+		res := serveTest(router, http.MethodGet, test.target, "")
+		if got, want := res.Header().Get("Last-Modified"), test.want.Format(http.TimeFormat); got != want {
+			t.Errorf("%s: got Last-Modified %q, want %q", test.target, got, want)
+			continue
+		}
+
+		req := httptest.NewRequest(http.MethodGet, test.target, nil)
+		req.Header.Set("If-Modified-Since", test.want.Format(http.TimeFormat))
+		res = httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		if res.Code != http.StatusNotModified {
+			t.Errorf("%s: got %d when not modified since, want 304", test.target, res.Code)
+		}
+	}
+
+	// A partial response may be missing newer data, so it has no date.
+	store.broken["1B"] = true
+	if res := serveTest(router, http.MethodGet, "/clients/CIA/vehicles", ""); res.Header().Get("Last-Modified") != "" {
+		t.Errorf("got Last-Modified %q on a partial response, want none", res.Header().Get("Last-Modified"))
+	}
+}
+
+func TestPreconditionStoreFailure(t *testing.T) {
+	store := newFakeStore()
+	router := newTestRouter(store)
+
+	// Only a missing resource fails If-Match; a store that can't answer is
+	// not the same as a resource that doesn't exist.
+	req := httptest.NewRequest(http.MethodPut, "/clients/NSA", strings.NewReader(`{"contact_name":"Ann","contact_email":"ann@nsa.gov"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"stale"`)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusPreconditionFailed {
+		t.Errorf("got %d for a missing client, want 412", res.Code)
+	}
+
+	store.down = database.ErrClosed
+	req = httptest.NewRequest(http.MethodPut, "/clients/NSA", strings.NewReader(`{"contact_name":"Ann","contact_email":"ann@nsa.gov"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"stale"`)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d with the store closed, want 503", res.Code)
+	}
+}
+
+func TestSaveClient(t *testing.T) {
+	store := newFakeStore()
+	router := newTestRouter(store)
+
+	res := serveTest(router, http.MethodPut, "/clients/NSA", `{"contact_name":"Ann","contact_email":"ann@nsa.gov"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d: %s, want 200", res.Code, res.Body)
+	}
+	if client, found := store.clients["NSA"]; !found || client.ContactEmail != "ann@nsa.gov" {
+		t.Errorf("got %+v in the store, want NSA saved", client)
+	}
+
+	if res := serveTest(router, http.MethodPut, "/clients/NSA", `{"contact_name":"Ann","contact_email":"not an email"}`); res.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an invalid email, want 400", res.Code)
+	}
+}
+
+func TestSaveVehicle(t *testing.T) {
+	store := newFakeStore()
+	router := newTestRouter(store)
+
+	res := serveTest(router, http.MethodPut, "/vehicles/2A", `{"client":"FBI","mileage":10}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d: %s, want 200", res.Code, res.Body)
+	}
+	if vehicle := store.vehicles["2A"]; vehicle.Client != "FBI" || vehicle.Mileage != 10 {
+		t.Errorf("got %+v in the store, want 2A saved for FBI", vehicle)
+	}
+
+	if res := serveTest(router, http.MethodPut, "/vehicles/2A", `{"client":"NSA","mileage":10}`); res.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got %d for an unknown client, want 422", res.Code)
+	}
+}
+
+func TestAddWeight(t *testing.T) {
+	store := newFakeStore()
+	router := newTestRouter(store)
+
+	if res := serveTest(router, http.MethodPost, "/vehicles/1B/weights", `{"weight":8000}`); res.Code != http.StatusCreated {
+		t.Fatalf("got %d: %s, want 201", res.Code, res.Body)
+	}
+	if weights := store.weights["1B"]; len(weights) != 1 || weights[0].Weight != 8000 {
+		t.Errorf("got %+v in the store, want one reading of 8000", weights)
+	}
+
+	if res := serveTest(router, http.MethodPost, "/vehicles/9Z/weights", `{"weight":8000}`); res.Code != http.StatusNotFound {
+		t.Errorf("got %d for an unknown vehicle, want 404", res.Code)
+	}
+
+	store.down = database.ErrClosed
+	if res := serveTest(router, http.MethodPost, "/vehicles/1B/weights", `{"weight":8000}`); res.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %d with the store closed, want 503", res.Code)
+	}
+}
+
+func TestStreamResumeAfterReplayBuffer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bus := events.NewBus(2)
+	defer bus.Close()
+	api := &handlers{store: newFakeStore(), pool: pool.NewLimiter(0, 0), bus: bus}
+
+	router := gin.New()
+	router.GET("/vehicles/:id/weights/stream", api.streamVehicleWeights)
+
+	for _, weight := range []float32{100, 200, 300} {
+		bus.Publish(events.Event{Type: events.WeightAdded, Vin: "1A", Data: database.Weight{Vin: "1A", Weight: weight}})
+	}
+
+	tests := []struct {
+		name, lastID string
+		want         []string
+		notWant      []string
+	}{
+		{"held", "1", []string{"id: 2\nevent: weight", "id: 3\nevent: weight"}, []string{"event: reset"}},
+		{"dropped", "0", []string{"id: 3\nevent: reset"}, []string{"event: weight"}},
+		{"from before a restart", "7", []string{"id: 3\nevent: reset"}, []string{"event: weight"}},
+		{"up to date", "3", nil, []string{"event: reset", "event: weight"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			req := httptest.NewRequest(http.MethodGet, "/vehicles/1A/weights/stream", nil).WithContext(ctx)
+			req.Header.Set("Last-Event-ID", test.lastID)
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			body := res.Body.String()
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("got %q, want it to contain %q", body, want)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(body, notWant) {
+					t.Errorf("got %q, want no %q", body, notWant)
+				}
+			}
+		})
+	}
+}
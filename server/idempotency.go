@@ -0,0 +1,163 @@
+/*
+* @file idempotency.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the middleware that honours the Idempotency-Key header
+* on POST endpoints, so a client retrying a request it never got an answer to
+* doesn't repeat the write.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/byron-ojua/starter-project/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentHeaders are the response headers replayed with a stored
+// response. The rest are set afresh by the middleware for each request.
+var idempotentHeaders = []string{"Content-Type", "Location"}
+
+// idempotent stores the first response to each Idempotency-Key and replays
+// it for later requests with the same key. A key reused with a different
+// request is refused with 422, and one whose first request is still being
+// handled with 409. Keys are scoped to the logged in user, or to the caller's
+// IP address on routes without a login. Requests without the header are
+// handled as usual.
+func idempotent(store *idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotency.Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > idempotency.MaxKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("%s must be at most %d characters", idempotency.Header, idempotency.MaxKeyLength),
+			})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, idempotency.MaxBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"message": fmt.Sprintf("request bodies sent with %s must be at most %d bytes", idempotency.Header, idempotency.MaxBodySize),
+			})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "error reading request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scoped := idempotencyScope(c) + ":" + key
+		fingerprint := requestFingerprint(c.Request, body)
+
+		entry, claimed := store.Begin(scoped, fingerprint)
+		if !claimed {
+			switch {
+			case entry.Fingerprint != fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+					"message": fmt.Sprintf("%s was already used for a different request", idempotency.Header),
+				})
+			case entry.Response == nil:
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"message": fmt.Sprintf("a request with this %s is still being handled", idempotency.Header),
+				})
+			default:
+				replayResponse(c, entry.Response)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// If the handler panics or fails on the server's side, the key is
+		// released so the client's retry is handled again.
+		finished := false
+		defer func() {
+			if !finished {
+				store.Abandon(scoped)
+			}
+		}()
+
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		response := idempotency.Response{
+			Status: recorder.Status(),
+			Header: make(http.Header),
+			Body:   recorder.body.Bytes(),
+		}
+		for _, name := range idempotentHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				response.Header.Set(name, value)
+			}
+		}
+		store.Finish(scoped, fingerprint, response)
+		finished = true
+	}
+}
+
+// replayResponse sends a stored response.
+func replayResponse(c *gin.Context, response *idempotency.Response) {
+	for name, values := range response.Header {
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Header(idempotency.ReplayedHeader, "true")
+	c.Status(response.Status)
+	c.Writer.Write(response.Body)
+	c.Abort()
+}
+
+// idempotencyScope names whose keys a request's key is among.
+func idempotencyScope(c *gin.Context) string {
+	if subject, found := userSubject(c); found {
+		return "user:" + subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// requestFingerprint identifies a request by its method, path and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
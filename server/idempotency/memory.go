@@ -0,0 +1,94 @@
+package idempotency
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process Backend. Expired entries are dropped as new ones
+// are added.
+type Memory struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an empty Memory backend.
+func NewMemory() *Memory {
+	return &Memory{
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Add stores value under key for ttl unless an unexpired value is already
+// stored.
+func (m *Memory) Add(key string, value []byte, ttl time.Duration) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+
+	if element, found := m.entries[key]; found {
+		return element.Value.(*memoryEntry).value, false
+	}
+
+	m.store(key, value, ttl)
+	return nil, true
+}
+
+// Set stores value under key for ttl, replacing any stored value.
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, found := m.entries[key]; found {
+		m.order.Remove(element)
+		delete(m.entries, key)
+	}
+	m.store(key, value, ttl)
+}
+
+// Delete removes key.
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, found := m.entries[key]; found {
+		m.order.Remove(element)
+		delete(m.entries, key)
+	}
+}
+
+func (m *Memory) store(key string, value []byte, ttl time.Duration) {
+	m.entries[key] = m.order.PushBack(&memoryEntry{
+		key:     key,
+		value:   value,
+		expires: m.now().Add(ttl),
+	})
+}
+
+// expire drops expired entries. Entries are kept in the order they were
+// stored, and the window is the same for all of them, so the oldest are at
+// the front.
+func (m *Memory) expire() {
+	now := m.now()
+	for element := m.order.Front(); element != nil; element = m.order.Front() {
+		entry := element.Value.(*memoryEntry)
+		if entry.expires.After(now) {
+			return
+		}
+		m.order.Remove(element)
+		delete(m.entries, entry.key)
+	}
+}
@@ -0,0 +1,98 @@
+// Package idempotency remembers the responses to requests sent with an
+// Idempotency-Key, so a client retrying a request it is unsure about gets the
+// first response again instead of repeating the write.
+package idempotency
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Header is the request header carrying the client's key.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses that were replayed from the store.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength is the longest key accepted.
+const MaxKeyLength = 255
+
+// MaxBodySize is the largest request body, in bytes, accepted with a key. The
+// body is read into memory to fingerprint the request.
+const MaxBodySize = 1 << 20
+
+// Backend stores encoded entries by key. Values are byte slices so a shared
+// backend such as Redis can implement the same interface as the in-process
+// Memory backend.
+type Backend interface {
+	// Add stores value under key for ttl unless the key is already stored,
+	// in which case it returns the stored value and false.
+	Add(key string, value []byte, ttl time.Duration) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// Response is a stored response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body"`
+}
+
+// Entry is what is stored for a key: a fingerprint of the request that first
+// used it and, once that request has finished, its response.
+type Entry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Response    *Response `json:"response,omitempty"`
+}
+
+// Store claims keys for requests and keeps their responses for a window.
+type Store struct {
+	backend Backend
+	window  time.Duration
+}
+
+// NewStore returns a Store keeping responses in backend for window.
+func NewStore(backend Backend, window time.Duration) *Store {
+	return &Store{backend: backend, window: window}
+}
+
+// Begin claims key for a request with fingerprint. If the key was already
+// claimed it returns the existing entry and false; its Response is nil while
+// the first request is still being handled.
+func (s *Store) Begin(key, fingerprint string) (*Entry, bool) {
+	value, err := json.Marshal(Entry{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, false
+	}
+
+	stored, added := s.backend.Add(key, value, s.window)
+	if added {
+		return nil, true
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(stored, &entry); err != nil {
+		// An entry that can't be read is no use to anyone; start again.
+		s.backend.Set(key, value, s.window)
+		return nil, true
+	}
+	return &entry, false
+}
+
+// Finish stores the response to the request that claimed key.
+func (s *Store) Finish(key, fingerprint string, response Response) {
+	value, err := json.Marshal(Entry{Fingerprint: fingerprint, Response: &response})
+	if err != nil {
+		s.backend.Delete(key)
+		return
+	}
+	s.backend.Set(key, value, s.window)
+}
+
+// Abandon releases key without storing a response, so the request can be
+// retried.
+func (s *Store) Abandon(key string) {
+	s.backend.Delete(key)
+}
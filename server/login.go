@@ -0,0 +1,150 @@
+/*
+* @file login.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the handlers for the login form and the admin operations
+* used to manage login lockouts.
+ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// loginHandlers serves the password login form. Failed attempts are tracked
+// per IP and per account by guard, which delays and eventually locks out
+// repeated failures.
+type loginHandlers struct {
+	password   string
+	guard      *auth.LoginGuard
+	sessions   *auth.SessionStore
+	cookies    auth.CookieConfig
+	ssoEnabled bool
+}
+
+// show serves the login form.
+func (h *loginHandlers) show(c *gin.Context) {
+	h.render(c, http.StatusOK, gin.H{})
+}
+
+// render renders the login form with the request's CSRF token.
+func (h *loginHandlers) render(c *gin.Context, status int, data gin.H) {
+	data["csrf_token"] = c.GetString(auth.CSRFFieldName)
+	data["sso"] = h.ssoEnabled
+	c.HTML(status, "login.html", data)
+}
+
+// submit checks the submitted password and starts a session.
+func (h *loginHandlers) submit(c *gin.Context) {
+	ip := c.ClientIP()
+	username := c.PostForm("username")
+	password := c.PostForm("password")
+
+	if wait, locked := h.guard.Check(ip, username); wait > 0 {
+		c.Header("Retry-After", fmt.Sprint(int(wait.Round(time.Second).Seconds())))
+		var message string
+		if locked {
+			message = "Too many failed attempts. Your login is locked."
+		} else {
+			message = "Please wait before trying again."
+		}
+		h.render(c, http.StatusTooManyRequests, gin.H{
+			"error":     message,
+			"remaining": wait.Round(time.Second).String(),
+			"username":  username,
+		})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(password), []byte(h.password)) != 1 {
+		h.guard.Fail(ip, username)
+		h.render(c, http.StatusUnauthorized, gin.H{
+			"error":    "Invalid password, please try again.",
+			"username": username,
+		})
+		return
+	}
+
+	h.guard.Succeed(ip, username)
+
+	// The shared password grants full access.
+	session, err := h.sessions.Create(auth.SessionPassword, auth.User{
+		Subject: username,
+		Name:    username,
+		Roles:   []string{auth.RoleAdmin, auth.RoleViewer},
+	})
+	if err != nil {
+		slog.Error("creating a session failed", "err", err)
+		h.render(c, http.StatusInternalServerError, gin.H{"error": "Unable to log in, please try again."})
+		return
+	}
+
+	http.SetCookie(c.Writer, h.cookies.Cookie(auth.SessionCookieName, session.ID, true))
+	if _, err := issueCSRFToken(c, h.cookies); err != nil {
+		slog.Error("creating a CSRF token failed", "err", err)
+	}
+	c.Redirect(http.StatusFound, "/swagger/index.html")
+}
+
+// listLockouts responds with every IP and account that is currently locked out.
+// @Summary List login lockouts
+// @Description List every IP address and account currently locked out after failed logins
+// @Tags admin
+// @Produce json
+// @Success 200 {array} auth.Lockout
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/lockouts [get]
+func (h *loginHandlers) listLockouts(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, h.guard.Lockouts())
+}
+
+// unlock clears the failed attempts recorded for the ip and/or account query
+// parameters so they can log in again immediately.
+// @Summary Unlock a login lockout
+// @Description Clear the failed logins recorded for an IP address and/or account
+// @Tags admin
+// @Produce json
+// @Param ip query string false "IP address to unlock"
+// @Param account query string false "Account to unlock"
+// @Success 200 {object} map[string][]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/lockouts [delete]
+func (h *loginHandlers) unlock(c *gin.Context) {
+	ip := c.Query("ip")
+	account := c.Query("account")
+
+	if ip == "" && account == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "ip or account is required"})
+		return
+	}
+
+	var unlocked []string
+	if ip != "" && h.guard.Unlock(auth.IPKey(ip)) {
+		unlocked = append(unlocked, auth.IPKey(ip))
+	}
+	if account != "" && h.guard.Unlock(auth.AccountKey(account)) {
+		unlocked = append(unlocked, auth.AccountKey(account))
+	}
+
+	if len(unlocked) == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "no failed attempts recorded"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"unlocked": unlocked})
+}
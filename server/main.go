@@ -5,54 +5,42 @@
 *
 * @section DESCRIPTION
 *
-* This file contains the main function and the handlers for the API endpoints.
+* This file contains the main function and the middleware shared by every route.
  */
 
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
 	"net/http"
-	"sync"
-
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/byron-ojua/starter-project/audit"
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/cache"
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/byron-ojua/starter-project/cors"
 	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+	"github.com/byron-ojua/starter-project/pool"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"github.com/byron-ojua/starter-project/webhooks"
 	"github.com/gin-gonic/gin"
 
 	_ "github.com/byron-ojua/starter-project/docs"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-// ClientWithVehicles is a struct that represents a client and the number of vehicles they have.
-type ClientWithVehicles struct {
-	Name         string `json:"name"`
-	ContactName  string `json:"contact_name"`
-	ContactEmail string `json:"contact_email"`
-	NumVehicles  int    `json:"number_of_vehicles"`
-}
-
-// VehicleInfo is a struct that represents a vehicle and its owner's information.
-type VehicleInfo struct {
-	Vin          string `json:"vin"`
-	ClientName   string `json:"client_name"`
-	ContactName  string `json:"contact_name"`
-	ContactEmail string `json:"contact_email"`
-	Mileage      int    `json:"mileage"`
-	Weights      []int  `json:"weights"`
-}
-
-// ClientVehicle is a struct that represents a vehicle and its basic information.
-type ClientVehicle struct {
-	Vin           string `json:"vin"`
-	Mileage       int    `json:"mileage"`
-	LargestWeight int    `json:"largest_weight"`
-}
-
-// ClientVehicles is a struct that represents a client and their vehicles.
-type ClientVehicles struct {
-	Name     string          `json:"name"`
-	Vehicles []ClientVehicle `json:"vehicles"`
-}
+//go:generate swag init
+//go:generate go run . openapi docs/openapi.json
 
 // @title Simple API
 // @version 1
@@ -66,373 +54,354 @@ type ClientVehicles struct {
 // @in header
 // @name Authorization
 
+// @securityDefinitions.apikey apiKey
+// @in header
+// @name X-API-Key
+
 // @host localhost:8080
 // @BasePath /
 func main() {
-	router := gin.Default()
-	router.Use(corsMiddleware())
-
-	// Serve the login form
-	router.GET("/login", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "login.html", nil)
-	})
+	// Settings come from defaults, a config file, environment variables and
+	// flags; what is left names a command to run instead of serving.
+	settings, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Handle form submission and set a session/cookie
-	router.POST("/login", func(c *gin.Context) {
-		password := c.PostForm("password")
-		if password == "password" { // Replace with your actual password
-			c.SetCookie("authenticated", "true", 3600, "/", "localhost", false, true)
-			c.Redirect(http.StatusFound, "/swagger/index.html")
-		} else {
-			c.HTML(http.StatusUnauthorized, "login.html", gin.H{
-				"error": "Invalid password, please try again.",
-			})
+	// "config print" shows the settings in effect, with secrets redacted.
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) != 2 || args[1] != "print" {
+			log.Fatal("usage: server [flags] config print")
 		}
-	})
-
-	// Apply password protection to the Swagger documentation
-	router.GET("/swagger/*any", passwordProtected(), ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	// Your existing routes
-	router.GET("/clients", getAllClients)
-	router.GET("/clients/:id", getClientByID)
-	router.GET("/clients/:id/vehicles", getClientVehicles)
-	router.GET("/vehicles/:id", getVehicalByID)
-
-	router.LoadHTMLGlob("templates/*")
-	router.Run("localhost:8080")
-}
-
-func passwordProtected() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if cookie, err := c.Cookie("authenticated"); err != nil || cookie != "true" {
-			c.Redirect(http.StatusFound, "/login")
-			c.Abort()
-			return
+		if err := settings.Print(os.Stdout); err != nil {
+			log.Fatal(err)
 		}
-		c.Next()
+		return
+	}
+	if len(args) > 0 && args[0] != "openapi" {
+		log.Fatalf("unknown command %q", args[0])
 	}
-}
-
-// corsMiddleware is a middleware function that adds the necessary headers to allow CORS requests.
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(settings.Log.Level)
+	setupLogging(logLevel)
 
-		c.Next()
+	cookies, err := cookieConfig(settings.Auth.Cookie)
+	if err != nil {
+		log.Fatal(err)
 	}
-}
 
-// getAllClients responds with the list of all clients as JSON.
-// @Summary Get all clients
-// @Description Get all clients and the number of vehicles they have
-// @Tags clients
-// @Success 200 {array} ClientWithVehicles
-// @Router /clients [get]
-func getAllClients(c *gin.Context) {
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-
-	db, err_db := database.New()
-	var clients *[]database.Client
-	var err_client error
-	var vehicles_by_client = make(map[string]int)
-	var all_clients []ClientWithVehicles
-
-	if err_db != nil {
-		fmt.Println(err_db)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "error retrieving clients"})
-		return
+	auditLog := audit.NewLog()
+	if path := settings.Audit.File; path != "" {
+		if auditLog, err = audit.Open(path); err != nil {
+			log.Fatal(err)
+		}
 	}
+	defer auditLog.Close()
 
-	clients, err_client = db.GetAllClients()
-
-	if err_client != nil {
-		fmt.Println(err_client)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "clients not found"})
-		return
+	store, err := openStore(settings.Store)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer store.Close()
 
-	wg.Add(len(*clients))
+	if err := store.Ping(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
-	// Use Goroutines to speed up the process of getting the number of vehicles for each client.
-	for i := 0; i < len(*clients); i++ {
-		var client_name string = (*clients)[i].Name
-		go func(client_name string) {
-			defer wg.Done()
-			temp_vehicles, err_vehicle := db.GetVehiclesByClient(client_name)
+	cachedStore := cache.NewStore(database.NewCoalesced(store), cache.NewLRU(settings.Cache.Size), time.Duration(settings.Cache.TTL))
 
-			if err_vehicle != nil {
-				fmt.Println(err_vehicle)
-				return
-			}
+	bus := events.NewBus(1000)
+	defer bus.Close()
 
-			// Maps are not thread-safe, so we need to use a mutex to prevent
-			mu.Lock()
-			vehicles_by_client[client_name] = len(*temp_vehicles)
-			mu.Unlock()
-		}(client_name)
+	api := &handlers{
+		store: audit.NewStore(events.NewStore(cachedStore, bus), auditLog),
+		pool:  pool.NewLimiter(settings.Fanout.Global, settings.Fanout.PerRequest),
+		bus:   bus,
 	}
 
-	wg.Wait()
-
-	for i := 0; i < len(*clients); i++ {
-		var client_name string = (*clients)[i].Name
-		all_clients = append(all_clients, ClientWithVehicles{
-			Name:         client_name,
-			ContactName:  (*clients)[i].ContactName,
-			ContactEmail: (*clients)[i].ContactEmail,
-			NumVehicles:  vehicles_by_client[client_name],
-		})
+	hooks, err := webhooks.Open(webhookOptions(settings.Webhooks))
+	if err != nil {
+		log.Fatal(err)
 	}
+	deliveries, stopDeliveries := context.WithCancel(context.Background())
+	go hooks.Run(deliveries, bus)
 
-	c.IndentedJSON(http.StatusOK, all_clients)
-}
+	limits, err := rateLimitPolicy(settings.RateLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	limiter := ratelimit.NewLimiter(limits, ratelimit.NewMemory())
+	sessions := auth.NewSessionStore(time.Duration(cookies.MaxAge) * time.Second)
+
+	scheduleVersions(settings.API)
+	handler, spec, err := newRouter(settings, services{
+		api:      api,
+		cache:    cachedStore,
+		auditLog: auditLog,
+		webhooks: hooks,
+		sessions: sessions,
+		cookies:  cookies,
+		limiter:  limiter,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 
-// getClientByID locates the client whose ID value matches the id
-// parameter sent by the client, then returns that client as a response.
-// @Summary Get a client by ID
-// @Description Get a client by their ID and the number of vehicles they have
-// @Tags clients
-// @Param id path string true "Client ID"
-// @Success 200 {object} ClientWithVehicles
-// @Router /clients/{id} [get]
-func getClientByID(c *gin.Context) {
-	id := c.Param("id")
-	var wg sync.WaitGroup
-	var client *database.Client
-	var err_client error
-	var vehicles = new([]string)
-	var err_vehicles error
-	db, err_db := database.New()
-
-	if err_db != nil {
-		fmt.Println(err_db)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "error retrieving client"})
+	// "openapi <file>" writes the document out instead of serving it.
+	if len(args) > 0 && args[0] == "openapi" {
+		if len(args) != 2 {
+			log.Fatal("usage: server [flags] openapi <file>")
+		}
+		if err := writeOpenAPI(spec.doc, args[1]); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
-	wg.Add(2)
-
-	// Use Goroutines to speed up the process of getting the client and their vehicles.
-	go func() {
-		defer wg.Done()
-		client, err_client = db.GetClientsByName(id)
-	}()
-
+	// gRPC is served on its own port from the same store and sessions.
+	grpcServer := newGRPCServer(api, sessions, limiter, auditLog)
 	go func() {
-		defer wg.Done()
-		vehicles, err_vehicles = db.GetVehiclesByClient(id)
+		if err := serveGRPC(settings.Server.GRPCAddr, grpcServer); err != nil {
+			slog.Error("serving gRPC failed", "err", err)
+		}
 	}()
 
-	wg.Wait()
+	// SIGHUP applies a changed log level and rate limits without a restart.
+	reload, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	reloadOnHangup(reload, os.Args[1:], settings, logLevel, limiter)
 
-	// Error handling
-	if err_client != nil {
-		fmt.Println(err_client)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err_client.Error()})
-		return
+	if err := serve(settings.Server.Addr, handler, stopDeliveries, grpcServer.GracefulStop, bus.Close); err != nil {
+		slog.Error("serving HTTP failed", "err", err)
 	}
+}
+
+// serve runs handler on addr until the process receives SIGINT or SIGTERM,
+// then waits for in-flight requests to finish before returning. onShutdown
+// is called as shutdown starts, to end long-lived requests such as streams.
+func serve(addr string, handler http.Handler, onShutdown ...func()) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	var numVehicles int
-	if err_vehicles != nil {
-		numVehicles = 0
-	} else {
-		numVehicles = len(*vehicles)
+	server := &http.Server{Addr: addr, Handler: handler}
+	for _, f := range onShutdown {
+		server.RegisterOnShutdown(f)
 	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
 
-	var clientInfo = ClientWithVehicles{
-		Name:         client.Name,
-		ContactName:  client.ContactName,
-		ContactEmail: client.ContactEmail,
-		NumVehicles:  numVehicles,
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
 	}
 
-	c.IndentedJSON(http.StatusOK, clientInfo)
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdown)
 }
 
-// getVehicalByID locates the vehicle whoses ID value matches the id
-// parameter sent by the client, then returns that vehicle as a response.
-// @Summary Get a vehicle by ID
-// @Description Get a vehicle by its ID and its owner's information
-// @Tags vehicles
-// @Param id path string true "Vehicle ID"
-// @Success 200 {object} VehicleInfo
-// @Router /vehicles/{id} [get]
-func getClientVehicles(c *gin.Context) {
-	id := c.Param("id")
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var vehicle_vins *[]string
-	var err_vins error
-	var vehicle_info = make(map[string]ClientVehicle)
-
-	db, err_db := database.New()
-
-	if err_db != nil {
-		fmt.Println(err_db)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "error retrieving vehicles"})
-		return
+// passwordProtected only lets through requests with a valid session, whether
+// it was started with the password form or through single sign-on. The
+// session's user is stored in the context under "user".
+func passwordProtected(sessions *auth.SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := c.Cookie(auth.SessionCookieName)
+		if err != nil {
+			c.Redirect(http.StatusFound, "/login")
+			c.Abort()
+			return
+		}
+
+		session, found := sessions.Get(id)
+		if !found {
+			c.Redirect(http.StatusFound, "/login")
+			c.Abort()
+			return
+		}
+
+		c.Set("user", session.User)
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), session.User))
+		c.Next()
 	}
+}
 
-	vehicle_vins, err_vins = db.GetVehiclesByClient(id)
+// apiProtected rejects requests that carry neither a known API key nor a
+// session, in the session cookie or an "Authorization: Bearer" header. Its
+// callers are programs, so they get 401 rather than a redirect to the login
+// form. A caller with an API key is recorded as the key's name.
+func apiProtected(sessions *auth.SessionStore, limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user auth.User
+		if key := c.GetHeader(apiKeyHeader); key != "" {
+			if _, found := limiter.KeyPlan(key); !found {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unknown API key"})
+				return
+			}
+			user = auth.User{Subject: apiKeyName(key)}
+		} else if session, found := sessions.Get(sessionID(c)); found {
+			user = session.User
+		} else {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "a session or API key is required"})
+			return
+		}
 
-	if err_vins != nil {
-		fmt.Println(err_vins)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err_vins.Error()})
-		return
+		c.Set("user", user)
+		c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), user))
+		c.Next()
 	}
+}
 
-	// create default objects for vehicleInfo map
-	for i := 0; i < len(*vehicle_vins); i++ {
-		vehicle_info[(*vehicle_vins)[i]] = ClientVehicle{
-			Vin:           (*vehicle_vins)[i],
-			Mileage:       0,
-			LargestWeight: 0,
+// requireRole rejects requests whose user, set by passwordProtected, does not
+// have role.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.MustGet("user").(auth.User)
+		if !ok || !user.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "forbidden"})
+			return
 		}
+		c.Next()
 	}
+}
 
-	// Get the vehicle mileage and weight for each vehicle.
-	// These calls are made using Goroutines to speed up the process.
-	for i := 0; i < len(*vehicle_vins); i++ {
-		wg.Add(2)
-		var vin string = (*vehicle_vins)[i]
-		go func(vin string) {
-			defer wg.Done()
-			vehicle, err_vehicle := db.GetVehicleByVin(vin)
-
-			if err_vehicle != nil {
-				fmt.Println(err_vehicle)
+// csrfMiddleware implements double-submit CSRF protection. It makes sure every
+// caller has a CSRF token cookie and exposes the token to templates. It
+// rejects state-changing form posts, and any state-changing request a session
+// cookie would authenticate, whose submitted token does not match the cookie.
+// A cross-site form can send a JSON-shaped text/plain body, so requests are
+// checked whatever their content type.
+func csrfMiddleware(cookies auth.CookieConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(auth.CSRFCookieName)
+		if err != nil || token == "" {
+			if token, err = issueCSRFToken(c, cookies); err != nil {
+				slog.Error("creating a CSRF token failed", "err", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "error creating csrf token"})
 				return
 			}
+		}
+		c.Set(auth.CSRFFieldName, token)
 
-			// Update the vehicleInfo map with the vehicle mileage.
-			// Maps are not thread-safe, so we need to use a mutex to prevent
-			mu.Lock()
-			vInfo := vehicle_info[vin] // You can't update a field in a struct in a map directly, so you need to get the struct first.
-			vInfo.Mileage = vehicle.Mileage
-			vehicle_info[vin] = vInfo
-			mu.Unlock()
-		}(vin)
-
-		go func(vin string) {
-			defer wg.Done()
-			weights, err_weights := db.GetWeightsByVin(vin)
-
-			if err_weights != nil {
-				fmt.Println(err_weights)
-				return
+		if isStateChanging(c.Request.Method) && (isFormPost(c) || hasSessionCookie(c)) {
+			var submitted string
+			if isFormPost(c) {
+				submitted = c.PostForm(auth.CSRFFieldName)
 			}
-
-			var largest_weight int
-
-			for i := 0; i < len(*weights); i++ {
-				if int((*weights)[i].Weight) > largest_weight {
-					largest_weight = int((*weights)[i].Weight)
-				}
+			if submitted == "" {
+				submitted = c.GetHeader(auth.CSRFHeaderName)
 			}
+			if !auth.CSRFTokensMatch(token, submitted) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "invalid csrf token"})
+				return
+			}
+		}
 
-			// Update the vehicleInfo map with the largest weight.
-			// Maps are not thread-safe, so we need to use a mutex to prevent
-			mu.Lock()
-			vInfo := vehicle_info[vin] // You can't update a field in a struct in a map directly, so you need to get the struct first.
-			vInfo.LargestWeight = largest_weight
-			vehicle_info[vin] = vInfo
-			mu.Unlock()
-		}(vin)
+		c.Next()
 	}
+}
 
-	wg.Wait()
-
-	// sent the response using the vehicleInfo map
-	var client_vehicles ClientVehicles
-	client_vehicles.Name = id
-
-	for key := range vehicle_info {
-		client_vehicles.Vehicles = append(client_vehicles.Vehicles, vehicle_info[key])
+// issueCSRFToken sets a new CSRF token cookie and returns the token. It is
+// called again when a user logs in, so a token planted before the login
+// can't be used against their session.
+func issueCSRFToken(c *gin.Context, cookies auth.CookieConfig) (string, error) {
+	token, err := auth.NewCSRFToken()
+	if err != nil {
+		return "", err
 	}
+	// Scripts read the cookie to send the token back in the X-CSRF-Token
+	// header, so it is not HttpOnly.
+	http.SetCookie(c.Writer, cookies.Cookie(auth.CSRFCookieName, token, false))
+	c.Set(auth.CSRFFieldName, token)
+	return token, nil
+}
 
-	c.IndentedJSON(http.StatusOK, client_vehicles)
+// hasSessionCookie reports whether the request carries a session cookie,
+// which a browser sends even with requests started by other sites.
+func hasSessionCookie(c *gin.Context) bool {
+	id, err := c.Cookie(auth.SessionCookieName)
+	return err == nil && id != ""
 }
 
-// getClientByID locates the client whose ID value matches the id
-// parameter sent by the client, then returns that client as a response.
-// @Summary Get a client by ID
-// @Description Get a client by their ID and the number of vehicles they have
-// @Tags clients
-// @Param id path string true "Client ID"
-// @Success 200 {object} ClientWithVehicles
-// @Router /clients/{id} [get]
-func getVehicalByID(c *gin.Context) {
-	id := c.Param("id")
-	var wg sync.WaitGroup
-	var vehicle *database.Vehicle
-	var err_vehicle error
-	var weights *[]database.Weight
-	var err_weight error
-	var client *database.Client
-	var err_client error
-
-	db, err_db := database.New()
-
-	if err_db != nil {
-		fmt.Println(err_db)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "error retrieving vehicle"})
-		return
+// isStateChanging reports whether method can modify server state.
+func isStateChanging(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
 	}
+	return false
+}
 
-	wg.Add(2)
+// isFormPost reports whether the request body is an HTML form submission.
+func isFormPost(c *gin.Context) bool {
+	switch c.ContentType() {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		return true
+	}
+	return false
+}
 
-	// Use Goroutines to speed up the process of getting the vehicle, its weights, and its client.
-	go func() {
-		defer wg.Done()
-		vehicle, err_vehicle = db.GetVehicleByVin(id)
-	}()
+// corsMiddleware applies policy to cross-origin requests. Preflight requests
+// are answered here and never reach a handler.
+func corsMiddleware(policy cors.Policy) gin.HandlerFunc {
+	allowedMethods := strings.Join(policy.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(policy.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(policy.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(policy.MaxAge.Seconds()))
 
-	go func() {
-		defer wg.Done()
-		weights, err_weight = db.GetWeightsByVin(id)
-	}()
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		// The response depends on the origin, so caches must key on it.
+		c.Writer.Header().Add("Vary", "Origin")
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
 
-	wg.Wait()
+		if origin == "" {
+			c.Next()
+			return
+		}
 
-	// Error handling
-	if err_vehicle != nil {
-		fmt.Println(err_vehicle, err_weight)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err_vehicle.Error()})
-		return
-	}
+		if !policy.AllowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
 
-	client, err_client = db.GetClientsByName(vehicle.Client)
+		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		if policy.AllowCredentials {
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
 
-	if err_client != nil {
-		fmt.Println(err_vehicle, err_weight, err_client)
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "error retrieving vehicle"})
-		return
-	}
+		if !preflight {
+			if exposedHeaders != "" {
+				c.Writer.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			c.Next()
+			return
+		}
 
-	var int_weights []int
-	if *weights != nil {
-		for i := 0; i < len(*weights); i++ {
-			int_weights = append(int_weights, int((*weights)[i].Weight))
+		if !policy.AllowsMethod(c.GetHeader("Access-Control-Request-Method")) ||
+			!policy.AllowsHeaders(c.GetHeader("Access-Control-Request-Headers")) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
 		}
-	}
 
-	var vehicle_info = VehicleInfo{
-		Vin:          vehicle.Vin,
-		ClientName:   client.Name,
-		ContactName:  client.ContactName,
-		ContactEmail: client.ContactEmail,
-		Mileage:      vehicle.Mileage,
-		Weights:      int_weights,
+		c.Writer.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		c.Writer.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+		c.Writer.Header().Set("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
 	}
-
-	c.IndentedJSON(http.StatusOK, vehicle_info)
 }
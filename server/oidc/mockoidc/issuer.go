@@ -0,0 +1,236 @@
+// Package mockoidc is a minimal in-process OpenID provider. It signs in a
+// fixed user without prompting, so the SSO login flow can be exercised end to
+// end without network access or a real identity provider.
+package mockoidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byron-ojua/starter-project/oidc"
+)
+
+// User is an identity the mock issuer can sign in.
+type User struct {
+	Subject string
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+// Issuer is an http.Handler serving the discovery, authorization, token and
+// JWKS endpoints of a mock OpenID provider. URL must be set to the address the
+// handler is reachable at before it serves requests.
+type Issuer struct {
+	URL      string
+	ClientID string
+
+	// User is signed in by every authorization request, unless login_hint
+	// names one of Users.
+	User  User
+	Users map[string]User
+
+	key   *rsa.PrivateKey
+	kid   string
+	mux   *http.ServeMux
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+type grant struct {
+	user        User
+	redirectURI string
+	challenge   string
+	nonce       string
+	expires     time.Time
+}
+
+// New returns an Issuer for clientID that signs in user.
+func New(clientID string, user User) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := oidc.NewState()
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := &Issuer{
+		ClientID: clientID,
+		User:     user,
+		Users:    map[string]User{},
+		key:      key,
+		kid:      kid,
+		mux:      http.NewServeMux(),
+		codes:    make(map[string]grant),
+	}
+
+	issuer.mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	issuer.mux.HandleFunc("/authorize", issuer.authorize)
+	issuer.mux.HandleFunc("/token", issuer.token)
+	issuer.mux.HandleFunc("/jwks", issuer.jwks)
+
+	return issuer, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (i *Issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.mux.ServeHTTP(w, r)
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	base := strings.TrimSuffix(i.URL, "/")
+	writeJSON(w, http.StatusOK, oidc.Discovery{
+		Issuer:                base,
+		AuthorizationEndpoint: base + "/authorize",
+		TokenEndpoint:         base + "/token",
+		JWKSURI:               base + "/jwks",
+		CodeChallengeMethods:  []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.JSONWebKeySet{
+		Keys: []oidc.JSONWebKey{oidc.NewJSONWebKey(i.kid, &i.key.PublicKey)},
+	})
+}
+
+// authorize signs the user in immediately and redirects back to the client
+// with an authorization code.
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	switch {
+	case query.Get("response_type") != "code":
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	case query.Get("client_id") != i.ClientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		http.Error(w, "S256 code_challenge is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	user := i.User
+	if hinted, found := i.Users[query.Get("login_hint")]; found {
+		user = hinted
+	}
+
+	code, err := oidc.NewState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	i.mu.Lock()
+	i.codes[code] = grant{
+		user:        user,
+		redirectURI: redirectURI.String(),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		expires:     time.Now().Add(time.Minute),
+	}
+	i.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token exchanges an authorization code for a signed ID token.
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	// Codes are single use, so remove it whether or not the exchange succeeds.
+	i.mu.Lock()
+	g, found := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	case !found || time.Now().After(g.expires):
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	case r.PostForm.Get("client_id") != i.ClientID:
+		tokenError(w, "invalid_client", "")
+		return
+	case r.PostForm.Get("redirect_uri") != g.redirectURI:
+		tokenError(w, "invalid_grant", "redirect_uri does not match")
+		return
+	case oidc.S256Challenge(r.PostForm.Get("code_verifier")) != g.challenge:
+		tokenError(w, "invalid_grant", "code_verifier does not match")
+		return
+	}
+
+	now := time.Now()
+	idToken, err := oidc.SignRS256(i.key, i.kid, map[string]any{
+		"iss":    strings.TrimSuffix(i.URL, "/"),
+		"sub":    g.user.Subject,
+		"aud":    i.ClientID,
+		"exp":    now.Add(time.Hour).Unix(),
+		"iat":    now.Unix(),
+		"nonce":  g.nonce,
+		"email":  g.user.Email,
+		"name":   g.user.Name,
+		"groups": g.user.Groups,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := oidc.NewState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
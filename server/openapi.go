@@ -0,0 +1,504 @@
+/*
+* @file openapi.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the OpenAPI 3.1 document built from the handlers'
+* annotations and the routes they are served on, and the middleware that
+* checks requests and responses against it in test mode.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/byron-ojua/starter-project/apiclient"
+	"github.com/byron-ojua/starter-project/audit"
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/cache"
+	"github.com/byron-ojua/starter-project/docs"
+	"github.com/byron-ojua/starter-project/graph"
+	"github.com/byron-ojua/starter-project/openapi"
+	"github.com/byron-ojua/starter-project/web"
+	"github.com/byron-ojua/starter-project/webhooks"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	// The annotations name this package's types main.X, which is only its
+	// package path outside tests.
+	openapi.MainPackage = reflect.TypeOf(openAPISpec{}).PkgPath()
+}
+
+// openAPITypes are the types the annotations name as bodies. The types of
+// their fields are found from these.
+var openAPITypes = []any{
+	audit.Entry{},
+	auth.Lockout{},
+	cache.Stats{},
+	graph.Request{},
+	webhooks.Delivery{},
+	webhooks.Subscription{},
+	web.Config{},
+	BatchRequest{},
+	BatchResponse{},
+	ClientRecord{},
+	ClientUpdate{},
+	ClientVehicles{},
+	ClientWithVehicles{},
+	NewWebhook{},
+	NewWeightReading{},
+	PartialFailure{},
+	VehicleInfo{},
+	VehicleRecord{},
+	VehicleUpdate{},
+	WeightReading{},
+}
+
+// clientTypes pairs the types the server sends and accepts with the copies
+// in the apiclient package, which must keep the same JSON shape.
+var clientTypes = [][2]any{
+	{ClientV2{}, apiclient.ClientInfo{}},
+	{ClientVehiclesV2{}, apiclient.ClientVehicles{}},
+	{VehicleV2{}, apiclient.VehicleInfo{}},
+	{ClientUpdate{}, apiclient.ClientUpdate{}},
+	{ClientRecord{}, apiclient.ClientRecord{}},
+	{VehicleUpdate{}, apiclient.VehicleUpdate{}},
+	{VehicleRecord{}, apiclient.VehicleRecord{}},
+	{NewWeightReading{}, apiclient.NewWeightReading{}},
+	{WeightReading{}, apiclient.WeightReading{}},
+	{Warning{}, apiclient.Warning{}},
+}
+
+// openAPIUndocumented are the routes left out of the document: the HTML
+// login pages, the docs UI, the frontend, the WebSocket and CORS preflights.
+var openAPIUndocumented = []string{
+	"GET /",
+	"GET /login",
+	"POST /login",
+	"GET /login/sso",
+	"GET /login/sso/callback",
+	"GET /swagger/*any",
+	"GET /ws",
+	"OPTIONS /*path",
+}
+
+// messageSchema is the body of the errors the shared middleware responds
+// with.
+var messageSchema = &openapi.Schema{
+	Type:                 openapi.Types{"object"},
+	AdditionalProperties: &openapi.Schema{Type: openapi.Types{"string"}},
+}
+
+// buildOpenAPI builds the OpenAPI document for routes from the swag
+// annotations. Each versioned route gets its own copy of the annotated
+// operation, with that version's response types. A route with no
+// annotations, annotations with no route, or an apiclient type that no
+// longer matches the server's is an error: the document has drifted from
+// the code.
+func buildOpenAPI(routes gin.RoutesInfo) (*openapi.Document, error) {
+	types := make([]reflect.Type, 0, len(openAPITypes))
+	for _, value := range openAPITypes {
+		types = append(types, reflect.TypeOf(value))
+	}
+	annotated, err := openapi.FromSwagger([]byte(docs.SwaggerInfo.ReadDoc()), types)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &openapi.Document{
+		OpenAPI:    annotated.OpenAPI,
+		Info:       annotated.Info,
+		Servers:    annotated.Servers,
+		Paths:      make(map[string]openapi.PathItem),
+		Components: annotated.Components,
+	}
+
+	// Unversioned routes that are also served under a version prefix pick
+	// their version from the Accept header.
+	negotiated := make(map[string]bool)
+	for _, route := range routes {
+		if _, path, found := routeVersion(route.Path); found {
+			negotiated[route.Method+" "+path] = true
+		}
+	}
+
+	var errs []error
+	routed := make(map[string]bool)
+	for _, route := range routes {
+		if contains(openAPIUndocumented, route.Method+" "+route.Path) {
+			continue
+		}
+
+		version, path, versioned := routeVersion(route.Path)
+		annotation := openAPIPath(path)
+		source, found := annotated.Operation(route.Method, annotation)
+		if !found {
+			errs = append(errs, fmt.Errorf("%s %s has no annotations", route.Method, route.Path))
+			continue
+		}
+		routed[route.Method+" "+annotation] = true
+
+		op := source.Clone()
+		if versioned {
+			op.Deprecated = !version.Deprecated.IsZero()
+			renamed := make(map[string]string, len(version.schemas))
+			for name, value := range version.schemas {
+				t := reflect.TypeOf(value)
+				doc.SchemaOf(t)
+				renamed[name] = openapi.SchemaName(t)
+			}
+			op.RenameSchemas(renamed)
+		}
+
+		addResponse(op, http.StatusUnauthorized, "Unknown API key")
+		addResponse(op, http.StatusTooManyRequests, "Rate limit exceeded")
+		addResponse(op, http.StatusInternalServerError, "Internal server error")
+		if isStateChanging(route.Method) {
+			addResponse(op, http.StatusForbidden, "Invalid CSRF token")
+		}
+		if !versioned && negotiated[route.Method+" "+route.Path] {
+			addResponse(op, http.StatusNotAcceptable, "The Accept header asks for a version that does not exist")
+		}
+
+		item := doc.Paths[openAPIPath(route.Path)]
+		if item == nil {
+			item = make(openapi.PathItem)
+			doc.Paths[openAPIPath(route.Path)] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	for path, item := range annotated.Paths {
+		for method := range item {
+			if !routed[strings.ToUpper(method)+" "+path] {
+				errs = append(errs, fmt.Errorf("%s %s is annotated but not routed", strings.ToUpper(method), path))
+			}
+		}
+	}
+
+	for _, pair := range clientTypes {
+		server, copied := reflect.TypeOf(pair[0]), reflect.TypeOf(pair[1])
+		for _, diff := range openapi.Compare(server, copied) {
+			errs = append(errs, fmt.Errorf("%s has drifted from %s: %s", copied, server, diff))
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return nil, errors.Join(errs...)
+	}
+	return doc, nil
+}
+
+// routeVersion splits a version prefix from a route's path.
+func routeVersion(path string) (*apiVersion, string, bool) {
+	for _, version := range apiVersions {
+		if rest, found := strings.CutPrefix(path, "/"+version.Name+"/"); found {
+			return version, "/" + rest, true
+		}
+	}
+	return nil, path, false
+}
+
+// openAPIPath converts a gin route such as /clients/:id to an OpenAPI path
+// such as /clients/{id}.
+func openAPIPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// addResponse documents a response the shared middleware can send, unless
+// the annotations already do.
+func addResponse(op *openapi.Operation, status int, description string) {
+	code := strconv.Itoa(status)
+	if _, found := op.Responses[code]; found {
+		return
+	}
+	op.Responses[code] = &openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: messageSchema}},
+	}
+}
+
+// writeOpenAPI writes doc to path as indented JSON.
+func writeOpenAPI(doc *openapi.Document, path string) error {
+	data, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// openAPISpec holds the OpenAPI document. Routes are registered before the
+// document can be built from them, so it is set once they all are.
+type openAPISpec struct {
+	doc *openapi.Document
+}
+
+// serve responds with the OpenAPI document built from the annotations.
+// @Summary Get the OpenAPI document
+// @Description Get the OpenAPI 3.1 document describing every route
+// @Tags docs
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /openapi.json [get]
+func (s *openAPISpec) serve(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, s.doc)
+}
+
+// validate checks each request against the document before it is handled,
+// refusing it with 400 if it does not match, and checks the response after.
+// A response with an undocumented status or a body that does not match its
+// schema is replaced with a 500 listing what differs. Streams are passed
+// through once the request is checked.
+func (s *openAPISpec) validate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" || contains(openAPIUndocumented, c.Request.Method+" "+route) {
+			c.Next()
+			return
+		}
+
+		op, found := s.doc.Operation(c.Request.Method, openAPIPath(route))
+		if !found {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"message": "route is not in the OpenAPI spec",
+				"errors":  []string{c.Request.Method + " " + route},
+			})
+			return
+		}
+
+		if errs := s.checkRequest(c, op); len(errs) > 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"message": "request does not match the OpenAPI spec",
+				"errors":  errs,
+			})
+			return
+		}
+
+		if streams(op) {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() { c.Writer = writer.ResponseWriter }()
+
+		c.Next()
+
+		c.Writer = writer.ResponseWriter
+
+		// An unversioned route responds in the version it negotiated.
+		if version, found := c.Get(apiVersionKey); found && !strings.HasPrefix(route, "/"+version.(*apiVersion).Name+"/") {
+			if versioned, found := s.doc.Operation(c.Request.Method, openAPIPath("/"+version.(*apiVersion).Name+route)); found {
+				op = versioned
+			}
+		}
+
+		if errs := s.checkResponse(op, writer); len(errs) > 0 {
+			slog.Warn("a response does not match the OpenAPI document", "method", c.Request.Method, "url", c.Request.URL.String(), "errors", strings.Join(errs, "; "))
+			header := c.Writer.Header()
+			for _, name := range []string{"Content-Disposition", "Content-Length", "ETag", "Last-Modified"} {
+				header.Del(name)
+			}
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"message": "response does not match the OpenAPI spec",
+				"errors":  errs,
+			})
+			return
+		}
+
+		writer.flush()
+	}
+}
+
+// checkRequest returns each way the request's parameters and body differ
+// from op. The body is put back for the handler to read.
+func (s *openAPISpec) checkRequest(c *gin.Context, op *openapi.Operation) []string {
+	var errs []string
+
+	query := c.Request.URL.Query()
+	documented := make(map[string]bool)
+	for _, param := range op.Parameters {
+		var values []string
+		switch param.In {
+		case "path":
+			values = []string{c.Param(param.Name)}
+		case "query":
+			documented[param.Name] = true
+			values = query[param.Name]
+		case "header":
+			values = c.Request.Header.Values(param.Name)
+		}
+
+		if len(values) == 0 {
+			if param.Required {
+				errs = append(errs, fmt.Sprintf("%s parameter %s is required", param.In, param.Name))
+			}
+			continue
+		}
+		for _, value := range values {
+			errs = append(errs, s.doc.ValidateParameter(param, value)...)
+		}
+	}
+	for name := range query {
+		if !documented[name] {
+			errs = append(errs, fmt.Sprintf("query parameter %s is not documented", name))
+		}
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return append(errs, "body could not be read: "+err.Error())
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	switch {
+	case op.RequestBody == nil:
+		if len(body) > 0 {
+			errs = append(errs, "body is not documented")
+		}
+	case len(body) == 0:
+		if op.RequestBody.Required {
+			errs = append(errs, "body is required")
+		}
+	default:
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		media, found := op.RequestBody.Content[mediaType]
+		if !found {
+			errs = append(errs, fmt.Sprintf("body content type %q is not documented", mediaType))
+		} else if isJSONMediaType(mediaType) {
+			errs = append(errs, s.doc.ValidateJSON(media.Schema, body)...)
+		}
+	}
+
+	sort.Strings(errs)
+	return errs
+}
+
+// checkResponse returns each way a buffered response differs from op.
+func (s *openAPISpec) checkResponse(op *openapi.Operation, w *bufferedWriter) []string {
+	status := w.Status()
+	response, found := op.Responses[strconv.Itoa(status)]
+	if !found {
+		response, found = op.Responses["default"]
+	}
+	if !found {
+		return []string{fmt.Sprintf("status %d is not documented", status)}
+	}
+
+	// Redirects and empty bodies, such as 204 and 304, have nothing to check.
+	if w.body.Len() == 0 || (status >= 300 && status < 400) {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	media, found := response.Content[mediaType]
+	if !found {
+		return []string{fmt.Sprintf("content type %q is not documented for status %d", mediaType, status)}
+	}
+	if !isJSONMediaType(mediaType) {
+		return nil
+	}
+	return s.doc.ValidateJSON(media.Schema, w.body.Bytes())
+}
+
+// streams reports whether op responds with a stream of events, which is
+// sent as it is written rather than buffered and checked.
+func streams(op *openapi.Operation) bool {
+	for _, response := range op.Responses {
+		if _, found := response.Content["text/event-stream"]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONMediaType reports whether a media type is JSON, such as
+// application/json or application/vnd.fleet.v2+json.
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// bufferedWriter holds a response back until it has been checked.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if !w.written {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+// Flush does nothing; the response is sent once it has been checked.
+func (w *bufferedWriter) Flush() {}
+
+func (w *bufferedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+// flush sends the buffered response.
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.Status())
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		slog.Warn("writing a response failed", "err", err)
+	}
+}
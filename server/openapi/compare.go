@@ -0,0 +1,122 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Compare returns each way the JSON values of types a and b differ: fields
+// only one of them has, and fields whose values have different types. It is
+// used to keep copies of a type, such as those in a client library, in step
+// with the original. Type names and descriptions are ignored.
+func Compare(a, b reflect.Type) []string {
+	left := &Document{Components: Components{Schemas: make(map[string]*Schema)}}
+	right := &Document{Components: Components{Schemas: make(map[string]*Schema)}}
+
+	c := comparison{left: left, right: right, seen: make(map[[2]string]bool)}
+	c.compare(left.SchemaOf(a), right.SchemaOf(b), "")
+	sort.Strings(c.diffs)
+	return c.diffs
+}
+
+type comparison struct {
+	left, right *Document
+	seen        map[[2]string]bool
+	diffs       []string
+}
+
+func (c *comparison) compare(l, r *Schema, at string) {
+	if l.Ref != "" || r.Ref != "" {
+		// Types that refer to themselves are only compared once.
+		key := [2]string{l.Ref, r.Ref}
+		if c.seen[key] {
+			return
+		}
+		c.seen[key] = true
+		l, r = c.left.resolve(l), c.right.resolve(r)
+	}
+
+	where := at
+	if where == "" {
+		where = "value"
+	}
+
+	if describeType(l) != describeType(r) {
+		c.diffs = append(c.diffs, fmt.Sprintf("%s is %s, not %s", where, describeType(r), describeType(l)))
+		return
+	}
+
+	for i := range l.AnyOf {
+		c.compare(l.AnyOf[i], r.AnyOf[i], at)
+	}
+	if l.Items != nil {
+		c.compare(l.Items, r.Items, at+"[]")
+	}
+	if additional, ok := l.AdditionalProperties.(*Schema); ok {
+		c.compare(additional, r.AdditionalProperties.(*Schema), at+"{}")
+	}
+
+	names := make([]string, 0, len(l.Properties))
+	for name := range l.Properties {
+		names = append(names, name)
+	}
+	for name := range r.Properties {
+		if _, found := l.Properties[name]; !found {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		field := strings.TrimPrefix(at+"."+name, ".")
+		left, inLeft := l.Properties[name]
+		right, inRight := r.Properties[name]
+		switch {
+		case !inRight:
+			c.diffs = append(c.diffs, fmt.Sprintf("%s is missing", field))
+		case !inLeft:
+			c.diffs = append(c.diffs, fmt.Sprintf("%s is not in the original", field))
+		default:
+			c.compare(left, right, field)
+		}
+	}
+}
+
+// resolve follows a reference to a component schema.
+func (d *Document) resolve(s *Schema) *Schema {
+	if name, found := strings.CutPrefix(s.Ref, schemaRefPrefix); found {
+		if resolved, found := d.Components.Schemas[name]; found {
+			return resolved
+		}
+	}
+	return s
+}
+
+// describeType summarises what a schema allows at its top level, so two
+// schemas with different descriptions can be told apart.
+func describeType(s *Schema) string {
+	var kinds []string
+	for _, option := range s.AnyOf {
+		if option.Ref != "" {
+			kinds = append(kinds, "object")
+		} else {
+			kinds = append(kinds, describeType(option))
+		}
+	}
+	kinds = append(kinds, s.Type...)
+	if s.Format != "" {
+		kinds = append(kinds, s.Format)
+	}
+	if s.ContentEncoding != "" {
+		kinds = append(kinds, s.ContentEncoding)
+	}
+	if _, ok := s.AdditionalProperties.(*Schema); ok {
+		kinds = append(kinds, "map")
+	}
+	if len(kinds) == 0 {
+		return "any"
+	}
+	slices.Sort(kinds)
+	return strings.Join(kinds, " or ")
+}
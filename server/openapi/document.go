@@ -0,0 +1,247 @@
+// Package openapi builds an OpenAPI 3.1 document from the Swagger 2.0
+// document swag generates from the handlers' annotations, and validates
+// requests and responses against it.
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Version is the OpenAPI version of the documents built here.
+const Version = "3.1.0"
+
+// Document is an OpenAPI 3.1 document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Version     string   `json:"version"`
+	Contact     *Contact `json:"contact,omitempty"`
+}
+
+// Contact is who to ask about the API.
+type Contact struct {
+	Name  string `json:"name,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// Server is where the API is served.
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem is the operations on a path, keyed by lower case method.
+type PathItem map[string]*Operation
+
+// Operation is one method on one path.
+type Operation struct {
+	Tags        []string             `json:"tags,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path, query or header parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation accepts.
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response is one of an operation's responses.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body in one media type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the schemas operations refer to.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way of authenticating.
+type SecurityScheme struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	In   string `json:"in,omitempty"`
+}
+
+// Schema is a JSON Schema. An empty Schema allows any value.
+type Schema struct {
+	Ref             string             `json:"$ref,omitempty"`
+	Type            Types              `json:"type,omitempty"`
+	Format          string             `json:"format,omitempty"`
+	ContentEncoding string             `json:"contentEncoding,omitempty"`
+	Description     string             `json:"description,omitempty"`
+	Enum            []any              `json:"enum,omitempty"`
+	AnyOf           []*Schema          `json:"anyOf,omitempty"`
+	Properties      map[string]*Schema `json:"properties,omitempty"`
+	Required        []string           `json:"required,omitempty"`
+	Items           *Schema            `json:"items,omitempty"`
+
+	// AdditionalProperties is nil to allow any other properties, false to
+	// allow none, or a *Schema they must match.
+	AdditionalProperties any `json:"additionalProperties,omitempty"`
+}
+
+// Types is a schema's allowed types. A single type is written as a string.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// schemaRefPrefix starts a reference to a component schema.
+const schemaRefPrefix = "#/components/schemas/"
+
+// SchemaRef returns a reference to the component schema called name.
+func SchemaRef(name string) *Schema {
+	return &Schema{Ref: schemaRefPrefix + name}
+}
+
+// Operation returns the operation for method on path, if there is one.
+func (d *Document) Operation(method, path string) (*Operation, bool) {
+	op, found := d.Paths[path][strings.ToLower(method)]
+	return op, found
+}
+
+// Clone returns a deep copy of op, so it can be changed without changing
+// op.
+func (op *Operation) Clone() *Operation {
+	clone := *op
+	clone.Tags = append([]string(nil), op.Tags...)
+
+	clone.Parameters = nil
+	for _, param := range op.Parameters {
+		copied := *param
+		copied.Schema = param.Schema.clone()
+		clone.Parameters = append(clone.Parameters, &copied)
+	}
+
+	if op.RequestBody != nil {
+		body := *op.RequestBody
+		body.Content = cloneContent(op.RequestBody.Content)
+		clone.RequestBody = &body
+	}
+
+	clone.Responses = make(map[string]*Response, len(op.Responses))
+	for status, response := range op.Responses {
+		copied := *response
+		copied.Content = cloneContent(response.Content)
+		clone.Responses[status] = &copied
+	}
+	return &clone
+}
+
+func cloneContent(content map[string]MediaType) map[string]MediaType {
+	if content == nil {
+		return nil
+	}
+	clone := make(map[string]MediaType, len(content))
+	for mediaType, media := range content {
+		clone[mediaType] = MediaType{Schema: media.Schema.clone()}
+	}
+	return clone
+}
+
+func (s *Schema) clone() *Schema {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	clone.Type = append(Types(nil), s.Type...)
+	clone.Required = append([]string(nil), s.Required...)
+	clone.Items = s.Items.clone()
+
+	clone.AnyOf = nil
+	for _, option := range s.AnyOf {
+		clone.AnyOf = append(clone.AnyOf, option.clone())
+	}
+	if s.Properties != nil {
+		clone.Properties = make(map[string]*Schema, len(s.Properties))
+		for name, property := range s.Properties {
+			clone.Properties[name] = property.clone()
+		}
+	}
+	if additional, ok := s.AdditionalProperties.(*Schema); ok {
+		clone.AdditionalProperties = additional.clone()
+	}
+	return &clone
+}
+
+// RenameSchemas changes the references in op to component schemas named in
+// names to the schemas they map to.
+func (op *Operation) RenameSchemas(names map[string]string) {
+	visit := func(s *Schema) {
+		walkSchema(s, func(s *Schema) {
+			if name, found := strings.CutPrefix(s.Ref, schemaRefPrefix); found {
+				if renamed, found := names[name]; found {
+					s.Ref = schemaRefPrefix + renamed
+				}
+			}
+		})
+	}
+
+	for _, param := range op.Parameters {
+		visit(param.Schema)
+	}
+	if op.RequestBody != nil {
+		for _, media := range op.RequestBody.Content {
+			visit(media.Schema)
+		}
+	}
+	for _, response := range op.Responses {
+		for _, media := range response.Content {
+			visit(media.Schema)
+		}
+	}
+}
+
+// walkSchema calls f on s and every schema inside it.
+func walkSchema(s *Schema, f func(*Schema)) {
+	if s == nil {
+		return
+	}
+	f(s)
+	for _, option := range s.AnyOf {
+		walkSchema(option, f)
+	}
+	for _, property := range s.Properties {
+		walkSchema(property, f)
+	}
+	walkSchema(s.Items, f)
+	if additional, ok := s.AdditionalProperties.(*Schema); ok {
+		walkSchema(additional, f)
+	}
+}
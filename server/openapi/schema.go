@@ -0,0 +1,136 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawType     = reflect.TypeOf(json.RawMessage{})
+	headerType  = reflect.TypeOf(http.Header{})
+	stringTypes = Types{"string"}
+)
+
+// MainPackage is the import path of the package swag was run in, whose
+// types it names main.X. That is their package path in a command, but not in
+// the command's test binary, which imports it by its full path.
+var MainPackage = "main"
+
+// SchemaName is the name a struct type's schema has in the components, in
+// the form swag uses: the last element of its package path and its name,
+// such as main.VehicleInfo.
+func SchemaName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.PkgPath() == MainPackage {
+		return "main." + t.Name()
+	}
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// SchemaOf returns the schema of values of type t as encoding/json writes
+// them. Struct types are added to the components and referred to, and
+// fields that can be written as null, such as pointers and slices without
+// omitempty, allow null. Only the struct's fields are allowed.
+func (d *Document) SchemaOf(t reflect.Type) *Schema {
+	return d.schemaOf(t, false)
+}
+
+func (d *Document) schemaOf(t reflect.Type, nullable bool) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: stringTypes, Format: "date-time"}
+	case rawType:
+		return &Schema{}
+	case headerType:
+		return orNull(&Schema{
+			Type:                 Types{"object"},
+			AdditionalProperties: &Schema{Type: Types{"array"}, Items: &Schema{Type: stringTypes}},
+		}, nullable)
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return orNull(d.schemaOf(t.Elem(), false), nullable)
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return &Schema{Type: stringTypes}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return orNull(&Schema{Type: stringTypes, ContentEncoding: "base64"}, nullable && t.Kind() == reflect.Slice)
+		}
+		return orNull(&Schema{Type: Types{"array"}, Items: d.schemaOf(t.Elem(), true)}, nullable && t.Kind() == reflect.Slice)
+	case reflect.Map:
+		return orNull(&Schema{Type: Types{"object"}, AdditionalProperties: d.schemaOf(t.Elem(), true)}, nullable)
+	case reflect.Struct:
+		name := SchemaName(t)
+		if _, found := d.Components.Schemas[name]; !found {
+			schema := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema), AdditionalProperties: false}
+			// Added before its fields, so a type that refers to itself
+			// does not recurse forever.
+			d.Components.Schemas[name] = schema
+			d.addFields(schema, t)
+		}
+		return SchemaRef(name)
+	}
+	return &Schema{}
+}
+
+// addFields adds the fields encoding/json writes for struct type t to
+// schema, including those of embedded structs.
+func (d *Document) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		omitempty := strings.Contains(","+options+",", ",omitempty,")
+		schema.Properties[name] = d.schemaOf(field.Type, !omitempty)
+	}
+}
+
+// orNull allows null as well as schema if nullable is set.
+func orNull(schema *Schema, nullable bool) *Schema {
+	if !nullable {
+		return schema
+	}
+	if schema.Ref != "" {
+		return &Schema{AnyOf: []*Schema{schema, {Type: Types{"null"}}}}
+	}
+	schema.Type = append(schema.Type, "null")
+	return schema
+}
@@ -0,0 +1,242 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The parts of a Swagger 2.0 document FromSwagger reads.
+type swagger struct {
+	Info                swaggerInfo                            `json:"info"`
+	Host                string                                 `json:"host"`
+	BasePath            string                                 `json:"basePath"`
+	Paths               map[string]map[string]swaggerOperation `json:"paths"`
+	Definitions         map[string]*swaggerSchema              `json:"definitions"`
+	SecurityDefinitions map[string]SecurityScheme              `json:"securityDefinitions"`
+}
+
+type swaggerInfo struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Contact     *Contact `json:"contact"`
+}
+
+type swaggerOperation struct {
+	Tags        []string                   `json:"tags"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description"`
+	Consumes    []string                   `json:"consumes"`
+	Produces    []string                   `json:"produces"`
+	Parameters  []swaggerParameter         `json:"parameters"`
+	Responses   map[string]swaggerResponse `json:"responses"`
+}
+
+type swaggerParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Required    bool           `json:"required"`
+	Type        string         `json:"type"`
+	Format      string         `json:"format"`
+	Items       *swaggerSchema `json:"items"`
+	Schema      *swaggerSchema `json:"schema"`
+}
+
+type swaggerResponse struct {
+	Description string         `json:"description"`
+	Schema      *swaggerSchema `json:"schema"`
+}
+
+type swaggerSchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 string                    `json:"type"`
+	Format               string                    `json:"format"`
+	Description          string                    `json:"description"`
+	Enum                 []any                     `json:"enum"`
+	Properties           map[string]*swaggerSchema `json:"properties"`
+	Required             []string                  `json:"required"`
+	Items                *swaggerSchema            `json:"items"`
+	AdditionalProperties json.RawMessage           `json:"additionalProperties"`
+}
+
+// FromSwagger converts a Swagger 2.0 document to OpenAPI 3.1.
+//
+// Each definition the document refers to is generated from the Go type of
+// the same name instead of being converted, since only the type knows which
+// fields can be null and that no others are sent. The types are those in
+// types and the types of their fields. The definition's descriptions and
+// required fields are kept. A definition with no type is an error, so the
+// document can't drift from the code.
+func FromSwagger(data []byte, types []reflect.Type) (*Document, error) {
+	var source swagger
+	if err := json.Unmarshal(data, &source); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       source.Info.Title,
+			Description: source.Info.Description,
+			Version:     source.Info.Version,
+			Contact:     source.Info.Contact,
+		},
+		Paths: make(map[string]PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: source.SecurityDefinitions,
+		},
+	}
+	if source.Host != "" {
+		doc.Servers = []Server{{URL: "http://" + source.Host + source.BasePath}}
+	}
+
+	for _, t := range types {
+		doc.SchemaOf(t)
+	}
+
+	var missing []string
+	for name, definition := range source.Definitions {
+		schema, found := doc.Components.Schemas[name]
+		if !found {
+			missing = append(missing, name)
+			continue
+		}
+		describe(schema, definition)
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("no Go type is registered for %s", strings.Join(missing, ", "))
+	}
+
+	for path, operations := range source.Paths {
+		item := make(PathItem, len(operations))
+		for method, source := range operations {
+			item[method] = convertOperation(source)
+		}
+		doc.Paths[path] = item
+	}
+
+	return doc, nil
+}
+
+// describe copies a definition's descriptions and required fields to the
+// schema generated for it.
+func describe(schema *Schema, definition *swaggerSchema) {
+	if schema == nil || definition == nil {
+		return
+	}
+	schema.Description = definition.Description
+	schema.Required = definition.Required
+	for name, property := range definition.Properties {
+		if generated, found := schema.Properties[name]; found {
+			generated.Description = property.Description
+		}
+	}
+}
+
+func convertOperation(source swaggerOperation) *Operation {
+	op := &Operation{
+		Tags:        source.Tags,
+		Summary:     source.Summary,
+		Description: source.Description,
+		Responses:   make(map[string]*Response, len(source.Responses)),
+	}
+
+	consumes := source.Consumes
+	if len(consumes) == 0 {
+		consumes = []string{"application/json"}
+	}
+	produces := source.Produces
+	if len(produces) == 0 {
+		produces = []string{"application/json"}
+	}
+
+	for _, param := range source.Parameters {
+		if param.In == "body" {
+			op.RequestBody = &RequestBody{
+				Description: param.Description,
+				Required:    param.Required,
+				Content:     content(consumes, convertSchema(param.Schema)),
+			}
+			continue
+		}
+
+		schema := &Schema{Type: Types{param.Type}, Format: param.Format}
+		if param.Type == "array" {
+			schema.Items = convertSchema(param.Items)
+		}
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:        param.Name,
+			In:          param.In,
+			Description: param.Description,
+			Required:    param.Required,
+			Schema:      schema,
+		})
+	}
+
+	for status, response := range source.Responses {
+		converted := &Response{Description: response.Description}
+		if response.Schema != nil {
+			converted.Content = content(produces, convertSchema(response.Schema))
+		}
+		op.Responses[status] = converted
+	}
+
+	return op
+}
+
+func content(mediaTypes []string, schema *Schema) map[string]MediaType {
+	results := make(map[string]MediaType, len(mediaTypes))
+	for _, mediaType := range mediaTypes {
+		results[mediaType] = MediaType{Schema: schema}
+	}
+	return results
+}
+
+// convertSchema converts a Swagger 2.0 schema written inline in an
+// operation.
+func convertSchema(source *swaggerSchema) *Schema {
+	if source == nil {
+		return nil
+	}
+
+	schema := &Schema{
+		Format:      source.Format,
+		Description: source.Description,
+		Enum:        source.Enum,
+		Required:    source.Required,
+		Items:       convertSchema(source.Items),
+	}
+	if name, found := strings.CutPrefix(source.Ref, "#/definitions/"); found {
+		schema.Ref = schemaRefPrefix + name
+	}
+	if source.Type != "" {
+		schema.Type = Types{source.Type}
+	}
+	for name, property := range source.Properties {
+		if schema.Properties == nil {
+			schema.Properties = make(map[string]*Schema)
+		}
+		schema.Properties[name] = convertSchema(property)
+	}
+
+	// additionalProperties is either a boolean or a schema.
+	var allowed bool
+	var additional swaggerSchema
+	switch {
+	case len(source.AdditionalProperties) == 0:
+	case json.Unmarshal(source.AdditionalProperties, &allowed) == nil:
+		if !allowed {
+			schema.AdditionalProperties = false
+		}
+	case json.Unmarshal(source.AdditionalProperties, &additional) == nil:
+		schema.AdditionalProperties = convertSchema(&additional)
+	}
+
+	return schema
+}
@@ -0,0 +1,171 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidateJSON checks a JSON document against schema and returns a
+// description of each way it does not match.
+func (d *Document) ValidateJSON(schema *Schema, data []byte) []string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return []string{"body is not valid JSON: " + err.Error()}
+	}
+
+	var errs []string
+	d.validate(schema, value, "body", &errs)
+	return errs
+}
+
+// ValidateParameter checks a path, query or header parameter's value against
+// its schema.
+func (d *Document) ValidateParameter(param *Parameter, value string) []string {
+	var parsed any = value
+	if param.Schema != nil && len(param.Schema.Type) == 1 {
+		switch param.Schema.Type[0] {
+		case "boolean":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return []string{fmt.Sprintf("%s parameter %s: %q is not a boolean", param.In, param.Name, value)}
+			}
+			parsed = b
+		case "integer", "number":
+			parsed = json.Number(value)
+		}
+	}
+
+	var errs []string
+	d.validate(param.Schema, parsed, param.In+" parameter "+param.Name, &errs)
+	return errs
+}
+
+func (d *Document) validate(schema *Schema, value any, at string, errs *[]string) {
+	if schema == nil {
+		return
+	}
+
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, schemaRefPrefix)
+		resolved, found := d.Components.Schemas[name]
+		if !found {
+			*errs = append(*errs, fmt.Sprintf("%s: unknown schema %s", at, schema.Ref))
+			return
+		}
+		d.validate(resolved, value, at, errs)
+		return
+	}
+
+	if len(schema.AnyOf) > 0 {
+		for _, option := range schema.AnyOf {
+			var optionErrs []string
+			d.validate(option, value, at, &optionErrs)
+			if len(optionErrs) == 0 {
+				return
+			}
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: matches none of the allowed schemas", at))
+		return
+	}
+
+	if len(schema.Type) > 0 {
+		actual := jsonType(value)
+		if !typeAllowed(schema.Type, actual, value) {
+			*errs = append(*errs, fmt.Sprintf("%s: expected %s, got %s", at, strings.Join(schema.Type, " or "), actual))
+			return
+		}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: %v is not one of the allowed values", at, value))
+	}
+
+	switch value := value.(type) {
+	case string:
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				*errs = append(*errs, fmt.Sprintf("%s: %q is not a date-time", at, value))
+			}
+		}
+	case []any:
+		for i, item := range value {
+			d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i), errs)
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, found := value[name]; !found {
+				*errs = append(*errs, fmt.Sprintf("%s: missing required property %s", at, name))
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if property, found := schema.Properties[name]; found {
+				d.validate(property, value[name], at+"."+name, errs)
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					*errs = append(*errs, fmt.Sprintf("%s: unexpected property %s", at, name))
+				}
+			case *Schema:
+				d.validate(additional, value[name], at+"."+name, errs)
+			}
+		}
+	}
+}
+
+// jsonType names the JSON type of a value decoded with UseNumber.
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeAllowed(allowed Types, actual string, value any) bool {
+	for _, t := range allowed {
+		switch {
+		case t == actual:
+			return true
+		case t == "integer" && actual == "number":
+			if _, err := value.(json.Number).Int64(); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+/*
+* @file paging.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the paging of the client list with the limit and after
+* query parameters.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPageSize is the largest limit a page may ask for.
+const maxPageSize = 100
+
+// clientPage is which clients to list: at most limit of them, zero meaning
+// all, with names after after.
+type clientPage struct {
+	limit int
+	after string
+}
+
+// clientPageFrom reads the page asked for by the limit and after query
+// parameters, responding with 400 if limit is not a valid size.
+func clientPageFrom(c *gin.Context) (clientPage, bool) {
+	page := clientPage{after: c.Query("after")}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+			return page, false
+		}
+		page.limit = limit
+	}
+
+	return page, true
+}
+
+// of sorts clients by name and returns those on the page, and whether more
+// follow it. The cursor is a name rather than a position, so clients added
+// or removed between pages don't shift the ones that come after.
+func (page clientPage) of(clients *[]database.Client) (*[]database.Client, bool) {
+	sorted := append([]database.Client(nil), *clients...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	start := sort.Search(len(sorted), func(i int) bool { return sorted[i].Name > page.after })
+	sorted = sorted[start:]
+
+	if page.limit == 0 || len(sorted) <= page.limit {
+		return &sorted, false
+	}
+	sorted = sorted[:page.limit]
+	return &sorted, true
+}
+
+// nextPageLink returns a Link header value pointing to the page after the
+// client named last, keeping the request's other query parameters.
+func nextPageLink(c *gin.Context, last string) string {
+	query := c.Request.URL.Query()
+	query.Set("after", last)
+	return fmt.Sprintf("<%s?%s>; rel=\"next\"", c.Request.URL.Path, query.Encode())
+}
@@ -0,0 +1,115 @@
+// Package pool bounds how many store calls run at once, both within a single
+// request and across the whole server.
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Limiter caps the number of tasks running at once across every Group it
+// creates.
+type Limiter struct {
+	slots      chan struct{}
+	perRequest int
+}
+
+// NewLimiter returns a Limiter allowing global tasks in flight in total and
+// perRequest tasks in flight within each Group. A value of zero or less means
+// no limit.
+func NewLimiter(global, perRequest int) *Limiter {
+	limiter := &Limiter{perRequest: perRequest}
+	if global > 0 {
+		limiter.slots = make(chan struct{}, global)
+	}
+	return limiter
+}
+
+// Group runs the fan-out of a single request and collects the errors its
+// tasks return. Tasks are skipped once ctx is cancelled.
+type Group struct {
+	ctx     context.Context
+	limiter *Limiter
+	slots   chan struct{}
+	wg      sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// Group returns a new Group bound to ctx.
+func (l *Limiter) Group(ctx context.Context) *Group {
+	group := &Group{ctx: ctx, limiter: l}
+	if l.perRequest > 0 {
+		group.slots = make(chan struct{}, l.perRequest)
+	}
+	return group
+}
+
+// Go runs task in a new goroutine once both a per-request and a global slot
+// are free. It blocks while the request is at its limit, so a request never
+// holds more than its share of goroutines.
+func (g *Group) Go(task func(ctx context.Context) error) {
+	if !acquire(g.ctx, g.slots) {
+		g.fail(g.ctx.Err())
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer release(g.slots)
+
+		if !acquire(g.ctx, g.limiter.slots) {
+			g.fail(g.ctx.Err())
+			return
+		}
+		defer release(g.limiter.slots)
+
+		if err := task(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until every task started by Go has returned. Unlike errgroup,
+// a failing task does not cancel the others: Wait returns every task's error
+// joined with errors.Join, including the context's error for tasks skipped
+// after ctx was cancelled.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return errors.Join(g.errs...)
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.errs = append(g.errs, err)
+}
+
+// acquire takes a slot from slots, giving up if ctx is cancelled first. A nil
+// channel means there is no limit.
+func acquire(ctx context.Context, slots chan struct{}) bool {
+	if slots == nil {
+		return ctx.Err() == nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func release(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
@@ -0,0 +1,257 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gauge counts the tasks running at once and remembers the most there were.
+type gauge struct {
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (g *gauge) enter() {
+	running := g.running.Add(1)
+	for {
+		peak := g.peak.Load()
+		if running <= peak || g.peak.CompareAndSwap(peak, running) {
+			return
+		}
+	}
+}
+
+func (g *gauge) leave() {
+	g.running.Add(-1)
+}
+
+// waitFor waits until cond holds, failing the test if it doesn't within a
+// second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, test := range []struct {
+		name              string
+		global, perGroup  int
+		groups, tasks     int
+		wantAll, wantEach int32
+	}{
+		{name: "no limits", groups: 2, tasks: 5, wantAll: 10, wantEach: 5},
+		{name: "per request", perGroup: 2, groups: 3, tasks: 5, wantAll: 6, wantEach: 2},
+		{name: "global", global: 3, groups: 2, tasks: 5, wantAll: 3, wantEach: 3},
+		{name: "global below the per request total", global: 3, perGroup: 2, groups: 3, tasks: 4, wantAll: 3, wantEach: 2},
+		{name: "global above the per request total", global: 10, perGroup: 2, groups: 2, tasks: 4, wantAll: 4, wantEach: 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewLimiter(test.global, test.perGroup)
+			release := make(chan struct{})
+			stop := sync.OnceFunc(func() { close(release) })
+			defer stop()
+
+			var all gauge
+			each := make([]gauge, test.groups)
+			var done atomic.Int32
+			var wg sync.WaitGroup
+			for i := range each {
+				wg.Add(1)
+				// Go blocks while a group is at its limit, so each group
+				// starts its tasks from its own goroutine.
+				go func(each *gauge) {
+					defer wg.Done()
+					group := limiter.Group(context.Background())
+					for j := 0; j < test.tasks; j++ {
+						group.Go(func(ctx context.Context) error {
+							all.enter()
+							each.enter()
+							<-release
+							each.leave()
+							all.leave()
+							done.Add(1)
+							return nil
+						})
+					}
+					if err := group.Wait(); err != nil {
+						t.Error(err)
+					}
+				}(&each[i])
+			}
+
+			waitFor(t, "the tasks to fill their slots", func() bool { return all.running.Load() == test.wantAll })
+			// Give any task that would break a limit the chance to start.
+			time.Sleep(20 * time.Millisecond)
+			stop()
+			wg.Wait()
+
+			if got := done.Load(); got != int32(test.groups*test.tasks) {
+				t.Errorf("%d tasks ran, want %d", got, test.groups*test.tasks)
+			}
+			if got := all.peak.Load(); got != test.wantAll {
+				t.Errorf("at most %d tasks ran at once, want %d", got, test.wantAll)
+			}
+			for i := range each {
+				if got := each[i].peak.Load(); got > test.wantEach {
+					t.Errorf("group %d ran %d tasks at once, want at most %d", i, got, test.wantEach)
+				}
+			}
+		})
+	}
+}
+
+func TestCancelWaitingForRequestSlot(t *testing.T) {
+	limiter := NewLimiter(0, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	group := limiter.Group(ctx)
+
+	release := make(chan struct{})
+	var ran atomic.Int32
+	group.Go(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	started := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		close(started)
+		group.Go(func(ctx context.Context) error {
+			ran.Add(1)
+			return nil
+		})
+		close(returned)
+	}()
+	<-started
+
+	select {
+	case <-returned:
+		t.Fatal("Go returned while the request was at its limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Go still blocked after the context was cancelled")
+	}
+
+	close(release)
+	if err := group.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if ran.Load() != 0 {
+		t.Error("the task waiting for a slot ran after the context was cancelled")
+	}
+}
+
+func TestCancelWaitingForGlobalSlot(t *testing.T) {
+	limiter := NewLimiter(1, 0)
+
+	release := make(chan struct{})
+	holding := make(chan struct{})
+	busy := limiter.Group(context.Background())
+	busy.Go(func(ctx context.Context) error {
+		close(holding)
+		<-release
+		return nil
+	})
+	<-holding
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group := limiter.Group(ctx)
+	var ran atomic.Int32
+	group.Go(func(ctx context.Context) error {
+		ran.Add(1)
+		return nil
+	})
+	cancel()
+
+	if err := group.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if ran.Load() != 0 {
+		t.Error("the task waiting for the global slot ran after the context was cancelled")
+	}
+
+	// The cancelled task gave back nothing it didn't take, so the slot is
+	// free again once the busy task is done.
+	close(release)
+	if err := busy.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	next := limiter.Group(context.Background())
+	next.Go(func(ctx context.Context) error {
+		ran.Add(1)
+		return nil
+	})
+	if err := next.Wait(); err != nil || ran.Load() != 1 {
+		t.Errorf("got %v after %d runs, want the freed slot reused", err, ran.Load())
+	}
+}
+
+func TestCancelledBeforeGo(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		global, perGroup int
+	}{
+		{name: "no limits"},
+		{name: "per request", perGroup: 1},
+		{name: "global", global: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			group := NewLimiter(test.global, test.perGroup).Group(ctx)
+			var ran atomic.Int32
+			for i := 0; i < 3; i++ {
+				group.Go(func(ctx context.Context) error {
+					ran.Add(1)
+					return nil
+				})
+			}
+			err := group.Wait()
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want context.Canceled", err)
+			}
+			if got := ran.Load(); got != 0 {
+				t.Errorf("%d tasks ran after the context was cancelled", got)
+			}
+		})
+	}
+}
+
+func TestWaitJoinsErrors(t *testing.T) {
+	first, second := errors.New("first"), errors.New("second")
+	group := NewLimiter(2, 1).Group(context.Background())
+
+	var ran atomic.Int32
+	for _, err := range []error{first, nil, second, nil} {
+		err := err
+		group.Go(func(ctx context.Context) error {
+			ran.Add(1)
+			return err
+		})
+	}
+
+	err := group.Wait()
+	if !errors.Is(err, first) || !errors.Is(err, second) {
+		t.Errorf("got %v, want both errors", err)
+	}
+	if ran.Load() != 4 {
+		t.Errorf("%d tasks ran, want a failure not to stop the others", ran.Load())
+	}
+}
@@ -0,0 +1,125 @@
+/*
+* @file ratelimit.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the middleware that rate limits callers by API key,
+* logged in user or IP address, and reports their remaining requests in the
+* RateLimit headers.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader is the header integrations send their API key in.
+const apiKeyHeader = "X-API-Key"
+
+// rateLimitMiddleware takes a token from the caller's bucket for each request
+// and refuses requests with 429 once it is empty. Preflights and health
+// checks are not limited.
+func rateLimitMiddleware(limiter *ratelimit.Limiter, sessions *auth.SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions || c.FullPath() == "/healthz" || isFrontendPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		caller, plan, ok := rateLimitCaller(c, limiter, sessions)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "unknown API key"})
+			return
+		}
+
+		result, limited := limiter.Allow(caller, plan, rateLimitRoute(c))
+		if !limited {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit.Requests))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(result.Reset))
+		c.Header("RateLimit-Policy", strconv.Itoa(result.Limit.Requests)+";w="+ceilSeconds(result.Limit.Per))
+
+		if !result.Allowed {
+			c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "too many requests"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitCaller names the bucket a request is counted against and the plan
+// it is on: the API key if one was sent, otherwise the logged in user,
+// otherwise the IP address. It returns false for an API key that is not
+// known.
+func rateLimitCaller(c *gin.Context, limiter *ratelimit.Limiter, sessions *auth.SessionStore) (string, string, bool) {
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		plan, found := limiter.KeyPlan(key)
+		if !found {
+			return "", "", false
+		}
+		return apiKeyName(key), plan, true
+	}
+
+	if id := sessionID(c); id != "" {
+		if session, found := sessions.Get(id); found {
+			return "user:" + session.User.Subject, ratelimit.PlanUser, true
+		}
+	}
+
+	return "ip:" + c.ClientIP(), ratelimit.PlanAnonymous, true
+}
+
+// apiKeyName names the caller with an API key by a hash of it, so neither the
+// rate limiter's backend nor the audit log ever holds the key itself.
+func apiKeyName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(hash[:8])
+}
+
+// sessionID returns the session a request names in an "Authorization: Bearer"
+// header or, failing that, the session cookie.
+func sessionID(c *gin.Context) string {
+	if bearer, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found {
+		return bearer
+	}
+	id, _ := c.Cookie(auth.SessionCookieName)
+	return id
+}
+
+// rateLimitRoute names a request's route as route limits are configured: its
+// method and path pattern without the version prefix, such as
+// "GET /clients/:id".
+func rateLimitRoute(c *gin.Context) string {
+	path := c.FullPath()
+	for _, version := range apiVersions {
+		if trimmed, found := strings.CutPrefix(path, "/"+version.Name+"/"); found {
+			path = "/" + trimmed
+			break
+		}
+	}
+	return c.Request.Method + " " + path
+}
+
+// ceilSeconds formats d as a whole number of seconds, rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
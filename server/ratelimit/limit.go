@@ -0,0 +1,270 @@
+// Package ratelimit limits how often each caller may call the API, with a
+// token bucket per caller and, where a route has its own limit, per caller
+// and route.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plans every policy has: callers that are not logged in and have no API key,
+// and logged in users.
+const (
+	PlanAnonymous = "anonymous"
+	PlanUser      = "user"
+)
+
+// Limit allows Requests requests Per period. Unused requests are saved up to
+// a burst of Requests. A zero Limit allows any number of requests.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit parses a limit of the form "60/1m".
+func ParseLimit(value string) (Limit, error) {
+	requests, per, found := strings.Cut(strings.TrimSpace(value), "/")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+
+	var limit Limit
+	var err error
+	if limit.Requests, err = strconv.Atoi(requests); err != nil || limit.Requests < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	if limit.Per, err = time.ParseDuration(per); err != nil || limit.Per <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	return limit, nil
+}
+
+// Unlimited reports whether the limit allows any number of requests.
+func (l Limit) Unlimited() bool {
+	return l.Requests == 0
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// Plan is the limit a group of callers has across the API, and the tighter
+// limits it has on particular routes. Routes are named by method and path,
+// such as "GET /clients".
+type Plan struct {
+	Limit  Limit
+	Routes map[string]Limit
+}
+
+// Policy is the plans callers are on. Callers with an API key are on the plan
+// Keys names for it.
+type Policy struct {
+	Plans map[string]Plan
+	Keys  map[string]string
+}
+
+// DefaultPolicy allows anonymous callers 60 requests a minute and logged in
+// users 300.
+func DefaultPolicy() Policy {
+	return Policy{
+		Plans: map[string]Plan{
+			PlanAnonymous: {Limit: Limit{Requests: 60, Per: time.Minute}},
+			PlanUser:      {Limit: Limit{Requests: 300, Per: time.Minute}},
+		},
+		Keys: map[string]string{},
+	}
+}
+
+// ParsePolicy starts from DefaultPolicy and adds or replaces the plans in
+// plans and the API keys in keys.
+//
+// plans separates plans with semicolons. Each is a name, its limit, and any
+// route limits: "partner=600/1m,GET /clients=60/1m". keys assigns keys to
+// plans: "key1=partner,key2=partner".
+func ParsePolicy(plans, keys string) (Policy, error) {
+	policy := DefaultPolicy()
+
+	if plans != "" {
+		parsed, err := ParsePlans(plans)
+		if err != nil {
+			return policy, err
+		}
+		for name, plan := range parsed {
+			policy.Plans[name] = plan
+		}
+	}
+	if keys != "" {
+		for _, entry := range strings.Split(keys, ",") {
+			key, plan, found := strings.Cut(strings.TrimSpace(entry), "=")
+			if !found || key == "" {
+				return policy, fmt.Errorf("invalid rate limit key entry")
+			}
+			policy.Keys[key] = strings.TrimSpace(plan)
+		}
+	}
+
+	return policy, policy.Validate()
+}
+
+// ParsePlans parses plans in the format ParsePolicy reads.
+func ParsePlans(value string) (map[string]Plan, error) {
+	plans := make(map[string]Plan)
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ",")
+		name, limit, found := strings.Cut(parts[0], "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid rate limit plan %q", entry)
+		}
+
+		var plan Plan
+		var err error
+		if plan.Limit, err = ParseLimit(limit); err != nil {
+			return nil, err
+		}
+
+		for _, part := range parts[1:] {
+			route, limit, found := strings.Cut(part, "=")
+			if !found {
+				return nil, fmt.Errorf("invalid route limit %q", part)
+			}
+			if plan.Routes == nil {
+				plan.Routes = make(map[string]Limit)
+			}
+			if plan.Routes[strings.TrimSpace(route)], err = ParseLimit(limit); err != nil {
+				return nil, err
+			}
+		}
+
+		plans[strings.TrimSpace(name)] = plan
+	}
+	return plans, nil
+}
+
+// Validate reports plans that are missing or that keys refer to without
+// existing.
+func (p Policy) Validate() error {
+	var errs []error
+	for _, name := range []string{PlanAnonymous, PlanUser} {
+		if _, found := p.Plans[name]; !found {
+			errs = append(errs, fmt.Errorf("rate limit plan %q is required", name))
+		}
+	}
+
+	var keys []string
+	for key := range p.Keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, found := p.Plans[p.Keys[key]]; !found {
+			errs = append(errs, fmt.Errorf("an API key is assigned to unknown rate limit plan %q", p.Keys[key]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Result is the state of a caller's bucket after a request.
+type Result struct {
+	Limit     Limit
+	Allowed   bool
+	Remaining int
+
+	// Reset is how long until the bucket is full again, and RetryAfter how
+	// long until the next request would be allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Bucket names one of a caller's buckets and the limit it refills at.
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// Backend keeps the buckets. Take takes a token from each of buckets,
+// creating any that do not exist full, but only if every one of them has a
+// token, and reports the state of each. A shared backend must check and take
+// the tokens atomically.
+type Backend interface {
+	Take(buckets []Bucket, now time.Time) []Result
+}
+
+// Limiter applies a policy to callers. The policy may be replaced while the
+// limiter is in use.
+type Limiter struct {
+	backend Backend
+	now     func() time.Time
+
+	mu     sync.RWMutex
+	policy Policy
+}
+
+// NewLimiter returns a Limiter applying policy with buckets kept in backend.
+func NewLimiter(policy Policy, backend Backend) *Limiter {
+	return &Limiter{backend: backend, now: time.Now, policy: policy}
+}
+
+// Policy returns the policy being applied.
+func (l *Limiter) Policy() Policy {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.policy
+}
+
+// SetPolicy replaces the policy. Buckets already in use keep their tokens.
+func (l *Limiter) SetPolicy(policy Policy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policy = policy
+}
+
+// KeyPlan returns the plan an API key is on, and false if the key is not
+// known.
+func (l *Limiter) KeyPlan(key string) (string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	plan, found := l.policy.Keys[key]
+	return plan, found
+}
+
+// Allow takes a token for a request by caller, on plan, to route. If the
+// route has its own limit on the plan, a token is taken from both the
+// caller's route bucket and their bucket for the whole API, or from neither
+// if either is empty. The result is the tighter of the two: the one with
+// fewer requests remaining or, if the request is refused, the longer wait.
+// The boolean is false if neither limit applies.
+func (l *Limiter) Allow(caller, plan, route string) (Result, bool) {
+	l.mu.RLock()
+	limits := l.policy.Plans[plan]
+	l.mu.RUnlock()
+
+	var buckets []Bucket
+	if limit, found := limits.Routes[route]; found && !limit.Unlimited() {
+		buckets = append(buckets, Bucket{Key: plan + "|" + caller + "|" + route, Limit: limit})
+	}
+	if !limits.Limit.Unlimited() {
+		buckets = append(buckets, Bucket{Key: plan + "|" + caller, Limit: limits.Limit})
+	}
+	if len(buckets) == 0 {
+		return Result{}, false
+	}
+
+	results := l.backend.Take(buckets, l.now())
+	result := results[0]
+	for _, other := range results[1:] {
+		if (result.Allowed && other.Remaining < result.Remaining) || (!result.Allowed && other.RetryAfter > result.RetryAfter) {
+			result = other
+		}
+	}
+	return result, true
+}
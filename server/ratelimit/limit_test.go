@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a Limiter applying plans over a Memory backend, and
+// a clock that only moves when the returned function is called.
+func newTestLimiter(t *testing.T, plans string) (*Limiter, *Memory, func(time.Duration)) {
+	t.Helper()
+	policy, err := ParsePolicy(plans, "key=partner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	memory := NewMemory()
+	limiter := NewLimiter(policy, memory)
+	limiter.now = func() time.Time { return now }
+	return limiter, memory, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestAllowPlanLimit(t *testing.T) {
+	limiter, _, advance := newTestLimiter(t, "partner=3/1m")
+
+	for i := 2; i >= 0; i-- {
+		result, limited := limiter.Allow("key:a", "partner", "GET /clients")
+		if !limited || !result.Allowed || result.Remaining != i {
+			t.Fatalf("got %+v, want allowed with %d remaining", result, i)
+		}
+	}
+
+	result, _ := limiter.Allow("key:a", "partner", "GET /clients")
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 20*time.Second || result.Reset != time.Minute {
+		t.Errorf("got %+v, want refused, retry in 20s and full in 1m", result)
+	}
+
+	// Another caller on the same plan has a bucket of their own.
+	if result, _ := limiter.Allow("key:b", "partner", "GET /clients"); !result.Allowed {
+		t.Errorf("got %+v for another caller, want allowed", result)
+	}
+
+	advance(20 * time.Second)
+	if result, _ := limiter.Allow("key:a", "partner", "GET /clients"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("got %+v after 20s, want one request allowed", result)
+	}
+}
+
+func TestAllowRouteLimit(t *testing.T) {
+	limiter, _, _ := newTestLimiter(t, "partner=10/1m,GET /clients=2/1m")
+
+	for i := 0; i < 2; i++ {
+		if result, _ := limiter.Allow("key:a", "partner", "GET /clients"); !result.Allowed {
+			t.Fatalf("request %d: got %+v, want allowed", i+1, result)
+		}
+	}
+
+	// The route's bucket is the tighter one, so it is the one reported.
+	result, _ := limiter.Allow("key:a", "partner", "GET /clients")
+	if result.Allowed || result.Limit.Requests != 2 || result.RetryAfter != 30*time.Second {
+		t.Errorf("got %+v, want refused by the 2/1m route limit, retry in 30s", result)
+	}
+
+	// Other routes only count against the plan, which has 8 requests left.
+	result, _ = limiter.Allow("key:a", "partner", "GET /vehicles/:id")
+	if !result.Allowed || result.Limit.Requests != 10 || result.Remaining != 7 {
+		t.Errorf("got %+v, want allowed with 7 of 10 remaining", result)
+	}
+}
+
+func TestAllowOverallLimitKeepsRouteTokens(t *testing.T) {
+	limiter, memory, _ := newTestLimiter(t, "partner=2/1m,GET /clients=5/1m")
+
+	for i := 0; i < 2; i++ {
+		if result, _ := limiter.Allow("key:a", "partner", "GET /clients"); !result.Allowed {
+			t.Fatalf("request %d: got %+v, want allowed", i+1, result)
+		}
+	}
+
+	result, _ := limiter.Allow("key:a", "partner", "GET /clients")
+	if result.Allowed || result.Limit.Requests != 2 || result.RetryAfter != 30*time.Second {
+		t.Errorf("got %+v, want refused by the 2/1m plan limit, retry in 30s", result)
+	}
+
+	// The refused request took nothing from the route's bucket.
+	if tokens := memory.buckets["partner|key:a|GET /clients"].tokens; tokens != 3 {
+		t.Errorf("the route's bucket holds %v tokens, want 3", tokens)
+	}
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	limiter, _, _ := newTestLimiter(t, "partner=0/1m")
+
+	if _, limited := limiter.Allow("key:a", "partner", "GET /clients"); limited {
+		t.Error("a plan without limits limited a request")
+	}
+	if plan, found := limiter.KeyPlan("key"); !found || plan != "partner" {
+		t.Errorf("got plan %q, %v for the key, want partner", plan, found)
+	}
+}
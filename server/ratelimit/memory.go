@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often Memory drops buckets that have filled up again.
+const sweepInterval = time.Minute
+
+// Memory is an in-process Backend.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// NewMemory returns an empty Memory backend.
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+// Take takes a token from each of buckets if every one of them has one.
+func (m *Memory) Take(buckets []Bucket, now time.Time) []Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	// Refill every bucket before taking anything, so a request refused by
+	// one bucket spends nothing from the others.
+	states := make([]*bucket, len(buckets))
+	allowed := true
+	for i, request := range buckets {
+		states[i] = m.refill(request.Key, request.Limit, now)
+		if states[i].tokens < 1 {
+			allowed = false
+		}
+	}
+
+	results := make([]Result, len(buckets))
+	for i, request := range buckets {
+		b := states[i]
+		capacity := float64(request.Limit.Requests)
+		rate := capacity / request.Limit.Per.Seconds()
+
+		result := Result{Limit: request.Limit, Allowed: allowed}
+		if allowed {
+			b.tokens--
+		} else if b.tokens < 1 {
+			result.RetryAfter = seconds((1 - b.tokens) / rate)
+		}
+
+		result.Remaining = int(b.tokens)
+		result.Reset = seconds((capacity - b.tokens) / rate)
+		b.full = now.Add(result.Reset)
+		results[i] = result
+	}
+	return results
+}
+
+// refill returns the bucket named key, creating it full or topping it up for
+// the time since its last request, up to the burst. The caller must hold
+// m.mu.
+func (m *Memory) refill(key string, limit Limit, now time.Time) *bucket {
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Per.Seconds()
+
+	b, found := m.buckets[key]
+	if !found {
+		b = &bucket{tokens: capacity, updated: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	return b
+}
+
+// sweep drops buckets that are full by now, since a new bucket starts full.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if !b.full.After(now) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
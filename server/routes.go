@@ -0,0 +1,213 @@
+/*
+* @file routes.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the HTTP routes and the middleware around them, built
+* from the settings and the parts of the server main opens.
+ */
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/byron-ojua/starter-project/audit"
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/cache"
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/byron-ojua/starter-project/graph"
+	"github.com/byron-ojua/starter-project/idempotency"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"github.com/byron-ojua/starter-project/web"
+	"github.com/byron-ojua/starter-project/webhooks"
+	"github.com/gin-gonic/gin"
+
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// services are the parts of the server the routes are built on. main opens
+// them from the settings, and shares the sessions and audit log with gRPC.
+type services struct {
+	api      *handlers
+	cache    *cache.Store
+	auditLog *audit.Log
+	webhooks *webhooks.Manager
+	sessions *auth.SessionStore
+	cookies  auth.CookieConfig
+	limiter  *ratelimit.Limiter
+}
+
+// newRouter builds the HTTP routes and their middleware, and the OpenAPI
+// document that describes them. The handler it returns also serves the mock
+// OpenID provider when one is configured.
+func newRouter(settings *config.Config, s services) (http.Handler, *openAPISpec, error) {
+	schema, err := graph.New(s.api.store, graphQLLimits(settings.GraphQL))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	idempotencyKeys := idempotency.NewStore(idempotency.NewMemory(), time.Duration(settings.Idempotency.Window))
+
+	origins, err := corsPolicy(settings.CORS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	frontend := web.New()
+	if !frontend.Built() {
+		slog.Warn("the frontend has not been built; run npm run build in client to serve it from " + web.Prefix)
+	}
+
+	spec := &openAPISpec{}
+
+	router := gin.New()
+	router.Use(requestLogger(), gin.Recovery())
+
+	// The caller's address is only taken from X-Forwarded-For when the
+	// request comes through a trusted proxy, so it can't be spoofed to dodge
+	// login lockouts and per-IP rate limits.
+	if err := router.SetTrustedProxies(settings.Server.TrustedProxies); err != nil {
+		return nil, nil, err
+	}
+	if settings.OpenAPI.Validate {
+		router.Use(spec.validate())
+	}
+	router.Use(corsMiddleware(origins))
+	router.Use(auditMiddleware(s.auditLog, s.limiter, s.sessions))
+	router.Use(csrfMiddleware(s.cookies))
+	router.Use(rateLimitMiddleware(s.limiter, s.sessions))
+
+	sso, mockIssuer, err := newSSOLogin(settings.OIDC, settings.Server.ExternalURL, s.sessions, s.cookies)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	login := &loginHandlers{
+		password:   settings.Auth.Password,
+		guard:      auth.NewLoginGuard(),
+		sessions:   s.sessions,
+		cookies:    s.cookies,
+		ssoEnabled: sso != nil,
+	}
+
+	// Serve the login form
+	router.GET("/login", login.show)
+
+	// Handle form submission and set a session/cookie
+	router.POST("/login", login.submit)
+
+	// Single sign-on through the configured OpenID provider
+	if sso != nil {
+		router.GET("/login/sso", sso.start)
+		router.GET("/login/sso/callback", sso.callback)
+	}
+
+	// Admin operations for managing login lockouts, reading the audit log and
+	// checking the cache
+	admin := router.Group("/admin", passwordProtected(s.sessions), requireRole(auth.RoleAdmin))
+	admin.GET("/lockouts", login.listLockouts)
+	admin.DELETE("/lockouts", login.unlock)
+	admin.GET("/audit", listAudit(s.auditLog))
+	admin.GET("/audit/verify", verifyAudit(s.auditLog))
+	admin.GET("/cache", cacheStats(s.cache))
+
+	// Outbound webhooks: clients' subscriptions, and the delivery queue for
+	// inspecting and replaying failures
+	webhookRoutes := &webhookHandlers{store: s.api.store, webhooks: s.webhooks}
+	admin.GET("/webhooks/deliveries", webhookRoutes.listDeliveries)
+	admin.GET("/webhooks/dead-letters", webhookRoutes.listDeadLetters)
+	admin.POST("/webhooks/dead-letters/replay", webhookRoutes.replayDeadLetters)
+	admin.POST("/webhooks/deliveries/:delivery/replay", webhookRoutes.replay)
+
+	clientHooks := router.Group("/clients/:id/webhooks", passwordProtected(s.sessions), requireRole(auth.RoleAdmin))
+	clientHooks.GET("", webhookRoutes.listWebhooks)
+	clientHooks.POST("", idempotent(idempotencyKeys), webhookRoutes.createWebhook)
+	clientHooks.DELETE("/:hook", webhookRoutes.deleteWebhook)
+
+	// Answer OPTIONS requests for every path, so preflights always reach
+	// corsMiddleware instead of depending on the not-found handler.
+	router.OPTIONS("/*path", func(c *gin.Context) {
+		c.Header("Allow", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Status(http.StatusNoContent)
+	})
+
+	// Apply password protection to the Swagger documentation
+	router.GET("/swagger/*any", passwordProtected(s.sessions), ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	router.GET("/healthz", s.api.health)
+	router.GET("/openapi.json", spec.serve)
+
+	// GraphQL over the same data, for fetching nested records in one request
+	router.GET("/graphql", graphQLQuery(schema))
+	router.POST("/graphql", graphQL(schema))
+
+	// Your existing routes, served under each version's prefix and, for
+	// integrations that predate versioning, unversioned with the version
+	// taken from the Accept header
+	// Writes, weight ingestion and live streams need a session or an API
+	// key, as every gRPC call does.
+	callers := apiProtected(s.sessions, s.limiter)
+	resources := func(group *gin.RouterGroup) {
+		group.GET("/clients", s.api.getAllClients)
+		group.GET("/clients/:id", s.api.getClientByID)
+		group.GET("/clients/:id/vehicles", s.api.getClientVehicles)
+		group.GET("/vehicles/:id", s.api.getVehicalByID)
+
+		// Weight ingestion and live streams
+		group.POST("/vehicles/:id/weights", callers, idempotent(idempotencyKeys), s.api.addWeight)
+		group.GET("/vehicles/:id/weights/stream", callers, s.api.streamVehicleWeights)
+		group.GET("/clients/:id/weights/stream", callers, s.api.streamClientWeights)
+
+		// Writes
+		group.PUT("/clients/:id", callers, s.api.saveClient)
+		group.PUT("/vehicles/:id", callers, s.api.saveVehicle)
+	}
+	for _, version := range apiVersions {
+		resources(router.Group("/"+version.Name, useVersion(version)))
+	}
+	resources(router.Group("", negotiateVersion()))
+
+	// Several calls in one round-trip, each passed back through the router
+	router.POST("/batch", runBatch(router, settings.Batch.MaxSize))
+
+	// Fleet-wide change events for logged in dashboards
+	router.GET("/ws", passwordProtected(s.sessions), fleetSocket(s.api.bus, origins))
+
+	// The React frontend, with every other unknown path left a plain 404
+	router.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, web.Prefix+"/")
+	})
+	router.GET(web.ConfigPath, frontendConfig(web.Config{APIBaseURL: settings.Frontend.APIURL}))
+	router.NoRoute(serveFrontend(frontend))
+
+	templates, err := loadTemplates()
+	if err != nil {
+		return nil, nil, err
+	}
+	router.SetHTMLTemplate(templates)
+
+	// The OpenAPI document is built from the annotations and the routes
+	// above, and refuses to build if they disagree.
+	if spec.doc, err = buildOpenAPI(router.Routes()); err != nil {
+		return nil, nil, err
+	}
+
+	var handler http.Handler = router
+
+	// The mock provider stands in for an external service, so it is served
+	// beside the router rather than behind its middleware.
+	if mockIssuer != nil {
+		mux := http.NewServeMux()
+		mux.Handle(mockIssuerPath+"/", http.StripPrefix(mockIssuerPath, mockIssuer))
+		mux.Handle("/", router)
+		handler = mux
+	}
+
+	return handler, spec, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byron-ojua/starter-project/audit"
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/cache"
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+	"github.com/byron-ojua/starter-project/pool"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"github.com/byron-ojua/starter-project/webhooks"
+	"github.com/gin-gonic/gin"
+)
+
+// testAPIKey is the API key the test server accepts.
+const testAPIKey = "test-key"
+
+// testServer is the router main builds, over a test store.
+type testServer struct {
+	handler  http.Handler
+	spec     *openAPISpec
+	sessions *auth.SessionStore
+	session  string // an admin's session ID
+	auditLog *audit.Log
+}
+
+// newTestServer builds the full router over store from the default settings,
+// changed by configure if it is not nil.
+func newTestServer(t *testing.T, store database.Store, configure func(*config.Config)) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	settings, _, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.RateLimit.Keys = testAPIKey + "=user"
+	if configure != nil {
+		configure(settings)
+	}
+
+	cookies, err := cookieConfig(settings.Auth.Cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := rateLimitPolicy(settings.RateLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := webhooks.Open(webhookOptions(settings.Webhooks))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachedStore := cache.NewStore(database.NewCoalesced(store), cache.NewLRU(settings.Cache.Size), time.Duration(settings.Cache.TTL))
+	bus := events.NewBus(1000)
+	t.Cleanup(bus.Close)
+	auditLog := audit.NewLog()
+
+	s := services{
+		api: &handlers{
+			store: audit.NewStore(events.NewStore(cachedStore, bus), auditLog),
+			pool:  pool.NewLimiter(settings.Fanout.Global, settings.Fanout.PerRequest),
+			bus:   bus,
+		},
+		cache:    cachedStore,
+		auditLog: auditLog,
+		webhooks: hooks,
+		sessions: auth.NewSessionStore(time.Hour),
+		cookies:  cookies,
+		limiter:  ratelimit.NewLimiter(limits, ratelimit.NewMemory()),
+	}
+	handler, spec, err := newRouter(settings, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := s.sessions.Create(auth.SessionPassword, auth.User{Subject: "admin", Roles: []string{auth.RoleAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{handler: handler, spec: spec, sessions: s.sessions, session: session.ID, auditLog: auditLog}
+}
+
+// do sends a request as the logged in admin, with a CSRF token. A request
+// with a context that ends, for a stream, returns when it does.
+func (s *testServer) do(ctx context.Context, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body)).WithContext(ctx)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: s.session})
+	req.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: "token"})
+	req.Header.Set(auth.CSRFHeaderName, "token")
+
+	res := httptest.NewRecorder()
+	s.handler.ServeHTTP(res, req)
+	return res
+}
+
+// openAPIMismatches are the messages spec.validate responds with when a
+// request, route or response disagrees with the document.
+var openAPIMismatches = []string{
+	"route is not in the OpenAPI spec",
+	"request does not match the OpenAPI spec",
+	"response does not match the OpenAPI spec",
+}
+
+func TestEveryRouteMatchesOpenAPI(t *testing.T) {
+	server := newTestServer(t, newFakeStore(), func(settings *config.Config) {
+		settings.OpenAPI.Validate = true
+	})
+
+	calls := []struct {
+		method, target, body string
+	}{
+		{"GET", "/healthz", ""},
+		{"GET", "/openapi.json", ""},
+		{"GET", "/app/config.json", ""},
+		{"GET", "/graphql?query=%7B__typename%7D", ""},
+		{"POST", "/graphql", `{"query": "{ __typename }"}`},
+		{"POST", "/batch", `{"requests": [{"method": "GET", "path": "/healthz"}]}`},
+		{"GET", "/admin/audit?limit=5", ""},
+		{"GET", "/admin/audit/verify", ""},
+		{"GET", "/admin/cache", ""},
+		{"GET", "/admin/lockouts", ""},
+		{"DELETE", "/admin/lockouts?account=admin", ""},
+		{"GET", "/admin/webhooks/deliveries", ""},
+		{"GET", "/admin/webhooks/dead-letters", ""},
+		{"POST", "/admin/webhooks/dead-letters/replay", ""},
+		{"POST", "/admin/webhooks/deliveries/missing/replay", ""},
+		{"GET", "/clients/CIA/webhooks", ""},
+		{"POST", "/clients/CIA/webhooks", `{"url": "https://hooks.example.com/fleet", "events": ["vehicle.added"]}`},
+		{"DELETE", "/clients/CIA/webhooks/missing", ""},
+	}
+	for _, prefix := range []string{"", "/v1", "/v2"} {
+		calls = append(calls, []struct{ method, target, body string }{
+			{"GET", prefix + "/clients", ""},
+			{"GET", prefix + "/clients/CIA", ""},
+			{"GET", prefix + "/clients/CIA/vehicles", ""},
+			{"GET", prefix + "/vehicles/1A", ""},
+			{"PUT", prefix + "/clients/CIA", `{"contact_name": "Stan Smith", "contact_email": "stan@cia.gov"}`},
+			{"PUT", prefix + "/vehicles/1A", `{"client": "CIA", "mileage": 1000}`},
+			{"POST", prefix + "/vehicles/1A/weights", `{"weight": 1250.5}`},
+			{"GET", prefix + "/vehicles/1A/weights/stream", ""},
+			{"GET", prefix + "/clients/CIA/weights/stream", ""},
+		}...)
+	}
+
+	called := make(map[string]bool)
+	for _, call := range calls {
+		// Streams run until the request ends, so theirs ends shortly. The
+		// store answers at once, so nothing else is cut off.
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		res := server.do(ctx, call.method, call.target, call.body)
+		cancel()
+
+		var body struct {
+			Message string   `json:"message"`
+			Errors  []string `json:"errors"`
+		}
+		json.Unmarshal(res.Body.Bytes(), &body)
+		if contains(openAPIMismatches, body.Message) {
+			t.Errorf("%s %s: %s: %s", call.method, call.target, body.Message, strings.Join(body.Errors, "; "))
+		}
+		if res.Code >= http.StatusInternalServerError {
+			t.Errorf("%s %s: got %d: %s", call.method, call.target, res.Code, res.Body)
+		}
+
+		if route, found := server.spec.route(call.method, call.target); found {
+			called[route] = true
+		} else {
+			t.Errorf("%s %s is not in the OpenAPI document", call.method, call.target)
+		}
+	}
+
+	var missed []string
+	for path, item := range server.spec.doc.Paths {
+		for method := range item {
+			if route := strings.ToUpper(method) + " " + path; !called[route] {
+				missed = append(missed, route)
+			}
+		}
+	}
+	sort.Strings(missed)
+	if len(missed) > 0 {
+		t.Errorf("the test calls no route for:\n%s", strings.Join(missed, "\n"))
+	}
+}
+
+func TestAuditRecordsPublicCallers(t *testing.T) {
+	server := newTestServer(t, newFakeStore(), nil)
+
+	send := func(header, value string) {
+		req := httptest.NewRequest(http.MethodGet, "/clients/CIA", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		server.handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send("", "")
+	send(apiKeyHeader, testAPIKey)
+	send("Authorization", "Bearer "+server.session)
+	send(apiKeyHeader, "unknown-key")
+
+	entries, err := server.auditLog.Query(audit.Filter{Action: "GET /clients/:id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"anonymous", apiKeyName(testAPIKey), "admin", "anonymous"}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d audit entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.Actor != want[i] {
+			t.Errorf("entry %d: got actor %q, want %q", i, entry.Actor, want[i])
+		}
+	}
+}
+
+func TestOpenAPIFileIsCurrent(t *testing.T) {
+	server := newTestServer(t, newFakeStore(), nil)
+
+	built, err := json.MarshalIndent(server.spec.doc, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile("docs/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(built, '\n'), saved) {
+		t.Error("docs/openapi.json is out of date; run go generate")
+	}
+}
+
+// route returns the document's path template that matches a request, as
+// "METHOD /path/{param}".
+func (s *openAPISpec) route(method, target string) (string, bool) {
+	path, _, _ := strings.Cut(target, "?")
+	for template, item := range s.doc.Paths {
+		if _, found := item[strings.ToLower(method)]; !found {
+			continue
+		}
+		pattern := "^" + regexp.MustCompile(`\\\{[^}]+\\\}`).ReplaceAllString(regexp.QuoteMeta(template), `[^/]+`) + "$"
+		if regexp.MustCompile(pattern).MatchString(path) && !ambiguous(s, method, template, path) {
+			return strings.ToUpper(method) + " " + template, true
+		}
+	}
+	return "", false
+}
+
+// ambiguous reports whether a literal template other than template also
+// matches path, such as /admin/webhooks/dead-letters/replay beside
+// /admin/webhooks/deliveries/{delivery}/replay.
+func ambiguous(s *openAPISpec, method, template, path string) bool {
+	if !strings.Contains(template, "{") {
+		return false
+	}
+	_, found := s.doc.Paths[path][strings.ToLower(method)]
+	return found
+}
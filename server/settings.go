@@ -0,0 +1,151 @@
+/*
+* @file settings.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the helpers that turn the loaded settings into the
+* server's parts, and that apply the settings that can change while the
+* server runs when it receives SIGHUP.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/byron-ojua/starter-project/cors"
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// reloadable are the settings applied again on SIGHUP. The others only take
+// effect when the server is restarted.
+var reloadable = []string{"log.level", "rate_limit.plans", "rate_limit.keys"}
+
+// setupLogging sends the server's logs to stderr, leaving out those less
+// severe than level.
+func setupLogging(level *slog.LevelVar) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	// SetDefault routes the log package through slog at info, which would
+	// hide log.Fatal's message at higher levels. Startup failures must
+	// always be seen, so it keeps writing to stderr.
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
+}
+
+// requestLogger logs each request, at info.
+func requestLogger() gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Skip: func(c *gin.Context) bool {
+			return !slog.Default().Enabled(c.Request.Context(), slog.LevelInfo)
+		},
+	})
+}
+
+// openStore opens the store settings names.
+func openStore(settings config.Store) (database.Store, error) {
+	switch settings.Driver {
+	case "memory":
+		store, err := database.Open()
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("store driver %q is not supported", settings.Driver)
+}
+
+// cookieConfig returns the attributes of the cookies the server sets.
+func cookieConfig(settings config.Cookie) (auth.CookieConfig, error) {
+	sameSite, err := auth.ParseSameSite(settings.SameSite)
+	if err != nil {
+		return auth.CookieConfig{}, err
+	}
+	return auth.CookieConfig{
+		Domain:   settings.Domain,
+		Secure:   settings.Secure != nil && *settings.Secure,
+		SameSite: sameSite,
+		MaxAge:   settings.MaxAge,
+	}, nil
+}
+
+// corsPolicy returns the CORS policy settings describe.
+func corsPolicy(settings config.CORS) (cors.Policy, error) {
+	policy := cors.Policy{
+		AllowedOrigins:   settings.AllowedOrigins,
+		AllowedMethods:   settings.AllowedMethods,
+		AllowedHeaders:   settings.AllowedHeaders,
+		ExposedHeaders:   settings.ExposedHeaders,
+		AllowCredentials: settings.AllowCredentials,
+		MaxAge:           time.Duration(settings.MaxAge) * time.Second,
+	}
+	return policy, policy.Validate()
+}
+
+// scheduleVersions sets when the old API versions are deprecated and
+// removed, as settings describe.
+func scheduleVersions(settings config.API) {
+	apiV1.Deprecated = time.Time(settings.V1Deprecated)
+	apiV1.Sunset = time.Time(settings.V1Sunset)
+}
+
+// rateLimitPolicy returns the rate limit policy settings describe.
+func rateLimitPolicy(settings config.RateLimit) (ratelimit.Policy, error) {
+	return ratelimit.ParsePolicy(settings.Plans, settings.Keys)
+}
+
+// reloadOnHangup loads the settings again from args each time the process
+// receives SIGHUP, until ctx is done, and applies the log level and rate
+// limits. Settings that fail to load or validate are logged and the current
+// ones kept; changes to settings that need a restart are logged as well.
+func reloadOnHangup(ctx context.Context, args []string, current *config.Config, level *slog.LevelVar, limiter *ratelimit.Limiter) {
+	// Registered before returning, so SIGHUP never falls back to its default
+	// of ending the process.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hangups)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangups:
+			}
+
+			next, _, err := config.Load(args)
+			if err == nil {
+				var policy ratelimit.Policy
+				if policy, err = rateLimitPolicy(next.RateLimit); err == nil {
+					level.Set(next.Log.Level)
+					limiter.SetPolicy(policy)
+				}
+			}
+			if err != nil {
+				slog.Error("reloading the settings failed; keeping the current ones", "err", err)
+				continue
+			}
+
+			for _, setting := range next.Changed(current) {
+				if !contains(reloadable, setting) {
+					slog.Warn("a setting changed that only takes effect on restart", "setting", setting)
+				}
+			}
+			current = next
+			slog.Info("reloaded the settings", "log_level", next.Log.Level)
+		}
+	}()
+}
@@ -0,0 +1,266 @@
+/*
+* @file socket.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the WebSocket endpoint that pushes fleet change events
+* to subscribed dashboards.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byron-ojua/starter-project/cors"
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	socketWriteWait  = 10 * time.Second
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = 50 * time.Second
+	socketMaxMessage = 4096
+
+	// socketBuffer is how many events a connection may fall behind before it
+	// is closed as a slow consumer.
+	socketBuffer = 256
+)
+
+// The topics a connection can subscribe to.
+const (
+	clientTopicPrefix  = "client:"
+	vehicleTopicPrefix = "vin:"
+	violationsTopic    = "violations"
+)
+
+// socketRequest is a message sent by the client, such as
+// {"action": "subscribe", "topic": "vin:123456789G"}.
+type socketRequest struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+}
+
+// socketMessage is a message sent to the client. Change events carry the
+// event type, such as "weight.added", and the topic that matched.
+type socketMessage struct {
+	Type    string     `json:"type"`
+	ID      uint64     `json:"id,omitempty"`
+	Topic   string     `json:"topic,omitempty"`
+	Client  string     `json:"client,omitempty"`
+	Vin     string     `json:"vin,omitempty"`
+	Time    *time.Time `json:"time,omitempty"`
+	Message string     `json:"message,omitempty"`
+	Data    any        `json:"data,omitempty"`
+}
+
+// topicSet is the set of topics a connection is subscribed to.
+type topicSet struct {
+	mu     sync.RWMutex
+	topics map[string]bool
+}
+
+// match returns the first subscribed topic that event belongs to.
+func (t *topicSet) match(event events.Event) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	switch {
+	case event.Client != "" && t.topics[clientTopicPrefix+event.Client]:
+		return clientTopicPrefix + event.Client, true
+	case event.Vin != "" && t.topics[vehicleTopicPrefix+event.Vin]:
+		return vehicleTopicPrefix + event.Vin, true
+	case strings.HasPrefix(event.Type, "violation.") && t.topics[violationsTopic]:
+		return violationsTopic, true
+	}
+	return "", false
+}
+
+func (t *topicSet) set(topic string, subscribed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if subscribed {
+		t.topics[topic] = true
+	} else {
+		delete(t.topics, topic)
+	}
+}
+
+// fleetSocket upgrades the request to a WebSocket on which the caller can
+// subscribe to a client ("client:<name>"), a vehicle ("vin:<vin>") or every
+// violation ("violations"), and receives a typed JSON message for each change.
+// A connection that falls too far behind is closed with status 1013 so it can
+// reconnect.
+func fleetSocket(bus *events.Bus, policy cors.Policy) gin.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			if parsed, err := url.Parse(origin); err == nil && parsed.Host == r.Host {
+				return true
+			}
+			return policy.AllowsOrigin(origin)
+		},
+	}
+
+	return func(c *gin.Context) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// Upgrade has already written an error response.
+			slog.Warn("opening a websocket failed", "err", err)
+			return
+		}
+		defer conn.Close()
+
+		topics := &topicSet{topics: make(map[string]bool)}
+		subscription := bus.Subscribe(func(event events.Event) bool {
+			_, found := topics.match(event)
+			return found
+		}, socketBuffer)
+		defer subscription.Close()
+
+		replies := make(chan socketMessage, 16)
+		done := make(chan struct{})
+		go readSocket(conn, topics, replies, done)
+
+		writeSocket(conn, topics, subscription, replies, done)
+	}
+}
+
+// readSocket handles subscribe and unsubscribe requests until the connection
+// closes, then closes done.
+func readSocket(conn *websocket.Conn, topics *topicSet, replies chan<- socketMessage, done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(socketMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var request socketRequest
+		var reply socketMessage
+		switch {
+		case json.Unmarshal(data, &request) != nil:
+			reply = socketMessage{Type: "error", Message: "invalid JSON"}
+		case !validTopic(request.Topic):
+			reply = socketMessage{Type: "error", Topic: request.Topic, Message: "unknown topic"}
+		case request.Action == "subscribe":
+			topics.set(request.Topic, true)
+			reply = socketMessage{Type: "subscribed", Topic: request.Topic}
+		case request.Action == "unsubscribe":
+			topics.set(request.Topic, false)
+			reply = socketMessage{Type: "unsubscribed", Topic: request.Topic}
+		default:
+			reply = socketMessage{Type: "error", Message: "action must be subscribe or unsubscribe"}
+		}
+
+		select {
+		case replies <- reply:
+		default:
+			// The client is sending faster than it reads its replies.
+			return
+		}
+	}
+}
+
+// writeSocket sends replies, change events and pings until the connection or
+// the subscription closes.
+func writeSocket(conn *websocket.Conn, topics *topicSet, subscription *events.Subscription, replies <-chan socketMessage, done <-chan struct{}) {
+	ping := time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case reply := <-replies:
+			err = writeSocketJSON(conn, reply)
+		case event, ok := <-subscription.C:
+			if !ok {
+				closeSocket(conn, subscription.Dropped())
+				return
+			}
+			topic, _ := topics.match(event)
+			err = writeSocketJSON(conn, socketMessage{
+				Type:   event.Type,
+				ID:     event.ID,
+				Topic:  topic,
+				Client: event.Client,
+				Vin:    event.Vin,
+				Time:   &event.Time,
+				Data:   eventPayload(event),
+			})
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		case <-done:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeSocketJSON(conn *websocket.Conn, message socketMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return conn.WriteJSON(message)
+}
+
+// closeSocket tells the client why the server is closing the connection.
+func closeSocket(conn *websocket.Conn, slow bool) {
+	code, reason := websocket.CloseGoingAway, "server shutting down"
+	if slow {
+		code, reason = websocket.CloseTryAgainLater, "slow consumer"
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(socketWriteWait))
+}
+
+func validTopic(topic string) bool {
+	switch {
+	case topic == violationsTopic:
+		return true
+	case strings.HasPrefix(topic, clientTopicPrefix):
+		return len(topic) > len(clientTopicPrefix)
+	case strings.HasPrefix(topic, vehicleTopicPrefix):
+		return len(topic) > len(vehicleTopicPrefix)
+	}
+	return false
+}
+
+// eventPayload converts the stored record carried by an event to its API
+// representation.
+func eventPayload(event events.Event) any {
+	switch data := event.Data.(type) {
+	case database.Weight:
+		return WeightReading{Vin: data.Vin, Client: event.Client, Weight: data.Weight, Time: event.Time}
+	case database.Client:
+		return ClientRecord{Name: data.Name, ContactName: data.ContactName, ContactEmail: data.ContactEmail}
+	case database.Vehicle:
+		return VehicleRecord{Vin: data.Vin, Client: data.Client, Mileage: data.Mileage}
+	}
+	return event.Data
+}
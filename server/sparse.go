@@ -0,0 +1,318 @@
+/*
+* @file sparse.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the support for sparse fieldsets and expansions: the
+* fields= parameter that trims a response to the fields asked for, and the
+* expand= parameter that embeds related resources. Lookups are told which
+* parts of a response are wanted so they skip the store calls for the rest.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Resources that support fields= and expand=.
+const (
+	resourceClient         = "client"
+	resourceClientVehicles = "client_vehicles"
+	resourceVehicle        = "vehicle"
+)
+
+// include says which optional parts of a response a lookup should load.
+type include struct {
+	vehicleCount bool // a client's number of vehicles
+	owner        bool // a vehicle's owner's details
+	weights      bool // a vehicle's weights, or each client vehicle's largest weight
+	mileage      bool // each client vehicle's mileage
+
+	vehicles       bool // expand=vehicles on a client
+	vehicleWeights bool // expand=vehicles.weights on a client
+}
+
+// includeAll loads everything a response has without expansions.
+var includeAll = include{vehicleCount: true, owner: true, weights: true, mileage: true}
+
+// The parts a field can need loaded.
+var (
+	loadVehicleCount   = func(i *include) { i.vehicleCount = true }
+	loadOwner          = func(i *include) { i.owner = true }
+	loadWeights        = func(i *include) { i.weights = true }
+	loadMileage        = func(i *include) { i.mileage = true }
+	loadClientVehicles = func(i *include) { i.mileage, i.weights = true, true }
+)
+
+// fieldParts maps the fields of each resource, in one API version, to the
+// parts that have to be loaded for them. Fields that need nothing beyond the
+// record itself map to nil.
+type fieldParts map[string]map[string]func(*include)
+
+// expansions maps each resource to the expansions it supports.
+var expansions = map[string]map[string]func(*include){
+	resourceClient: {
+		"vehicles":         func(i *include) { i.vehicles = true },
+		"vehicles.weights": func(i *include) { i.vehicles, i.vehicleWeights = true, true },
+	},
+}
+
+// alwaysIncluded are kept whatever fields= asks for, so a trimmed response
+// still says when it is incomplete.
+var alwaysIncluded = []string{"partial", "warnings"}
+
+// selection is a request's fields= and expand= parameters.
+type selection struct {
+	fields  []string
+	include include
+}
+
+// selectionFor parses the fields= and expand= parameters for resource. If
+// either names something the resource does not have it responds with 400 and
+// returns false.
+func selectionFor(c *gin.Context, resource string) (selection, bool) {
+	var sel selection
+	parts := versionOf(c).fields[resource]
+
+	sel.fields = splitParam(c.Query("fields"))
+	if len(sel.fields) == 0 {
+		sel.include = includeAll
+	}
+
+	for _, field := range sel.fields {
+		top, _, _ := strings.Cut(field, ".")
+		load, found := parts[field]
+		if !found && !contains(alwaysIncluded, top) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("unknown field %q; valid fields are %s", field, strings.Join(sortedKeys(parts), ", ")),
+			})
+			return sel, false
+		}
+		if load != nil {
+			load(&sel.include)
+		}
+	}
+
+	for _, expand := range splitParam(c.Query("expand")) {
+		load, found := expansions[resource][expand]
+		if !found {
+			message := fmt.Sprintf("unknown expansion %q; this resource has no expansions", expand)
+			if len(expansions[resource]) > 0 {
+				message = fmt.Sprintf("unknown expansion %q; valid expansions are %s", expand, strings.Join(sortedKeys(expansions[resource]), ", "))
+			}
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": message})
+			return sel, false
+		}
+		load(&sel.include)
+
+		// An expansion is part of the response even when fields= leaves it
+		// out, unless fields= picks some of its fields.
+		top, _, _ := strings.Cut(expand, ".")
+		if len(sel.fields) > 0 && !selectsFrom(sel.fields, top) {
+			sel.fields = append(sel.fields, top)
+		}
+	}
+
+	return sel, true
+}
+
+// selectsFrom reports whether fields includes top or any of its fields.
+func selectsFrom(fields []string, top string) bool {
+	for _, field := range fields {
+		if field == top || strings.HasPrefix(field, top+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// apply trims body to the selected fields. Without fields= it is returned
+// unchanged.
+func (sel selection) apply(body any) any {
+	if len(sel.fields) == 0 {
+		return body
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return body
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+
+	tree := make(fieldTree)
+	for _, field := range append(sel.fields, alwaysIncluded...) {
+		tree.add(strings.Split(field, "."))
+	}
+	return tree.prune(value)
+}
+
+// embedVehicles loads the vehicles listed for each client, keyed by client,
+// for expand=vehicles, with their weights if include asks for them. Each part
+// is one batched store call however many clients there are. A failed call is
+// reported as a failed field of every client.
+func (h *handlers) embedVehicles(ctx context.Context, vins map[string][]string, include include) (map[string][]EmbeddedVehicle, error) {
+	var group = h.pool.Group(ctx)
+	var vehicles map[string]database.Vehicle
+	var vehicles_loaded bool
+	var weights map[string][]database.Weight
+
+	var clients, all []string
+	for client, list := range vins {
+		clients = append(clients, client)
+		all = append(all, list...)
+	}
+	sort.Strings(clients)
+	sort.Strings(all)
+
+	group.Go(func(ctx context.Context) error {
+		var err error
+		vehicles, err = h.store.GetVehiclesByVins(ctx, all)
+		vehicles_loaded = err == nil
+		return failedFields(clients, "vehicles", err)
+	})
+
+	if include.vehicleWeights {
+		group.Go(func(ctx context.Context) error {
+			var err error
+			weights, err = h.store.GetWeightsByVins(ctx, all)
+			return failedFields(clients, "vehicles.weights", err)
+		})
+	}
+
+	err := group.Wait()
+	var missing []error
+
+	var results = make(map[string][]EmbeddedVehicle, len(vins))
+	for client, list := range vins {
+		// Embed the vehicles by VIN, so the body and its ETag are the same
+		// on every request.
+		list = append([]string(nil), list...)
+		sort.Strings(list)
+
+		embedded := []EmbeddedVehicle{}
+		for _, vin := range list {
+			// A vehicle deleted since the client's list was read is left
+			// out of the batch; its mileage is reported as failed rather
+			// than shown as 0.
+			if _, found := vehicles[vin]; vehicles_loaded && !found {
+				missing = append(missing, failedField("client:"+client, "vehicles.mileage", fmt.Errorf("vehicle %s does not exist", vin)))
+			}
+
+			vehicle := EmbeddedVehicle{Vin: vin, Mileage: vehicles[vin].Mileage, modified: vehicles[vin].Updated}
+			if include.vehicleWeights {
+				int_weights := []int{}
+				for _, weight := range weights[vin] {
+					int_weights = append(int_weights, int(weight.Weight))
+					vehicle.modified = latest(vehicle.modified, weight.Time)
+				}
+				vehicle.Weights = &int_weights
+			}
+			embedded = append(embedded, vehicle)
+		}
+		results[client] = embedded
+	}
+
+	return results, errors.Join(append([]error{err}, missing...)...)
+}
+
+// failedFields reports that field failed to load for each client.
+func failedFields(clients []string, field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var errs []error
+	for _, client := range clients {
+		errs = append(errs, failedField("client:"+client, field, err))
+	}
+	return errors.Join(errs...)
+}
+
+// fieldTree is a set of dotted field paths.
+type fieldTree map[string]fieldTree
+
+func (t fieldTree) add(path []string) {
+	child, found := t[path[0]]
+	if len(path) == 1 {
+		// Asking for a field keeps all of it, even if some of its fields
+		// were asked for too.
+		t[path[0]] = nil
+		return
+	}
+	if found && child == nil {
+		return
+	}
+	if child == nil {
+		child = make(fieldTree)
+		t[path[0]] = child
+	}
+	child.add(path[1:])
+}
+
+// prune removes the fields of value that are not in t. Lists are pruned item
+// by item.
+func (t fieldTree) prune(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			child, wanted := t[key]
+			switch {
+			case !wanted:
+				delete(value, key)
+			case child != nil:
+				value[key] = child.prune(field)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = t.prune(item)
+		}
+	}
+	return value
+}
+
+func splitParam(value string) []string {
+	var results []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			results = append(results, item)
+		}
+	}
+	return results
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
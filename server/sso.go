@@ -0,0 +1,191 @@
+/*
+* @file sso.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the OpenID Connect single sign-on login flow.
+ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/byron-ojua/starter-project/oidc"
+	"github.com/byron-ojua/starter-project/oidc/mockoidc"
+	"github.com/gin-gonic/gin"
+)
+
+// mockIssuerPath is where the mock OpenID provider is mounted when it is enabled.
+const mockIssuerPath = "/mock-oidc"
+
+// ssoCookieName is the cookie that ties a login sent to the provider to the
+// browser that started it. It holds the login's state, nonce and PKCE
+// verifier.
+const ssoCookieName = "sso_login"
+
+// ssoLoginLifetime is how long a browser has to return from the provider.
+const ssoLoginLifetime = 10 * time.Minute
+
+// ssoLogin runs the authorization code flow with PKCE and turns the verified
+// ID token into a session.
+type ssoLogin struct {
+	provider *oidc.Provider
+	roles    auth.RoleMapper
+	sessions *auth.SessionStore
+	cookies  auth.CookieConfig
+}
+
+// newSSOLogin configures SSO from settings. It returns nil when no issuer is
+// set and the mock provider is not enabled. With the mock provider a mock
+// issuer is returned as well, to be mounted at mockIssuerPath under
+// externalURL.
+func newSSOLogin(settings config.OIDC, externalURL string, sessions *auth.SessionStore, cookies auth.CookieConfig) (*ssoLogin, *mockoidc.Issuer, error) {
+	oidcConfig := oidc.Config{
+		IssuerURL:    settings.IssuerURL,
+		ClientID:     settings.ClientID,
+		ClientSecret: settings.ClientSecret,
+		RedirectURL:  settings.RedirectURL,
+		Scopes:       settings.Scopes,
+	}
+
+	roleMap := settings.RoleMap
+
+	var mock *mockoidc.Issuer
+	if settings.Mock {
+		if oidcConfig.ClientID == "" {
+			oidcConfig.ClientID = "starter-project"
+		}
+		if roleMap == "" {
+			roleMap = "admins=admin"
+		}
+
+		var err error
+		mock, err = mockoidc.New(oidcConfig.ClientID, mockoidc.User{
+			Subject: "mock-user",
+			Email:   "mock.user@example.com",
+			Name:    "Mock User",
+			Groups:  []string{"admins"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		mock.URL = externalURL + mockIssuerPath
+		oidcConfig.IssuerURL = mock.URL
+	}
+
+	if oidcConfig.IssuerURL == "" {
+		return nil, nil, nil
+	}
+
+	groupRoles, err := auth.ParseRoleMap(roleMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ssoLogin{
+		provider: oidc.NewProvider(oidcConfig),
+		roles: auth.RoleMapper{
+			GroupRoles:   groupRoles,
+			DefaultRoles: []string{auth.RoleViewer},
+		},
+		sessions: sessions,
+		cookies:  cookies,
+	}, mock, nil
+}
+
+// start sends the browser to the provider to log in.
+func (s *ssoLogin) start(c *gin.Context) {
+	state, err_state := oidc.NewState()
+	nonce, err_nonce := oidc.NewState()
+	verifier, err_verifier := oidc.NewVerifier()
+
+	if err_state != nil || err_nonce != nil || err_verifier != nil {
+		slog.Error("starting a single sign-on login failed", "err", errors.Join(err_state, err_nonce, err_verifier))
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error starting login"})
+		return
+	}
+
+	target, err := s.provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		slog.Error("reaching the identity provider failed", "err", err)
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"message": "identity provider unavailable"})
+		return
+	}
+
+	http.SetCookie(c.Writer, s.loginCookie(state+"."+nonce+"."+verifier, int(ssoLoginLifetime.Seconds())))
+	c.Redirect(http.StatusFound, target)
+}
+
+// loginCookie returns the cookie holding a login in progress. The provider
+// sends the browser back with a cross-site redirect, which Strict cookies
+// are not sent with, so it is at most Lax.
+func (s *ssoLogin) loginCookie(value string, maxAge int) *http.Cookie {
+	cookie := s.cookies.Cookie(ssoCookieName, value, true)
+	cookie.Path = "/login/sso"
+	cookie.MaxAge = maxAge
+	if cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	return cookie
+}
+
+// callback completes the login when the provider redirects back. The state
+// the provider returns must match the one in the browser's login cookie, so
+// a callback URL from someone else's login can't sign the browser in as
+// them.
+func (s *ssoLogin) callback(c *gin.Context) {
+	value, _ := c.Cookie(ssoCookieName)
+	http.SetCookie(c.Writer, s.loginCookie("", -1))
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || parts[0] == "" || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(c.Query("state"))) != 1 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "login expired, please try again"})
+		return
+	}
+	nonce, verifier := parts[1], parts[2]
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": providerErr})
+		return
+	}
+
+	claims, err := s.provider.Exchange(c.Request.Context(), c.Query("code"), verifier, nonce)
+	if err != nil {
+		slog.Warn("a single sign-on login failed", "err", err)
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": "login failed"})
+		return
+	}
+
+	session, err := s.sessions.Create(auth.SessionOIDC, s.userFromClaims(claims))
+	if err != nil {
+		slog.Error("creating a session failed", "err", err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "login failed"})
+		return
+	}
+
+	http.SetCookie(c.Writer, s.cookies.Cookie(auth.SessionCookieName, session.ID, true))
+	if _, err := issueCSRFToken(c, s.cookies); err != nil {
+		slog.Error("creating a CSRF token failed", "err", err)
+	}
+	c.Redirect(http.StatusFound, "/swagger/index.html")
+}
+
+// userFromClaims maps ID token claims to a local user.
+func (s *ssoLogin) userFromClaims(claims *oidc.Claims) auth.User {
+	return auth.User{
+		Subject: claims.Issuer + "|" + claims.Subject,
+		Email:   claims.Email,
+		Name:    claims.Name,
+		Roles:   s.roles.Roles(claims.Groups),
+	}
+}
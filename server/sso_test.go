@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/byron-ojua/starter-project/auth"
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/gin-gonic/gin"
+)
+
+// newSSOServer serves the SSO routes beside the mock provider, offline.
+func newSSOServer(t *testing.T) (*httptest.Server, *auth.SessionStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewUnstartedServer(nil)
+	base := "http://" + server.Listener.Addr().String()
+
+	sessions := auth.NewSessionStore(time.Hour)
+	cookies := auth.CookieConfig{SameSite: http.SameSiteStrictMode, MaxAge: 3600}
+	settings := config.OIDC{Mock: true, RedirectURL: base + "/login/sso/callback"}
+	sso, mock, err := newSSOLogin(settings, base, sessions, cookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/login/sso", sso.start)
+	router.GET("/login/sso/callback", sso.callback)
+	router.GET("/swagger/index.html", passwordProtected(sessions), func(c *gin.Context) {
+		c.String(http.StatusOK, "docs")
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle(mockIssuerPath+"/", http.StripPrefix(mockIssuerPath, mock))
+	mux.Handle("/", router)
+	server.Config.Handler = mux
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server, sessions
+}
+
+// newBrowser returns a client that keeps cookies, as a browser does.
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+func TestSSOLogin(t *testing.T) {
+	server, sessions := newSSOServer(t)
+	browser := newBrowser(t)
+
+	// The mock provider signs the user in without prompting, so following
+	// the redirects goes through the provider and back to the docs.
+	res, err := browser.Get(server.URL + "/login/sso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Request.URL.Path != "/swagger/index.html" {
+		t.Fatalf("got %d at %s, want 200 at /swagger/index.html", res.StatusCode, res.Request.URL.Path)
+	}
+
+	base, _ := url.Parse(server.URL)
+	var id string
+	for _, cookie := range browser.Jar.Cookies(base) {
+		if cookie.Name == auth.SessionCookieName {
+			id = cookie.Value
+		}
+	}
+	session, found := sessions.Get(id)
+	if !found {
+		t.Fatal("no session was started")
+	}
+	if !session.User.HasRole(auth.RoleAdmin) {
+		t.Errorf("got roles %v, want admin from the mock user's group", session.User.Roles)
+	}
+}
+
+func TestSSOCallbackFromAnotherBrowser(t *testing.T) {
+	server, _ := newSSOServer(t)
+
+	// The attacker starts a login and stops at the callback URL the
+	// provider sends them back to.
+	attacker := newBrowser(t)
+	attacker.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Path == "/login/sso/callback" {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	res, err := attacker.Get(server.URL + "/login/sso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	callback := res.Header.Get("Location")
+	if callback == "" {
+		t.Fatalf("got %d with no redirect to the callback", res.StatusCode)
+	}
+
+	// The victim opening it must not be signed in as the attacker.
+	victim := newBrowser(t)
+	res, err = victim.Get(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400", res.StatusCode)
+	}
+}
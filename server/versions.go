@@ -0,0 +1,328 @@
+/*
+* @file versions.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the API versions, the middleware that picks the version
+* a request is served with, and each version's response mappers. Handlers
+* build one response and leave its shape to the version's mappers.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiVersionKey is the context key the request's *apiVersion is stored under.
+const apiVersionKey = "api_version"
+
+// apiVersion is one version of the REST API and how it shapes responses.
+type apiVersion struct {
+	Name string
+
+	// Deprecated and Sunset, when set, are sent in the Deprecation and
+	// Sunset headers: when the version stopped being recommended and when it
+	// will be removed.
+	Deprecated time.Time
+	Sunset     time.Time
+
+	clients        func([]ClientWithVehicles) any
+	client         func(*ClientWithVehicles) any
+	clientVehicles func(*ClientVehicles) any
+	vehicle        func(*VehicleInfo) any
+
+	// fields are the fields each resource has in this version, for fields=.
+	fields fieldParts
+
+	// schemas are the types this version responds with in place of the
+	// handlers' own, keyed by the name the handlers' annotations use.
+	schemas map[string]any
+}
+
+// apiV1 is the original API. Its responses are the handlers' own types. It
+// is deprecated once the api.v1_deprecated setting says so.
+var apiV1 = &apiVersion{
+	Name: "v1",
+
+	clients:        func(clients []ClientWithVehicles) any { return clients },
+	client:         func(client *ClientWithVehicles) any { return client },
+	clientVehicles: func(vehicles *ClientVehicles) any { return vehicles },
+	vehicle:        func(vehicle *VehicleInfo) any { return vehicle },
+
+	fields: fieldParts{
+		resourceClient: {
+			"name":               nil,
+			"contact_name":       nil,
+			"contact_email":      nil,
+			"number_of_vehicles": loadVehicleCount,
+			"vehicles":           nil,
+			"vehicles.vin":       nil,
+			"vehicles.mileage":   nil,
+			"vehicles.weights":   nil,
+		},
+		resourceClientVehicles: {
+			"name":                    nil,
+			"vehicles":                loadClientVehicles,
+			"vehicles.vin":            nil,
+			"vehicles.mileage":        loadMileage,
+			"vehicles.largest_weight": loadWeights,
+		},
+		resourceVehicle: {
+			"vin":           nil,
+			"client_name":   loadOwner,
+			"contact_name":  loadOwner,
+			"contact_email": loadOwner,
+			"mileage":       nil,
+			"weights":       loadWeights,
+		},
+	},
+}
+
+// apiV2 groups contact details, names counts consistently and embeds a
+// vehicle's owner instead of flattening it.
+var apiV2 = &apiVersion{
+	Name: "v2",
+
+	clients: func(clients []ClientWithVehicles) any {
+		results := []ClientV2{}
+		for i := range clients {
+			results = append(results, clientV2(&clients[i]))
+		}
+		return results
+	},
+	client: func(client *ClientWithVehicles) any { return clientV2(client) },
+	clientVehicles: func(vehicles *ClientVehicles) any {
+		result := ClientVehiclesV2{
+			Client:   vehicles.Name,
+			Vehicles: vehicles.Vehicles,
+			Partial:  vehicles.Partial,
+			Warnings: vehicles.Warnings,
+		}
+		if result.Vehicles == nil {
+			result.Vehicles = []ClientVehicle{}
+		}
+		return result
+	},
+	vehicle: func(vehicle *VehicleInfo) any {
+		result := VehicleV2{
+			Vin:      vehicle.Vin,
+			Mileage:  vehicle.Mileage,
+			Weights:  vehicle.Weights,
+			Partial:  vehicle.Partial,
+			Warnings: vehicle.Warnings,
+		}
+		if vehicle.ClientName != "" {
+			result.Owner = &OwnerV2{
+				Name:    vehicle.ClientName,
+				Contact: ContactV2{Name: vehicle.ContactName, Email: vehicle.ContactEmail},
+			}
+		}
+		if result.Weights == nil {
+			result.Weights = []int{}
+		}
+		return result
+	},
+
+	fields: fieldParts{
+		resourceClient: {
+			"name":             nil,
+			"contact":          nil,
+			"contact.name":     nil,
+			"contact.email":    nil,
+			"vehicle_count":    loadVehicleCount,
+			"vehicles":         nil,
+			"vehicles.vin":     nil,
+			"vehicles.mileage": nil,
+			"vehicles.weights": nil,
+		},
+		resourceClientVehicles: {
+			"client":                  nil,
+			"vehicles":                loadClientVehicles,
+			"vehicles.vin":            nil,
+			"vehicles.mileage":        loadMileage,
+			"vehicles.largest_weight": loadWeights,
+		},
+		resourceVehicle: {
+			"vin":                 nil,
+			"mileage":             nil,
+			"owner":               loadOwner,
+			"owner.name":          loadOwner,
+			"owner.contact":       loadOwner,
+			"owner.contact.name":  loadOwner,
+			"owner.contact.email": loadOwner,
+			"weights":             loadWeights,
+		},
+	},
+
+	schemas: map[string]any{
+		"main.ClientWithVehicles": ClientV2{},
+		"main.ClientVehicles":     ClientVehiclesV2{},
+		"main.VehicleInfo":        VehicleV2{},
+	},
+}
+
+// apiVersions are the versions served, oldest first. Unversioned routes use
+// the first unless the Accept header asks for another.
+var apiVersions = []*apiVersion{apiV1, apiV2}
+
+// ContactV2 is a client's contact person.
+type ContactV2 struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ClientV2 is a client and the number of vehicles they have, in v2.
+type ClientV2 struct {
+	Name         string    `json:"name"`
+	Contact      ContactV2 `json:"contact"`
+	VehicleCount int       `json:"vehicle_count"`
+	Partial      bool      `json:"partial,omitempty"`
+	Warnings     []Warning `json:"warnings,omitempty"`
+
+	Vehicles *[]EmbeddedVehicle `json:"vehicles,omitempty"`
+}
+
+// ClientVehiclesV2 is a client's vehicles, in v2.
+type ClientVehiclesV2 struct {
+	Client   string          `json:"client"`
+	Vehicles []ClientVehicle `json:"vehicles"`
+	Partial  bool            `json:"partial,omitempty"`
+	Warnings []Warning       `json:"warnings,omitempty"`
+}
+
+// OwnerV2 is the client that owns a vehicle.
+type OwnerV2 struct {
+	Name    string    `json:"name"`
+	Contact ContactV2 `json:"contact"`
+}
+
+// VehicleV2 is a vehicle with its owner and weights, in v2.
+type VehicleV2 struct {
+	Vin      string    `json:"vin"`
+	Mileage  int       `json:"mileage"`
+	Owner    *OwnerV2  `json:"owner"`
+	Weights  []int     `json:"weights"`
+	Partial  bool      `json:"partial,omitempty"`
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+func clientV2(client *ClientWithVehicles) ClientV2 {
+	return ClientV2{
+		Name:         client.Name,
+		Contact:      ContactV2{Name: client.ContactName, Email: client.ContactEmail},
+		VehicleCount: client.NumVehicles,
+		Partial:      client.Partial,
+		Warnings:     client.Warnings,
+		Vehicles:     client.Vehicles,
+	}
+}
+
+// mediaType is the Accept value that asks for version on unversioned routes.
+func (v *apiVersion) mediaType() string {
+	return "application/vnd.fleet." + v.Name + "+json"
+}
+
+// useVersion serves a route group with version.
+func useVersion(version *apiVersion) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setVersion(c, version)
+		c.Next()
+	}
+}
+
+// negotiateVersion picks the version for an unversioned route from the Accept
+// header, either as application/vnd.fleet.v2+json or as a version parameter
+// such as application/json; version=2. Without either the oldest version is
+// used, so existing integrations keep working. A version that does not exist
+// is refused with 406.
+func negotiateVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+
+		version, requested := acceptedVersion(c.GetHeader("Accept"))
+		if requested != "" && version == nil {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{
+				"message": fmt.Sprintf("API version %q does not exist", requested),
+			})
+			return
+		}
+		if version == nil {
+			version = apiVersions[0]
+		}
+
+		setVersion(c, version)
+		c.Next()
+	}
+}
+
+// acceptedVersion returns the version asked for by an Accept header, and the
+// name asked for even if no such version exists.
+func acceptedVersion(accept string) (*apiVersion, string) {
+	for _, value := range strings.Split(accept, ",") {
+		parts := strings.Split(value, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(parts[0]))
+
+		var requested string
+		if name, found := strings.CutPrefix(mediaType, "application/vnd.fleet."); found {
+			requested, _ = strings.CutSuffix(name, "+json")
+		}
+		for _, param := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "version") {
+				requested = "v" + strings.TrimPrefix(strings.Trim(value, `"`), "v")
+			}
+		}
+
+		if requested == "" {
+			continue
+		}
+		for _, version := range apiVersions {
+			if version.Name == requested {
+				return version, requested
+			}
+		}
+		return nil, requested
+	}
+	return nil, ""
+}
+
+// setVersion stores version in the context and sends its headers.
+func setVersion(c *gin.Context, version *apiVersion) {
+	c.Set(apiVersionKey, version)
+	c.Header("API-Version", version.Name)
+
+	if !version.Deprecated.IsZero() {
+		c.Header("Deprecation", "@"+strconv.FormatInt(version.Deprecated.Unix(), 10))
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successorPath(c, version)))
+	}
+	if !version.Sunset.IsZero() {
+		c.Header("Sunset", version.Sunset.Format(http.TimeFormat))
+	}
+}
+
+// successorPath returns the path of the current request in the latest
+// version.
+func successorPath(c *gin.Context, version *apiVersion) string {
+	latest := apiVersions[len(apiVersions)-1]
+	path := strings.TrimPrefix(c.Request.URL.Path, "/"+version.Name)
+	return "/" + latest.Name + path
+}
+
+// versionOf returns the version a request is served with.
+func versionOf(c *gin.Context) *apiVersion {
+	if value, found := c.Get(apiVersionKey); found {
+		if version, ok := value.(*apiVersion); ok {
+			return version
+		}
+	}
+	return apiVersions[0]
+}
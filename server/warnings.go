@@ -0,0 +1,157 @@
+/*
+* @file warnings.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the types used to report fields that could not be
+* loaded during a handler's fan-out, instead of silently leaving them empty.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Warning names a field of a resource that could not be loaded.
+type Warning struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+// PartialFailure is the response to a strict request when some fields could
+// not be loaded.
+type PartialFailure struct {
+	Message  string    `json:"message"`
+	Warnings []Warning `json:"warnings"`
+}
+
+// fieldError is returned by a fan-out task when it fails to load a field.
+type fieldError struct {
+	resource string
+	field    string
+	err      error
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.resource, e.field, e.err)
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// failedField wraps err so the fan-out reports which field of resource failed.
+func failedField(resource, field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fieldError{resource: resource, field: field, err: err}
+}
+
+// fanoutWarnings turns the error returned by a fan-out into warnings. If ctx
+// was cancelled the results are incomplete for a reason other than a failed
+// field, so its error is returned instead.
+func fanoutWarnings(ctx context.Context, err error) ([]Warning, error) {
+	if err == nil {
+		return nil, nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	var warnings []Warning
+	for _, e := range flatten(err) {
+		slog.Warn("loading a field failed", "err", e)
+
+		var field *fieldError
+		if errors.As(e, &field) {
+			warnings = append(warnings, Warning{
+				Resource: field.resource,
+				Field:    field.field,
+				Message:  field.err.Error(),
+			})
+		} else {
+			warnings = append(warnings, Warning{Message: e.Error()})
+		}
+	}
+
+	return warnings, nil
+}
+
+// allowPartial reports whether a response with warnings may be sent. When
+// strict=true was asked for and something failed, it writes an error response
+// itself and returns false.
+func allowPartial(c *gin.Context, warnings []Warning) bool {
+	if len(warnings) == 0 || c.Query("strict") != "true" {
+		return true
+	}
+
+	c.IndentedJSON(http.StatusBadGateway, PartialFailure{
+		Message:  "some fields could not be loaded",
+		Warnings: warnings,
+	})
+	return false
+}
+
+// lookupFailed responds to a failed lookup: 404 with message if the record
+// does not exist, otherwise as storeFailed does.
+func lookupFailed(c *gin.Context, err error, message string) {
+	slog.Info("a lookup failed", "err", err)
+
+	if errors.Is(err, database.ErrNotFound) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": message})
+		return
+	}
+	storeFailed(c, err)
+}
+
+// storeFailed responds to a failed store call: 404 if the record does not
+// exist, 503 if the request was cancelled or the store is unavailable, and
+// 500 otherwise.
+func storeFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"message": "request cancelled"})
+	case errors.Is(err, database.ErrClosed):
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"message": "store unavailable"})
+	default:
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "store error"})
+	}
+}
+
+// warningsFor returns the warnings about resource.
+func warningsFor(warnings []Warning, resource string) []Warning {
+	var results []Warning
+	for _, warning := range warnings {
+		if warning.Resource == resource {
+			results = append(results, warning)
+		}
+	}
+	return results
+}
+
+// flatten expands errors combined with errors.Join.
+func flatten(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var results []error
+		for _, e := range joined.Unwrap() {
+			results = append(results, flatten(e)...)
+		}
+		return results
+	}
+	return []error{err}
+}
@@ -0,0 +1,122 @@
+// Package web serves the React frontend, built into the binary from
+// client/ with npm run build, as a single-page app.
+package web
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Prefix is the path the frontend is served under. It matches homepage in
+// client/package.json; the app's own routes, such as /clients, would
+// otherwise clash with the API's.
+const Prefix = "/app"
+
+// ConfigPath is where the frontend reads its Config, under Prefix.
+const ConfigPath = Prefix + "/config.json"
+
+// Config is the settings the frontend reads when it starts, so one build
+// can be pointed at any API.
+type Config struct {
+	// APIBaseURL is where the API is served. Empty means the origin the
+	// frontend was served from.
+	APIBaseURL string `json:"api_base_url"`
+}
+
+//go:embed all:build
+var build embed.FS
+
+// App serves the built frontend.
+type App struct {
+	files fs.FS
+	etags map[string]string
+}
+
+// New returns an App serving the frontend embedded in the binary.
+func New() *App {
+	files, err := fs.Sub(build, "build")
+	if err != nil {
+		panic(err)
+	}
+
+	// The files never change, so their ETags are worked out once.
+	etags := make(map[string]string)
+	err = fs.WalkDir(files, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		etags[name] = `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return &App{files: files, etags: etags}
+}
+
+// Built reports whether a frontend build was embedded, rather than only
+// the placeholder that lets the package compile without one.
+func (a *App) Built() bool {
+	_, err := fs.Stat(a.files, "index.html")
+	return err == nil
+}
+
+// ServeHTTP serves the file named by the request's path under Prefix. A
+// path with no file extension that names no file is one of the app's own
+// routes, so it gets index.html and the app routes it in the browser.
+//
+// Files under static/ have a content hash in their names, so they are
+// cached for a year; everything else, index.html in particular, is checked
+// on each load so a new build is picked up straight away.
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, Prefix)), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	file, err := a.files.Open(name)
+	if err == nil {
+		if info, statErr := file.Stat(); statErr != nil || info.IsDir() {
+			file.Close()
+			err = fs.ErrNotExist
+		}
+	}
+	if err != nil && path.Ext(name) == "" {
+		name = "index.html"
+		file, err = a.files.Open(name)
+	}
+	if err != nil {
+		if name == "index.html" {
+			http.Error(w, "the frontend has not been built; run npm run build in client", http.StatusNotFound)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	if strings.HasPrefix(name, "static/") {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	// ServeContent answers If-None-Match with 304 from the ETag.
+	w.Header().Set("ETag", a.etags[name])
+
+	// Embedded files can seek, which ServeContent needs for ranges.
+	http.ServeContent(w, r, name, time.Time{}, file.(io.ReadSeeker))
+}
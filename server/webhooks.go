@@ -0,0 +1,236 @@
+/*
+* @file webhooks.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the handlers for managing a client's outbound webhook
+* subscriptions and for inspecting and replaying failed deliveries.
+ */
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/byron-ojua/starter-project/config"
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/webhooks"
+	"github.com/gin-gonic/gin"
+)
+
+// NewWebhook is the body accepted when subscribing to a client's events
+type NewWebhook struct {
+	URL             string   `json:"url" binding:"required"`
+	Events          []string `json:"events" binding:"required,min=1"`
+	Secret          string   `json:"secret"`
+	WeightThreshold float32  `json:"weight_threshold" binding:"min=0"`
+}
+
+// webhookHandlers serves the webhook routes.
+type webhookHandlers struct {
+	store    database.Store
+	webhooks *webhooks.Manager
+}
+
+// webhookOptions returns the options webhooks are kept and retried with.
+func webhookOptions(settings config.Webhooks) webhooks.Options {
+	return webhooks.Options{
+		Path:        settings.StoreFile,
+		MaxAttempts: settings.MaxAttempts,
+		BaseDelay:   time.Duration(settings.RetryDelay),
+		Convert:     eventPayload,
+
+		AllowPrivateHosts: settings.AllowPrivateHosts,
+	}
+}
+
+// listWebhooks responds with the webhook subscriptions of the client whose ID
+// matches the id parameter, without their secrets.
+// @Summary List a client's webhooks
+// @Description Get the webhook subscriptions of a client. Secrets are not returned.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Client Name"
+// @Success 200 {array} webhooks.Subscription
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /clients/{id}/webhooks [get]
+func (h *webhookHandlers) listWebhooks(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := h.store.GetClientsByName(c.Request.Context(), id); err != nil {
+		storeFailed(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, h.webhooks.Subscriptions(id))
+}
+
+// createWebhook subscribes a URL to the events of the client whose ID matches
+// the id parameter, and responds with the subscription and its secret.
+// @Summary Subscribe to a client's events
+// @Description Register a URL to receive a client's events. Each delivery is signed with HMAC-SHA256 using the returned secret; it is only shown once.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Client Name"
+// @Param webhook body NewWebhook true "Webhook subscription"
+// @Param Idempotency-Key header string false "Unique key for this request; retries with the same key get the first response"
+// @Success 201 {object} webhooks.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /clients/{id}/webhooks [post]
+func (h *webhookHandlers) createWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	var body NewWebhook
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	if _, err := h.store.GetClientsByName(c.Request.Context(), id); err != nil {
+		storeFailed(c, err)
+		return
+	}
+
+	sub, err := h.webhooks.Subscribe(webhooks.Subscription{
+		Client:          id,
+		URL:             body.URL,
+		Events:          body.Events,
+		Secret:          body.Secret,
+		WeightThreshold: body.WeightThreshold,
+	})
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, sub)
+}
+
+// deleteWebhook removes one of a client's webhook subscriptions and drops its
+// queued deliveries.
+// @Summary Remove a webhook
+// @Description Stop sending a client's events to a webhook and drop its queued deliveries.
+// @Tags webhooks
+// @Param id path string true "Client Name"
+// @Param hook path string true "Webhook ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /clients/{id}/webhooks/{hook} [delete]
+func (h *webhookHandlers) deleteWebhook(c *gin.Context) {
+	err := h.webhooks.Unsubscribe(c.Param("id"), c.Param("hook"))
+	if errors.Is(err, webhooks.ErrNotFound) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listDeliveries returns queued and failed deliveries, optionally filtered by
+// the state query parameter (pending, dead or delivered).
+// @Summary List webhook deliveries
+// @Description List queued, failed and delivered webhook deliveries
+// @Tags admin
+// @Produce json
+// @Param state query string false "Only deliveries in this state: pending, dead or delivered"
+// @Success 200 {array} webhooks.Delivery
+// @Failure 400 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/webhooks/deliveries [get]
+func (h *webhookHandlers) listDeliveries(c *gin.Context) {
+	state := c.Query("state")
+	switch state {
+	case "", webhooks.StatePending, webhooks.StateDead, webhooks.StateDelivered:
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "state must be pending, dead or delivered"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, h.webhooks.Deliveries(state))
+}
+
+// listDeadLetters returns the deliveries that ran out of attempts.
+// @Summary List dead webhook deliveries
+// @Description List the webhook deliveries that ran out of attempts
+// @Tags admin
+// @Produce json
+// @Success 200 {array} webhooks.Delivery
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/webhooks/dead-letters [get]
+func (h *webhookHandlers) listDeadLetters(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, h.webhooks.Deliveries(webhooks.StateDead))
+}
+
+// replay sends a delivery again.
+// @Summary Replay a webhook delivery
+// @Description Send a pending or failed delivery again now
+// @Tags admin
+// @Produce json
+// @Param delivery path string true "Delivery ID"
+// @Success 202 {object} webhooks.Delivery
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/webhooks/deliveries/{delivery}/replay [post]
+func (h *webhookHandlers) replay(c *gin.Context) {
+	delivery, err := h.webhooks.Replay(c.Param("delivery"))
+	if errors.Is(err, webhooks.ErrNotFound) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusAccepted, delivery)
+}
+
+// replayDeadLetters sends every dead letter again.
+// @Summary Replay dead webhook deliveries
+// @Description Send every delivery that ran out of attempts again now
+// @Tags admin
+// @Produce json
+// @Success 202 {array} webhooks.Delivery
+// @Failure 500 {object} map[string]string
+// @Failure 302 "Redirects to /login when not logged in"
+// @Failure 403 {object} map[string]string
+// @Router /admin/webhooks/dead-letters/replay [post]
+func (h *webhookHandlers) replayDeadLetters(c *gin.Context) {
+	replayed := []webhooks.Delivery{}
+	for _, dead := range h.webhooks.Deliveries(webhooks.StateDead) {
+		delivery, err := h.webhooks.Replay(dead.ID)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		replayed = append(replayed, delivery)
+	}
+	c.IndentedJSON(http.StatusAccepted, replayed)
+}
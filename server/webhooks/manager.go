@@ -0,0 +1,687 @@
+// Package webhooks delivers fleet events to customer endpoints. Deliveries
+// are signed, queued persistently and retried with exponential backoff until
+// they succeed or are moved to a dead-letter list.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+)
+
+// Delivery states.
+const (
+	StatePending   = "pending"
+	StateDelivered = "delivered"
+	StateDead      = "dead"
+)
+
+// ErrNotFound is returned for unknown subscriptions and deliveries.
+var ErrNotFound = errors.New("webhook not found")
+
+// Subscription sends a client's events of the given types to URL. When
+// WeightThreshold is set, violation.overweight is sent for any reading above
+// it rather than above the server-wide limit.
+type Subscription struct {
+	ID              string    `json:"id"`
+	Client          string    `json:"client"`
+	URL             string    `json:"url"`
+	Events          []string  `json:"events"`
+	Secret          string    `json:"secret,omitempty"`
+	WeightThreshold float32   `json:"weight_threshold,omitempty"`
+	Created         time.Time `json:"created"`
+}
+
+// Delivery is one event being sent to one subscription.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Client         string          `json:"client"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	State          string          `json:"state"`
+	Attempts       int             `json:"attempts"`
+	NextAttempt    time.Time       `json:"next_attempt"`
+	LastStatus     int             `json:"last_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	Created        time.Time       `json:"created"`
+	Delivered      *time.Time      `json:"delivered,omitempty"`
+}
+
+// Payload is the body posted to the subscriber.
+type Payload struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Client  string    `json:"client"`
+	Vin     string    `json:"vin,omitempty"`
+	Created time.Time `json:"created"`
+	Data    any       `json:"data"`
+}
+
+// Options configures a Manager. Zero values take the defaults in Open.
+type Options struct {
+	// Path is the JSON file subscriptions and the delivery queue are kept
+	// in. Leave it empty to keep them in memory only.
+	Path string
+
+	// Client sends deliveries. The default refuses to connect to private,
+	// loopback and link-local addresses unless AllowPrivateHosts is set.
+	Client      *http.Client
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Workers     int
+
+	// Convert turns the record carried by an event into its API
+	// representation for the payload's data field.
+	Convert func(events.Event) any
+
+	// AllowPrivateHosts lets subscriptions send to private, loopback and
+	// link-local addresses. Without it, a subscriber could have the server
+	// post to services only reachable from inside its network.
+	AllowPrivateHosts bool
+}
+
+// Manager holds the webhook subscriptions and delivers events to them.
+type Manager struct {
+	options Options
+	now     func() time.Time
+	wake    chan struct{}
+
+	mu            sync.Mutex
+	subscriptions map[string]Subscription
+	deliveries    map[string]*Delivery
+	inFlight      map[string]bool
+	delivered     []string
+	dirty         bool
+
+	// saving makes sure writes of the file happen one at a time, in order.
+	saving sync.Mutex
+}
+
+// keepDelivered is how many delivered deliveries are kept, newest first, for
+// inspection. Older ones are forgotten.
+const keepDelivered = 100
+
+// state is what is persisted to Options.Path.
+type state struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	Deliveries    []*Delivery    `json:"deliveries"`
+}
+
+// Open returns a Manager, loading any subscriptions and queued deliveries
+// saved at options.Path.
+func Open(options Options) (*Manager, error) {
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+		if !options.AllowPrivateHosts {
+			options.Client.Transport = publicTransport()
+		}
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 8
+	}
+	if options.BaseDelay <= 0 {
+		options.BaseDelay = 30 * time.Second
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = time.Hour
+	}
+	if options.Workers <= 0 {
+		options.Workers = 4
+	}
+	if options.Convert == nil {
+		options.Convert = func(event events.Event) any { return event.Data }
+	}
+
+	m := &Manager{
+		options:       options,
+		now:           time.Now,
+		wake:          make(chan struct{}, 1),
+		subscriptions: make(map[string]Subscription),
+		deliveries:    make(map[string]*Delivery),
+		inFlight:      make(map[string]bool),
+	}
+
+	if options.Path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(options.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("reading webhooks: %w", err)
+	}
+	for _, sub := range saved.Subscriptions {
+		m.subscriptions[sub.ID] = sub
+	}
+	for _, delivery := range saved.Deliveries {
+		m.deliveries[delivery.ID] = delivery
+	}
+	return m, nil
+}
+
+// Subscribe validates and adds a subscription. A secret is generated if none
+// is given.
+func (m *Manager) Subscribe(sub Subscription) (Subscription, error) {
+	target, err := url.Parse(sub.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return sub, errors.New("url must be an absolute http or https URL")
+	}
+	if !m.options.AllowPrivateHosts && privateHost(target.Hostname()) {
+		return sub, errors.New("url must not point at a private, loopback or link-local address")
+	}
+	if len(sub.Events) == 0 {
+		return sub, errors.New("at least one event type is required")
+	}
+	for _, event := range sub.Events {
+		if !SupportedEvent(event) {
+			return sub, fmt.Errorf("unsupported event type %q", event)
+		}
+	}
+
+	if sub.ID, err = randomID(); err != nil {
+		return sub, err
+	}
+	if sub.Secret == "" {
+		if sub.Secret, err = randomID(); err != nil {
+			return sub, err
+		}
+	}
+	sub.Created = m.now().UTC()
+
+	m.mu.Lock()
+	m.subscriptions[sub.ID] = sub
+	m.dirty = true
+	m.mu.Unlock()
+
+	return sub, m.Flush()
+}
+
+// Unsubscribe removes a client's subscription. Queued deliveries for it are
+// dropped.
+func (m *Manager) Unsubscribe(client, id string) error {
+	m.mu.Lock()
+	sub, found := m.subscriptions[id]
+	if !found || sub.Client != client {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+
+	delete(m.subscriptions, id)
+	for key, delivery := range m.deliveries {
+		if delivery.SubscriptionID == id {
+			delete(m.deliveries, key)
+		}
+	}
+	m.dirty = true
+	m.mu.Unlock()
+
+	return m.Flush()
+}
+
+// Subscriptions returns a client's subscriptions without their secrets.
+func (m *Manager) Subscriptions(client string) []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := []Subscription{}
+	for _, sub := range m.subscriptions {
+		if sub.Client == client {
+			sub.Secret = ""
+			results = append(results, sub)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Created.Before(results[j].Created) })
+	return results
+}
+
+// Deliveries returns the deliveries in state, or every delivery if state is
+// empty, oldest first.
+func (m *Manager) Deliveries(state string) []Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := []Delivery{}
+	for _, delivery := range m.deliveries {
+		if state == "" || delivery.State == state {
+			results = append(results, *delivery)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Created.Before(results[j].Created) })
+	return results
+}
+
+// Replay queues a failed delivery to be sent again straight away, with its
+// attempts reset.
+func (m *Manager) Replay(id string) (Delivery, error) {
+	m.mu.Lock()
+	delivery, found := m.deliveries[id]
+	if !found {
+		m.mu.Unlock()
+		return Delivery{}, ErrNotFound
+	}
+	if delivery.State == StateDelivered {
+		m.mu.Unlock()
+		return *delivery, errors.New("delivery has already succeeded")
+	}
+
+	delivery.State = StatePending
+	delivery.Attempts = 0
+	delivery.NextAttempt = m.now()
+	replayed := *delivery
+	m.dirty = true
+	m.mu.Unlock()
+
+	m.notify()
+	return replayed, m.Flush()
+}
+
+// Handle queues a delivery of event to every subscription it matches, one
+// for each event type the subscription wants it as.
+func (m *Manager) Handle(event events.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued := false
+	for _, sub := range m.subscriptions {
+		for _, eventType := range sub.matches(event) {
+			id, err := randomID()
+			if err != nil {
+				slog.Error("creating a webhook delivery failed", "err", err)
+				continue
+			}
+
+			payload, err := json.Marshal(Payload{
+				ID:      id,
+				Type:    eventType,
+				Client:  event.Client,
+				Vin:     event.Vin,
+				Created: event.Time,
+				Data:    m.options.Convert(event),
+			})
+			if err != nil {
+				slog.Error("encoding a webhook payload failed", "err", err)
+				continue
+			}
+
+			m.deliveries[id] = &Delivery{
+				ID:             id,
+				SubscriptionID: sub.ID,
+				Client:         sub.Client,
+				Event:          eventType,
+				Payload:        payload,
+				State:          StatePending,
+				NextAttempt:    m.now(),
+				Created:        m.now().UTC(),
+			}
+			queued = true
+		}
+	}
+
+	if queued {
+		m.dirty = true
+		m.notify()
+	}
+}
+
+// Run feeds events from bus into the queue and delivers queued events until
+// ctx is cancelled. Changes to the queue are saved at most once a second,
+// and once more before it returns.
+func (m *Manager) Run(ctx context.Context, bus *events.Bus) {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		if err := m.Flush(); err != nil {
+			slog.Error("saving webhooks failed", "err", err)
+		}
+	}()
+
+	// Events are taken off the bus on their own, so slow receivers never
+	// hold them up.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.consume(ctx, bus)
+	}()
+
+	slots := make(chan struct{}, m.options.Workers)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if err := m.Flush(); err != nil {
+				slog.Error("saving webhooks failed", "err", err)
+			}
+		case <-m.wake:
+		case <-ctx.Done():
+			return
+		}
+
+		// Only as many deliveries are started as there are free workers,
+		// so taking a slot never blocks. A worker that finishes wakes the
+		// loop to start the next.
+		for _, id := range m.due(cap(slots) - len(slots)) {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				defer func() {
+					<-slots
+					m.notify()
+				}()
+				m.deliver(ctx, id)
+			}(id)
+		}
+	}
+}
+
+// consume queues deliveries for the events published on bus until ctx is
+// cancelled or the bus is closed, starting with those published before it
+// was called that the bus still holds for replay. If it falls behind and is
+// cut off, it subscribes again after the last event it handled, picking up
+// the ones it missed the same way.
+func (m *Manager) consume(ctx context.Context, bus *events.Bus) {
+	var lastID uint64
+	subscription, earlier := bus.SubscribeAfter(nil, 1024, lastID)
+	defer func() { subscription.Close() }()
+
+	for _, event := range earlier {
+		m.Handle(event)
+		lastID = event.ID
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.C:
+			if ok {
+				m.Handle(event)
+				lastID = event.ID
+				continue
+			}
+			if !subscription.Dropped() {
+				return
+			}
+
+			var missed []events.Event
+			subscription, missed = bus.SubscribeAfter(nil, 1024, lastID)
+			if len(missed) > 0 && missed[0].ID > lastID+1 {
+				slog.Error("webhooks fell behind the event bus; some events were lost", "lost", missed[0].ID-lastID-1)
+			} else {
+				slog.Warn("webhooks fell behind the event bus; resubscribing", "replayed", len(missed))
+			}
+			for _, event := range missed {
+				m.Handle(event)
+				lastID = event.ID
+			}
+		}
+	}
+}
+
+// due marks up to limit pending deliveries whose next attempt has come as in
+// flight, longest waiting first, and returns their IDs.
+func (m *Manager) due(limit int) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var ready []*Delivery
+	for id, delivery := range m.deliveries {
+		if delivery.State == StatePending && !m.inFlight[id] && !delivery.NextAttempt.After(now) {
+			ready = append(ready, delivery)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].NextAttempt.Before(ready[j].NextAttempt) })
+
+	var ids []string
+	for _, delivery := range ready {
+		if len(ids) == limit {
+			break
+		}
+		m.inFlight[delivery.ID] = true
+		ids = append(ids, delivery.ID)
+	}
+	return ids
+}
+
+// deliver makes one attempt at sending a delivery and records the result.
+func (m *Manager) deliver(ctx context.Context, id string) {
+	m.mu.Lock()
+	delivery, found := m.deliveries[id]
+	var sub Subscription
+	if found {
+		sub, found = m.subscriptions[delivery.SubscriptionID]
+	}
+	var payload []byte
+	var eventType string
+	if found {
+		payload = delivery.Payload
+		eventType = delivery.Event
+	}
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.inFlight, id)
+		m.mu.Unlock()
+	}()
+
+	if !found {
+		return
+	}
+
+	status, err := m.post(ctx, sub, id, eventType, payload)
+	if ctx.Err() != nil {
+		// Shutting down; the delivery stays queued for next time.
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delivery, found = m.deliveries[id]
+	if !found {
+		return
+	}
+
+	now := m.now()
+	delivery.Attempts++
+	delivery.LastStatus = status
+
+	switch {
+	case err == nil:
+		delivery.State = StateDelivered
+		delivery.LastError = ""
+		delivered := now.UTC()
+		delivery.Delivered = &delivered
+		m.forgetDelivered(id)
+	case delivery.Attempts >= m.options.MaxAttempts:
+		delivery.State = StateDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = now.Add(m.backoff(delivery.Attempts))
+	}
+	m.dirty = true
+}
+
+// forgetDelivered records that id was delivered and drops the oldest
+// delivered deliveries beyond keepDelivered. The caller must hold m.mu.
+func (m *Manager) forgetDelivered(id string) {
+	m.delivered = append(m.delivered, id)
+	for len(m.delivered) > keepDelivered {
+		delete(m.deliveries, m.delivered[0])
+		m.delivered = m.delivered[1:]
+	}
+}
+
+// post sends a signed payload to sub and returns the response status.
+func (m *Manager) post(ctx context.Context, sub Subscription, id, eventType string, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := m.now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "starter-project-webhooks/1")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, id)
+	req.Header.Set(TimestampHeader, fmt.Sprint(timestamp.Unix()))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, timestamp, payload))
+
+	resp, err := m.options.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt after attempts failures.
+func (m *Manager) backoff(attempts int) time.Duration {
+	delay := m.options.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= m.options.MaxDelay {
+			return m.options.MaxDelay
+		}
+	}
+	return delay
+}
+
+// notify wakes Run to look for due deliveries.
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush writes the subscriptions and queue to Options.Path, replacing the
+// file atomically, if they have changed since they were last written.
+// Delivered entries are not kept. The file is written without holding the
+// lock deliveries are queued and recorded under.
+func (m *Manager) Flush() error {
+	if m.options.Path == "" {
+		return nil
+	}
+
+	m.saving.Lock()
+	defer m.saving.Unlock()
+
+	m.mu.Lock()
+	if !m.dirty {
+		m.mu.Unlock()
+		return nil
+	}
+	saved := state{Subscriptions: []Subscription{}, Deliveries: []*Delivery{}}
+	for _, sub := range m.subscriptions {
+		saved.Subscriptions = append(saved.Subscriptions, sub)
+	}
+	for _, delivery := range m.deliveries {
+		if delivery.State != StateDelivered {
+			// A copy, as the queue's entries change once the lock is
+			// released.
+			copied := *delivery
+			saved.Deliveries = append(saved.Deliveries, &copied)
+		}
+	}
+	m.dirty = false
+	m.mu.Unlock()
+
+	if err := writeState(m.options.Path, saved); err != nil {
+		m.mu.Lock()
+		m.dirty = true
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// writeState writes saved to path by way of a temporary file.
+func writeState(path string, saved state) error {
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0o600); err != nil {
+		return fmt.Errorf("saving webhooks: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fmt.Errorf("saving webhooks: %w", err)
+	}
+	return nil
+}
+
+// SupportedEvent reports whether subscriptions may ask for eventType.
+func SupportedEvent(eventType string) bool {
+	switch eventType {
+	case events.Overweight, events.VehicleAdded, events.VehicleSaved,
+		events.MileageChanged, events.WeightAdded, events.ClientSaved:
+		return true
+	}
+	return false
+}
+
+// matches returns the event types sub wants event delivered as, if any. A
+// reading can be both a weight.added and, over the subscription's own
+// threshold, a violation.overweight.
+func (sub Subscription) matches(event events.Event) []string {
+	if event.Client != sub.Client {
+		return nil
+	}
+
+	var types []string
+	for _, wanted := range sub.Events {
+		switch {
+		case wanted == events.Overweight && sub.WeightThreshold > 0:
+			// A custom threshold is checked against every reading instead of
+			// the server-wide violation events.
+			if weight, ok := event.Data.(database.Weight); ok && event.Type == events.WeightAdded && weight.Weight > sub.WeightThreshold {
+				types = append(types, events.Overweight)
+			}
+		case wanted == event.Type:
+			types = append(types, event.Type)
+		}
+	}
+	return types
+}
+
+func randomID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,302 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+)
+
+// receiver is a webhook endpoint that records what it is sent and answers
+// with the statuses in replies, then 200.
+type receiver struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	replies    []int
+	deliveries []*http.Request
+	bodies     [][]byte
+	received   chan struct{}
+}
+
+func newReceiver(t *testing.T, replies ...int) *receiver {
+	t.Helper()
+	r := &receiver{replies: replies, received: make(chan struct{}, 16)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.deliveries = append(r.deliveries, req)
+		r.bodies = append(r.bodies, body)
+		status := http.StatusOK
+		if len(r.replies) > 0 {
+			status, r.replies = r.replies[0], r.replies[1:]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// wait waits for the receiver to be sent n more requests.
+func (r *receiver) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the receiver got %d of %d deliveries", i, n)
+		}
+	}
+}
+
+// waitFor polls until done returns true.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// run starts m delivering the events published on a new bus.
+func run(t *testing.T, m *Manager) *events.Bus {
+	t.Helper()
+	return runOn(t, m, events.NewBus(100))
+}
+
+// runOn starts m delivering the events published on bus.
+func runOn(t *testing.T, m *Manager, bus *events.Bus) *events.Bus {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx, bus)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return bus
+}
+
+func TestDeliverSigned(t *testing.T) {
+	r := newReceiver(t)
+	m, err := Open(Options{AllowPrivateHosts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := m.Subscribe(Subscription{Client: "CIA", URL: r.URL, Events: []string{events.VehicleAdded}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := run(t, m)
+
+	bus.Publish(events.Event{Type: events.VehicleSaved, Client: "CIA", Vin: "1A"})
+	bus.Publish(events.Event{Type: events.VehicleAdded, Client: "FBI", Vin: "2A"})
+	bus.Publish(events.Event{Type: events.VehicleAdded, Client: "CIA", Vin: "1A"})
+	r.wait(t, 1)
+
+	r.mu.Lock()
+	req, body := r.deliveries[0], r.bodies[0]
+	r.mu.Unlock()
+
+	if req.Header.Get(EventHeader) != events.VehicleAdded {
+		t.Errorf("got event %q, want %q", req.Header.Get(EventHeader), events.VehicleAdded)
+	}
+	if !Verify(sub.Secret, req.Header.Get(SignatureHeader), req.Header.Get(TimestampHeader), body, time.Minute) {
+		t.Error("the signature does not verify with the subscription's secret")
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Client != "CIA" || payload.Vin != "1A" || payload.ID != req.Header.Get(DeliveryHeader) {
+		t.Errorf("got payload %+v", payload)
+	}
+
+	waitFor(t, "the delivery to be recorded", func() bool {
+		return len(m.Deliveries(StateDelivered)) == 1
+	})
+	if pending := m.Deliveries(StatePending); len(pending) != 0 {
+		t.Errorf("got %d pending deliveries, want none", len(pending))
+	}
+}
+
+func TestRetryUntilDelivered(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError)
+	m, err := Open(Options{AllowPrivateHosts: true, BaseDelay: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(Subscription{Client: "CIA", URL: r.URL, Events: []string{events.WeightAdded}}); err != nil {
+		t.Fatal(err)
+	}
+	bus := run(t, m)
+
+	bus.Publish(events.Event{Type: events.WeightAdded, Client: "CIA", Vin: "1A", Data: database.Weight{Vin: "1A", Weight: 100}})
+	r.wait(t, 2)
+
+	waitFor(t, "the retry to be recorded", func() bool {
+		delivered := m.Deliveries(StateDelivered)
+		return len(delivered) == 1 && delivered[0].Attempts == 2
+	})
+}
+
+func TestDeadAfterMaxAttempts(t *testing.T) {
+	r := newReceiver(t, http.StatusBadGateway, http.StatusBadGateway)
+	m, err := Open(Options{AllowPrivateHosts: true, BaseDelay: time.Millisecond, MaxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(Subscription{Client: "CIA", URL: r.URL, Events: []string{events.ClientSaved}}); err != nil {
+		t.Fatal(err)
+	}
+	bus := run(t, m)
+
+	bus.Publish(events.Event{Type: events.ClientSaved, Client: "CIA"})
+	r.wait(t, 2)
+
+	waitFor(t, "the delivery to be dead", func() bool {
+		dead := m.Deliveries(StateDead)
+		return len(dead) == 1 && dead[0].LastStatus == http.StatusBadGateway
+	})
+
+	if _, err := m.Replay(m.Deliveries(StateDead)[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	r.wait(t, 1)
+}
+
+func TestWeightThreshold(t *testing.T) {
+	m, err := Open(Options{AllowPrivateHosts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The events are listed in both orders, so neither can hide the other.
+	for _, wanted := range [][]string{{events.Overweight, events.WeightAdded}, {events.WeightAdded, events.Overweight}} {
+		if _, err := m.Subscribe(Subscription{Client: "CIA", URL: "http://127.0.0.1:1/hooks", Events: wanted, WeightThreshold: 5000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m.Handle(events.Event{ID: 1, Type: events.WeightAdded, Client: "CIA", Vin: "1A", Data: database.Weight{Vin: "1A", Weight: 4000}})
+	m.Handle(events.Event{ID: 2, Type: events.WeightAdded, Client: "CIA", Vin: "1A", Data: database.Weight{Vin: "1A", Weight: 6000}})
+	// A server-wide violation is left to the subscriptions' own threshold.
+	m.Handle(events.Event{ID: 3, Type: events.Overweight, Client: "CIA", Vin: "1A", Data: database.Weight{Vin: "1A", Weight: 90000}})
+
+	counts := make(map[string]int)
+	for _, delivery := range m.Deliveries(StatePending) {
+		counts[delivery.Event]++
+	}
+	if counts[events.WeightAdded] != 4 || counts[events.Overweight] != 2 || len(counts) != 2 {
+		t.Errorf("got deliveries %v, want 4 weight.added and 2 violation.overweight", counts)
+	}
+}
+
+func TestCatchUpAfterFallingBehind(t *testing.T) {
+	m, err := Open(Options{AllowPrivateHosts: true, BaseDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(Subscription{Client: "CIA", URL: "http://127.0.0.1:1/hooks", Events: []string{events.ClientSaved}}); err != nil {
+		t.Fatal(err)
+	}
+	bus := runOn(t, m, events.NewBus(2000))
+
+	// Holding the lock stops the manager handling events, so more are
+	// published than its subscription buffers and it is cut off.
+	const published = 1500
+	m.mu.Lock()
+	for i := 0; i < published; i++ {
+		bus.Publish(events.Event{Type: events.ClientSaved, Client: "CIA"})
+	}
+	m.mu.Unlock()
+
+	waitFor(t, "every event to be queued", func() bool {
+		return len(m.Deliveries("")) == published
+	})
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	m, err := Open(Options{Path: path, AllowPrivateHosts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(Subscription{Client: "CIA", URL: "http://127.0.0.1:1/hooks", Events: []string{events.ClientSaved}}); err != nil {
+		t.Fatal(err)
+	}
+	m.Handle(events.Event{ID: 1, Type: events.ClientSaved, Client: "CIA"})
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(Options{Path: path, AllowPrivateHosts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subs := reopened.Subscriptions("CIA"); len(subs) != 1 {
+		t.Errorf("got %d subscriptions after reopening, want 1", len(subs))
+	}
+	if pending := reopened.Deliveries(StatePending); len(pending) != 1 {
+		t.Errorf("got %d pending deliveries after reopening, want 1", len(pending))
+	}
+}
+
+func TestSubscribeRefusesPrivateHosts(t *testing.T) {
+	m, err := Open(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{
+		"http://localhost/hooks",
+		"http://127.0.0.1:8080/hooks",
+		"http://[::1]/hooks",
+		"http://10.0.0.5/hooks",
+		"http://192.168.1.1/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hooks",
+		"http://0.0.0.0/hooks",
+		"http://[::ffff:127.0.0.1]/hooks",
+	} {
+		if _, err := m.Subscribe(Subscription{Client: "CIA", URL: url, Events: []string{events.ClientSaved}}); err == nil {
+			t.Errorf("subscribing %s succeeded, want it refused", url)
+		}
+	}
+
+	if _, err := m.Subscribe(Subscription{Client: "CIA", URL: "https://hooks.example.com/fleet", Events: []string{events.ClientSaved}}); err != nil {
+		t.Errorf("subscribing a public host failed: %v", err)
+	}
+}
+
+func TestDeliveryRefusesPrivateAddresses(t *testing.T) {
+	// The host passes Subscribe's check, as a name that resolves to a
+	// private address would, but the connection is refused.
+	r := newReceiver(t)
+	client := &http.Client{Transport: publicTransport()}
+	req, err := http.NewRequest(http.MethodPost, r.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := client.Do(req); err == nil {
+		res.Body.Close()
+		t.Fatal("the request reached a loopback receiver")
+	}
+}
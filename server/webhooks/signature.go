@@ -0,0 +1,46 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Sign returns the signature header value for body sent at timestamp: the
+// hex HMAC-SHA256 of "<unix timestamp>.<body>" keyed with secret, prefixed
+// with "sha256=". Including the timestamp lets receivers reject replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature and timestamp headers against body,
+// rejecting deliveries older than tolerance. Receivers can use it directly.
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	sent := time.Unix(seconds, 0)
+	if tolerance > 0 && time.Since(sent) > tolerance {
+		return false
+	}
+
+	expected := Sign(secret, sent, body)
+	return strings.HasPrefix(signature, "sha256=") && hmac.Equal([]byte(expected), []byte(signature))
+}
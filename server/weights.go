@@ -0,0 +1,238 @@
+/*
+* @file weights.go
+* @author Byron Ojua-Nice
+* @version 1.0
+*
+* @section DESCRIPTION
+*
+* This file contains the handlers for ingesting weight readings and for the
+* Server-Sent Events streams that push them to dispatchers as they arrive.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/byron-ojua/starter-project/database"
+	"github.com/byron-ojua/starter-project/events"
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment so proxies
+// don't close the connection.
+const streamHeartbeat = 15 * time.Second
+
+// streamBuffer is how many events a stream may fall behind before it is cut
+// off and has to resume with Last-Event-ID.
+const streamBuffer = 64
+
+// streamResetMessage is the data of the reset event sent to a stream that
+// asks to resume from readings that are no longer held for replay.
+const streamResetMessage = `{"message":"readings since Last-Event-ID are no longer available; refetch them and carry on from this event"}`
+
+// NewWeightReading is the body accepted when ingesting a weight reading.
+type NewWeightReading struct {
+	Weight *float32 `json:"weight" binding:"required"`
+}
+
+// WeightReading is a weight reading for a vehicle.
+type WeightReading struct {
+	Vin    string    `json:"vin"`
+	Client string    `json:"client,omitempty"`
+	Weight float32   `json:"weight"`
+	Time   time.Time `json:"time"`
+}
+
+// addWeight records a new weight reading for a vehicle.
+// @Summary Ingest a weight reading
+// @Description Record a new weight reading for a vehicle and push it to live streams
+// @Tags vehicles
+// @Accept json
+// @Param id path string true "Vehicle ID"
+// @Param reading body NewWeightReading true "Weight reading"
+// @Param Idempotency-Key header string false "Unique key for this reading; retries with the same key get the first response instead of adding it again"
+// @Success 201 {object} WeightReading
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security apiKey
+// @Security bearerToken
+// @Router /vehicles/{id}/weights [post]
+func (h *handlers) addWeight(c *gin.Context) {
+	id := c.Param("id")
+	var reading NewWeightReading
+
+	if err := c.ShouldBindJSON(&reading); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "weight is required"})
+		return
+	}
+
+	weight := database.Weight{Vin: id, Weight: *reading.Weight, Time: time.Now().UTC()}
+	err := h.store.AddWeight(c.Request.Context(), weight)
+	if err != nil {
+		slog.Warn("adding a weight failed", "vin", id, "err", err)
+		storeFailed(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, WeightReading{
+		Vin:    id,
+		Weight: weight.Weight,
+		Time:   weight.Time,
+	})
+}
+
+// streamVehicleWeights pushes each new weight reading for a vehicle as a
+// Server-Sent Event.
+// @Summary Stream a vehicle's weight readings
+// @Description Push each new weight reading for a vehicle as a Server-Sent Event. Send Last-Event-ID to resume; a reset event means some readings were too old to replay and should be refetched.
+// @Tags vehicles
+// @Produce text/event-stream
+// @Param id path string true "Vehicle ID"
+// @Param last_event_id query int false "Resume after this event, for clients that can't send Last-Event-ID"
+// @Success 200 {object} WeightReading
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security apiKey
+// @Security bearerToken
+// @Router /vehicles/{id}/weights/stream [get]
+func (h *handlers) streamVehicleWeights(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, err := h.store.GetVehicleByVin(c.Request.Context(), id); err != nil {
+		storeFailed(c, err)
+		return
+	}
+
+	h.streamWeights(c, func(event events.Event) bool {
+		return event.Type == events.WeightAdded && event.Vin == id
+	})
+}
+
+// streamClientWeights pushes each new weight reading for any of a client's
+// vehicles as a Server-Sent Event.
+// @Summary Stream a client's weight readings
+// @Description Push each new weight reading for any of a client's vehicles as a Server-Sent Event. Send Last-Event-ID to resume; a reset event means some readings were too old to replay and should be refetched.
+// @Tags clients
+// @Produce text/event-stream
+// @Param id path string true "Client ID"
+// @Param last_event_id query int false "Resume after this event, for clients that can't send Last-Event-ID"
+// @Success 200 {object} WeightReading
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security apiKey
+// @Security bearerToken
+// @Router /clients/{id}/weights/stream [get]
+func (h *handlers) streamClientWeights(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, err := h.store.GetClientsByName(c.Request.Context(), id); err != nil {
+		storeFailed(c, err)
+		return
+	}
+
+	h.streamWeights(c, func(event events.Event) bool {
+		return event.Type == events.WeightAdded && event.Client == id
+	})
+}
+
+// streamWeights replays the readings missed since Last-Event-ID, then sends
+// each new reading matching filter until the client disconnects. When some
+// of the missed readings are too old to replay, it sends a reset event
+// instead.
+func (h *handlers) streamWeights(c *gin.Context, filter func(events.Event) bool) {
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		// EventSource can't set headers on the first connection.
+		lastID = c.Query("last_event_id")
+	}
+
+	var subscription *events.Subscription
+	var replay []events.Event
+	if lastID != "" {
+		afterID, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "invalid Last-Event-ID"})
+			return
+		}
+		subscription, replay = h.bus.SubscribeAfter(filter, streamBuffer, afterID)
+	} else {
+		subscription = h.bus.Subscribe(filter, streamBuffer)
+	}
+	defer subscription.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", 3000)
+	if resumeID, gap := subscription.Gap(); gap {
+		// Some readings have left the replay buffer, so replaying the rest
+		// would hide the gap. Tell the client to refetch instead, and give it
+		// an ID to resume from next time.
+		fmt.Fprintf(c.Writer, "id: %d\nevent: reset\ndata: %s\n\n", resumeID, streamResetMessage)
+		replay = nil
+	}
+	for _, event := range replay {
+		writeWeightEvent(c, event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+			writeWeightEvent(c, event)
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case <-c.Request.Context().Done():
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// writeWeightEvent writes a weight event in Server-Sent Events format.
+func writeWeightEvent(c *gin.Context, event events.Event) {
+	weight, ok := event.Data.(database.Weight)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(WeightReading{
+		Vin:    event.Vin,
+		Client: event.Client,
+		Weight: weight.Weight,
+		Time:   event.Time,
+	})
+	if err != nil {
+		slog.Error("encoding a weight reading failed", "err", err)
+		return
+	}
+
+	fmt.Fprintf(c.Writer, "id: %d\nevent: weight\ndata: %s\n\n", event.ID, data)
+}